@@ -0,0 +1,109 @@
+package clientip
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// AddrClass is the coarse scope of an IP address as seen by client-IP
+// plausibility checks.
+type AddrClass uint8
+
+const (
+	// AddrInvalid is the zero netip.Addr.
+	AddrInvalid AddrClass = iota
+	// AddrGlobal is a publicly routable address.
+	AddrGlobal
+	// AddrPrivate is an RFC 1918 IPv4 or RFC 4193 unique-local IPv6 address.
+	AddrPrivate
+	// AddrLoopback is 127.0.0.0/8 or ::1.
+	AddrLoopback
+	// AddrLinkLocal is a link-local unicast address.
+	AddrLinkLocal
+	// AddrReserved is an IANA special-purpose range that is not a plausible
+	// client address, such as documentation or benchmarking space.
+	AddrReserved
+	// AddrCGNAT is RFC 6598 shared address space (100.64.0.0/10).
+	AddrCGNAT
+	// AddrMulticast is a multicast address, including link-local multicast.
+	AddrMulticast
+	// AddrUnspecified is 0.0.0.0 or ::.
+	AddrUnspecified
+)
+
+// String returns the stable label for c.
+func (c AddrClass) String() string {
+	switch c {
+	case AddrGlobal:
+		return "global"
+	case AddrPrivate:
+		return "private"
+	case AddrLoopback:
+		return "loopback"
+	case AddrLinkLocal:
+		return "link_local"
+	case AddrReserved:
+		return "reserved"
+	case AddrCGNAT:
+		return "cgnat"
+	case AddrMulticast:
+		return "multicast"
+	case AddrUnspecified:
+		return "unspecified"
+	default:
+		return "invalid"
+	}
+}
+
+// AddrScope describes why an address is or is not a plausible client IP.
+type AddrScope struct {
+	// Class is the address scope.
+	Class AddrClass
+	// Range is the matching IANA special-purpose prefix for AddrReserved and
+	// AddrCGNAT. It is the zero Prefix for other classes.
+	Range netip.Prefix
+	// RangeName is the IANA registry name of Range, such as
+	// "Documentation (TEST-NET-1)".
+	RangeName string
+}
+
+// String returns the class label, followed by the matching range for
+// reserved and CGNAT addresses.
+func (s AddrScope) String() string {
+	if s.Range.IsValid() {
+		return fmt.Sprintf("%s (%s, %s)", s.Class, s.Range, s.RangeName)
+	}
+	return s.Class.String()
+}
+
+// ClassifyAddr reports the scope of ip using the same built-in rules as
+// client-IP validation. IPv4-mapped IPv6 addresses are classified as IPv4.
+//
+// Resolver policy is not applied: an address classified AddrPrivate may still
+// be accepted with WithAllowPrivateIPs, and reserved ranges may be allowlisted
+// with WithAllowedReservedClientPrefixes.
+func ClassifyAddr(ip netip.Addr) AddrScope {
+	if !ip.IsValid() {
+		return AddrScope{Class: AddrInvalid}
+	}
+
+	ip = normalizeIP(ip)
+	switch {
+	case ip.IsUnspecified():
+		return AddrScope{Class: AddrUnspecified}
+	case ip.IsLoopback():
+		return AddrScope{Class: AddrLoopback}
+	case ip.IsLinkLocalUnicast():
+		return AddrScope{Class: AddrLinkLocal}
+	case ip.IsMulticast():
+		return AddrScope{Class: AddrMulticast}
+	}
+
+	if r, ok := lookupReservedClientRange(ip); ok {
+		return AddrScope{Class: r.Class, Range: r.Prefix, RangeName: r.Name}
+	}
+	if ip.IsPrivate() {
+		return AddrScope{Class: AddrPrivate}
+	}
+	return AddrScope{Class: AddrGlobal}
+}
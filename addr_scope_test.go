@@ -0,0 +1,93 @@
+package clientip
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestClassifyAddr(t *testing.T) {
+	tests := []struct {
+		ip        string
+		want      AddrClass
+		wantRange string
+	}{
+		{ip: "8.8.8.8", want: AddrGlobal},
+		{ip: "2606:4700:4700::1111", want: AddrGlobal},
+		{ip: "10.1.2.3", want: AddrPrivate},
+		{ip: "172.16.0.1", want: AddrPrivate},
+		{ip: "192.168.1.1", want: AddrPrivate},
+		{ip: "fd00::1", want: AddrPrivate},
+		{ip: "127.0.0.1", want: AddrLoopback},
+		{ip: "::1", want: AddrLoopback},
+		{ip: "169.254.1.1", want: AddrLinkLocal},
+		{ip: "fe80::1", want: AddrLinkLocal},
+		{ip: "224.0.0.1", want: AddrMulticast},
+		{ip: "ff02::1", want: AddrMulticast},
+		{ip: "0.0.0.0", want: AddrUnspecified},
+		{ip: "::", want: AddrUnspecified},
+		{ip: "100.64.0.1", want: AddrCGNAT, wantRange: "100.64.0.0/10"},
+		{ip: "0.1.2.3", want: AddrReserved, wantRange: "0.0.0.0/8"},
+		{ip: "192.0.2.10", want: AddrReserved, wantRange: "192.0.2.0/24"},
+		{ip: "240.0.0.1", want: AddrReserved, wantRange: "240.0.0.0/4"},
+		{ip: "2001:db8::1", want: AddrReserved, wantRange: "2001:db8::/32"},
+		{ip: "64:ff9b::808:808", want: AddrReserved, wantRange: "64:ff9b::/96"},
+		{ip: "::ffff:198.51.100.1", want: AddrReserved, wantRange: "198.51.100.0/24"},
+		{ip: "::ffff:10.0.0.1", want: AddrPrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got := ClassifyAddr(netip.MustParseAddr(tt.ip))
+			if got.Class != tt.want {
+				t.Fatalf("ClassifyAddr(%s).Class = %v, want %v", tt.ip, got.Class, tt.want)
+			}
+
+			var wantRange netip.Prefix
+			if tt.wantRange != "" {
+				wantRange = netip.MustParsePrefix(tt.wantRange)
+			}
+			if got.Range != wantRange {
+				t.Fatalf("ClassifyAddr(%s).Range = %v, want %v", tt.ip, got.Range, wantRange)
+			}
+			if got.Range.IsValid() == (got.RangeName == "") {
+				t.Fatalf("ClassifyAddr(%s).RangeName = %q with range %v", tt.ip, got.RangeName, got.Range)
+			}
+		})
+	}
+
+	if got := ClassifyAddr(netip.Addr{}); got.Class != AddrInvalid {
+		t.Fatalf("ClassifyAddr(zero) = %v, want %v", got, AddrInvalid)
+	}
+}
+
+func TestClassifyAddrAgreesWithEvaluateClientIP(t *testing.T) {
+	for _, ip := range []string{"8.8.8.8", "10.0.0.1", "127.0.0.1", "169.254.0.1", "224.0.0.1", "0.0.0.0", "100.64.0.1", "198.18.0.1", "2001:db8::1", "fc00::1", "fe80::1", "2001:4860::1"} {
+		addr := netip.MustParseAddr(ip)
+		var want clientIPDisposition
+		switch ClassifyAddr(addr).Class {
+		case AddrGlobal:
+			want = clientIPValid
+		case AddrPrivate:
+			want = clientIPPrivate
+		case AddrReserved, AddrCGNAT:
+			want = clientIPReserved
+		default:
+			want = clientIPInvalid
+		}
+		if got := evaluateClientIP(addr, clientIPPolicy{}); got != want {
+			t.Errorf("evaluateClientIP(%s) = %v, ClassifyAddr implies %v", ip, got, want)
+		}
+	}
+}
+
+func TestAddrScopeString(t *testing.T) {
+	if got, want := ClassifyAddr(netip.MustParseAddr("192.0.2.1")).String(), "reserved (192.0.2.0/24, Documentation (TEST-NET-1))"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	if got, want := ClassifyAddr(netip.MustParseAddr("fe80::1")).String(), "link_local"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+	if got, want := AddrClass(200).String(), "invalid"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
@@ -30,6 +30,15 @@ const (
 	ResultCanceled
 	// ResultFallback indicates operational resolution succeeded via fallback.
 	ResultFallback
+	// ResultReportOnly indicates a WithReportOnly resolver returned the
+	// connecting peer because strict resolution would have failed.
+	// Result.WouldFailKind reports the underlying category.
+	ResultReportOnly
+	// ResultAnonymous indicates a chain source selected an "unknown" or
+	// obfuscated node as the client under OpaqueNodeAnonymous. The result has
+	// no error and Result.AnonymousNode holds the node; IP is the zero Addr
+	// unless a WithReportOnly resolver substituted the connecting peer.
+	ResultAnonymous
 )
 
 // ClassifyError maps the package's detailed error surface into a smaller set of
@@ -46,13 +55,18 @@ func ClassifyError(err error) ResultKind {
 	case errors.Is(err, ErrSourceUnavailable):
 		return ResultUnavailable
 	case errors.Is(err, ErrUntrustedProxy),
+		errors.Is(err, ErrForwardedByMismatch),
+		errors.Is(err, ErrInvalidSignature),
 		errors.Is(err, ErrNoTrustedProxies),
 		errors.Is(err, ErrTooFewTrustedProxies),
 		errors.Is(err, ErrTooManyTrustedProxies):
 		return ResultUntrusted
 	case errors.Is(err, ErrInvalidForwardedHeader),
+		errors.Is(err, ErrInvalidXForwardedForHeader),
+		errors.Is(err, ErrInvalidHeaderValue),
 		errors.Is(err, ErrChainTooLong),
-		errors.Is(err, ErrMultipleSingleIPHeaders):
+		errors.Is(err, ErrMultipleSingleIPHeaders),
+		errors.Is(err, ErrInconsistentSources):
 		return ResultMalformed
 	case errors.Is(err, ErrInvalidIP), errors.Is(err, ErrNilRequest):
 		return ResultInvalid
@@ -78,6 +92,10 @@ func (k ResultKind) String() string {
 		return "canceled"
 	case ResultFallback:
 		return "fallback"
+	case ResultReportOnly:
+		return "report_only"
+	case ResultAnonymous:
+		return "anonymous"
 	default:
 		return "unknown"
 	}
@@ -18,9 +18,15 @@ func TestClassifyError(t *testing.T) {
 		{name: "invalid ip", err: &RemoteAddrError{ExtractionError: ExtractionError{Err: ErrInvalidIP, Source: SourceRemoteAddr}, RemoteAddr: "bad"}, want: ResultInvalid},
 		{name: "nil request", err: ErrNilRequest, want: ResultInvalid},
 		{name: "untrusted proxy", err: &ProxyValidationError{ExtractionError: ExtractionError{Err: ErrUntrustedProxy, Source: SourceXRealIP}}, want: ResultUntrusted},
+		{name: "forwarded by mismatch", err: &ForwardedByError{ExtractionError: ExtractionError{Err: ErrForwardedByMismatch, Source: SourceForwarded}}, want: ResultUntrusted},
 		{name: "too few trusted proxies", err: &ProxyValidationError{ExtractionError: ExtractionError{Err: ErrTooFewTrustedProxies, Source: SourceXForwardedFor}}, want: ResultUntrusted},
 		{name: "malformed forwarded", err: fmt.Errorf("wrapped: %w", &ExtractionError{Err: ErrInvalidForwardedHeader, Source: SourceForwarded}), want: ResultMalformed},
+		{name: "malformed x-forwarded-for", err: &ExtractionError{Err: fmt.Errorf("%w: empty element", ErrInvalidXForwardedForHeader), Source: SourceXForwardedFor}, want: ResultMalformed},
+		{name: "origin secret", err: &OriginSecretError{ExtractionError: ExtractionError{Err: ErrUntrustedProxy, Source: SourceXForwardedFor}}, want: ResultUntrusted},
+		{name: "invalid signature", err: &SignatureError{ExtractionError: ExtractionError{Err: ErrInvalidSignature, Source: SourceXRealIP}}, want: ResultUntrusted},
+		{name: "invalid header value", err: &HeaderHygieneError{ExtractionError: ExtractionError{Err: ErrInvalidHeaderValue, Source: SourceXRealIP}}, want: ResultMalformed},
 		{name: "chain too long", err: &ChainTooLongError{ExtractionError: ExtractionError{Err: ErrChainTooLong, Source: SourceXForwardedFor}, ChainLength: 101, MaxLength: 100}, want: ResultMalformed},
+		{name: "inconsistent sources", err: &ConsistencyError{ExtractionError: ExtractionError{Err: ErrInconsistentSources, Source: SourceXForwardedFor}}, want: ResultMalformed},
 		{name: "multiple single-ip headers", err: &MultipleHeadersError{ExtractionError: ExtractionError{Err: ErrMultipleSingleIPHeaders, Source: SourceXRealIP}, HeaderCount: 2}, want: ResultMalformed},
 		{name: "canceled", err: context.Canceled, want: ResultCanceled},
 		{name: "deadline exceeded", err: context.DeadlineExceeded, want: ResultCanceled},
@@ -3,6 +3,7 @@ package clientip
 import (
 	"fmt"
 	"net/netip"
+	"net/textproto"
 	"reflect"
 	"slices"
 )
@@ -27,8 +28,8 @@ const (
 )
 
 // ChainSelection controls how the client candidate is selected from a parsed
-// Forwarded or X-Forwarded-For proxy chain after trusted proxy validation. The
-// default is RightmostUntrustedIP.
+// Forwarded, X-Forwarded-For, or ChainHeaderSource proxy chain after trusted
+// proxy validation. The default is RightmostUntrustedIP.
 type ChainSelection int
 
 const (
@@ -91,14 +92,23 @@ type options struct {
 	// prefixes in tests.
 	AllowedReservedClientPrefixes []netip.Prefix
 
-	// MaxChainLength limits the number of IPs accepted in Forwarded and
-	// X-Forwarded-For chains. A value of 0 uses DefaultMaxChainLength.
+	// RejectedClientPrefixes extends the built-in reserved client ranges with
+	// deployment-specific non-routable blocks.
+	RejectedClientPrefixes []netip.Prefix
+
+	// EmbeddedIPv4 selects NAT64, 6to4, and Teredo addresses whose embedded
+	// IPv4 address is used as the client IP.
+	EmbeddedIPv4 EmbeddedIPv4Policy
+
+	// MaxChainLength limits the number of IPs accepted in Forwarded,
+	// X-Forwarded-For, and ChainHeaderSource chains. A value of 0 uses
+	// DefaultMaxChainLength.
 	MaxChainLength int
 
-	// ChainSelection selects the client candidate from Forwarded and
-	// X-Forwarded-For chains. Leave zero for the default RightmostUntrustedIP.
-	// LeftmostUntrustedIP requires TrustedProxyPrefixes when a chain source is
-	// configured.
+	// ChainSelection selects the client candidate from Forwarded,
+	// X-Forwarded-For, and ChainHeaderSource chains. Leave zero for the
+	// default RightmostUntrustedIP. LeftmostUntrustedIP requires
+	// TrustedProxyPrefixes when a chain source is configured.
 	ChainSelection ChainSelection
 
 	// DebugInfo includes parsed chain details in successful chain-source
@@ -118,16 +128,92 @@ type options struct {
 	// disables observation. Typed nil implementations are rejected during
 	// validation.
 	Observer Observer
+
+	// ClientIPValidator applies application-specific rules after the built-in
+	// client-IP plausibility checks. Nil disables custom validation.
+	ClientIPValidator ClientIPValidator
+
+	// ReportOnly computes strict decisions without failing: strict errors move
+	// to Result.WouldFail and the connecting peer is returned instead.
+	ReportOnly bool
+
+	// UntrustedPeerPolicies overrides the default UntrustedPeerReject behavior
+	// per header source.
+	UntrustedPeerPolicies map[Source]UntrustedPeerPolicy
+
+	// SourceFailurePolicies lists, per source, the failure kinds that let the
+	// next source run instead of ending resolution.
+	SourceFailurePolicies map[Source][]ResultKind
+
+	// SourceClientIPPolicies replaces the resolver-wide client-IP policy for
+	// individual sources.
+	SourceClientIPPolicies map[Source]ClientIPPolicy
+
+	// SourceConditions gates individual sources on marker headers, the local
+	// port, or the request path.
+	SourceConditions map[Source]SourceCondition
+
+	// OriginSecretHeader names the header that must carry one of
+	// OriginSecrets before header sources are trusted.
+	OriginSecretHeader string
+
+	// OriginSecrets lists the accepted origin secrets.
+	OriginSecrets []string
+
+	// TrustedProxyHosts adds the resolved addresses of proxy hostnames to
+	// TrustedProxyPrefixes.
+	TrustedProxyHosts *TrustedProxyHosts
+
+	// TrustedPeerIdentities trusts immediate peers by verified client
+	// certificate.
+	TrustedPeerIdentities []PeerIdentity
+
+	// PeerTrustMode combines TrustedPeerIdentities with
+	// TrustedProxyPrefixes.
+	PeerTrustMode PeerTrustMode
+
+	// ConsistencyGroups lists sources that must agree on the client IP.
+	ConsistencyGroups []ConsistencyGroup
+
+	// ChainReconciliation allows Forwarded and X-Forwarded-For together and
+	// selects how their chains are reconciled.
+	ChainReconciliation ChainReconciliation
+
+	// OpaqueNodes selects how chain sources treat "unknown" and obfuscated
+	// nodes.
+	OpaqueNodes OpaqueNodePolicy
+
+	// HeaderHygiene enables pre-parse validation of source header values.
+	HeaderHygiene bool
+
+	// MaxHeaderBytes limits the total size of one source header when
+	// HeaderHygiene is enabled. Zero means no size limit.
+	MaxHeaderBytes int
+
+	// ForwardedParsing sets the parse strictness for Forwarded parameters
+	// other than for=.
+	ForwardedParsing ForwardedParsing
+
+	// XForwardedForParsing sets the parse strictness for X-Forwarded-For and
+	// ChainHeaderSource headers.
+	XForwardedForParsing XForwardedForParsing
+
+	// ForwardedByValidation enables RFC 7239 by= checks for SourceForwarded.
+	ForwardedByValidation bool
+
+	// ForwardedByIdentifiers are accepted as the nearest element's by= in
+	// addition to the local listener address.
+	ForwardedByIdentifiers []string
 }
 
 // WithTrustedProxies declares upstream proxy ranges allowed to supply
 // header-based client IPs.
 //
 // Header sources are accepted only when the immediate RemoteAddr peer is in
-// one of these prefixes. Chain sources such as SourceForwarded and
-// SourceXForwardedFor also use these prefixes to identify the trusted suffix
-// of proxy hops before selecting the client candidate. Only include ranges
-// that can actually connect to this service.
+// one of these prefixes. Chain sources such as SourceForwarded,
+// SourceXForwardedFor, and ChainHeaderSource sources also use these prefixes
+// to identify the trusted suffix of proxy hops before selecting the client
+// candidate. Only include ranges that can actually connect to this service.
 func WithTrustedProxies(prefixes ...netip.Prefix) Option {
 	return optionFunc(func(c *options) { c.TrustedProxyPrefixes = clonePrefixes(prefixes) })
 }
@@ -170,7 +256,20 @@ func WithAllowedReservedClientPrefixes(prefixes ...netip.Prefix) Option {
 	return optionFunc(func(c *options) { c.AllowedReservedClientPrefixes = clonePrefixes(prefixes) })
 }
 
-// WithMaxChainLength caps Forwarded and X-Forwarded-For chain length.
+// WithRejectedClientPrefixes adds deployment-specific ranges to the reserved
+// client table.
+//
+// Client IPs in these prefixes fail like built-in reserved ranges, with
+// ErrReservedIP, in every source. Use it for organization-specific
+// non-routable blocks. WithAllowedReservedClientPrefixes still takes
+// precedence for addresses in both lists. The built-in table is available
+// from SpecialPurposeRanges.
+func WithRejectedClientPrefixes(prefixes ...netip.Prefix) Option {
+	return optionFunc(func(c *options) { c.RejectedClientPrefixes = clonePrefixes(prefixes) })
+}
+
+// WithMaxChainLength caps Forwarded, X-Forwarded-For, and ChainHeaderSource
+// chain length.
 //
 // A zero value uses DefaultMaxChainLength. Negative values are rejected by
 // New.
@@ -200,9 +299,10 @@ func WithDebugInfo() Option {
 //
 // Sources are attempted in order. ErrSourceUnavailable allows the next source
 // to run, while malformed headers, proxy-trust failures, chain limits, invalid
-// client IPs, and context errors are terminal. Header-based sources require
-// WithTrustedProxies. SourceStaticFallback is result-only and is rejected
-// here.
+// client IPs, and context errors are terminal unless WithSourceFailurePolicy
+// marks them skippable for a source. Header-based sources and CustomSource
+// sources without AllowAnyPeer require WithTrustedProxies.
+// SourceStaticFallback is result-only and is rejected here.
 func WithSources(sources ...Source) Option {
 	return optionFunc(func(c *options) { c.Sources = cloneSources(sources) })
 }
@@ -225,6 +325,37 @@ func WithObserver(observer Observer) Option {
 	return optionFunc(func(c *options) { c.Observer = observer })
 }
 
+// WithClientIPValidator adds application-specific client-IP rules.
+//
+// validator runs in every source after the private and reserved range checks
+// pass, for example to reject the application's own egress NAT addresses or
+// known scanner ranges. A returned error rejects the address: chain and
+// single-header sources fail with InvalidIPError and RemoteAddr fails with
+// RemoteAddrError, both wrapping ErrInvalidIP and the validator error and
+// classified as ResultInvalid. Each rejection logs SecurityEventClientIPRejected.
+// Calling it again replaces the previous validator; nil removes it.
+func WithClientIPValidator(validator ClientIPValidator) Option {
+	return optionFunc(func(c *options) { c.ClientIPValidator = validator })
+}
+
+// WithReportOnly enables resolver-wide report-only (dry-run) strict mode.
+//
+// Strict resolution still runs with the full policy, and Logger still receives
+// the same security events (tagged with report_only=true). When strict
+// resolution fails, Resolve returns the connecting RemoteAddr peer with Err
+// nil, Source SourceRemoteAddr, and the would-be strict error in
+// Result.WouldFail. Result.Classify reports ResultReportOnly so metrics stay
+// distinguishable from enforced results; Result.WouldFailKind and
+// Result.WouldFailSource report the kind and source that would have been
+// enforced. Context cancellation and deadline errors still fail.
+//
+// Use this to roll out a new trusted-proxy policy before enforcing it. Unlike
+// ResolveOperational, it applies to every call, including Middleware. Results
+// with WouldFail set must not be used for trust-boundary decisions.
+func WithReportOnly() Option {
+	return optionFunc(func(c *options) { c.ReportOnly = true })
+}
+
 // defaultOptions returns the default extractor configuration.
 //
 // The default is safe for direct client-to-app traffic: RemoteAddr only,
@@ -283,12 +414,33 @@ type config struct {
 
 	allowPrivateIPs             bool
 	allowReservedClientPrefixes []netip.Prefix
+	rejectedClientPrefixes      []netip.Prefix
+	embeddedIPv4                *embeddedIPv4Unwrapper
 	maxChainLength              int
 	chainSelection              ChainSelection
+	chainReconciliation         ChainReconciliation
+	opaqueNodes                 OpaqueNodePolicy
+	forwardedBy                 *forwardedByPolicy
+	xffParsing                  XForwardedForParsing
+	forwardedParsing            ForwardedParsing
+	headerHygiene               headerHygiene
 	debugMode                   bool
 
-	sourcePriority   []Source
-	sourceHeaderKeys []string
+	sourcePriority        []Source
+	sourceHeaderKeys      []string
+	untrustedPeerPolicies map[Source]UntrustedPeerPolicy
+	sourceFailurePolicies map[Source][]ResultKind
+
+	// remoteAddrOnly lets Extract skip request-view construction and the
+	// source loop when SourceRemoteAddr is the only configured source.
+	remoteAddrOnly bool
+
+	sourceClientIPPolicies map[Source]clientIPPolicy
+	sourceConditions       map[Source]sourceCondition
+	originSecret           *originSecret
+	peerIdentities         *peerIdentityPolicy
+	trustedProxyHosts      *TrustedProxyHosts
+	consistencyGroups      []consistencyGroup
 
 	// clientIP and proxy are derived from the fields above and populated by
 	// configFromPublic after all other normalization is complete. They are
@@ -300,6 +452,7 @@ type config struct {
 	logger     Logger
 	loggerNoop bool
 	observer   Observer
+	reportOnly bool
 }
 
 // validate checks normalized runtime configuration after defaults and public
@@ -314,7 +467,7 @@ func (c *config) validate() error {
 	if c.maxTrustedProxies > 0 && c.minTrustedProxies > c.maxTrustedProxies {
 		return fmt.Errorf("minTrustedProxies (%d) cannot exceed maxTrustedProxies (%d)", c.minTrustedProxies, c.maxTrustedProxies)
 	}
-	if c.minTrustedProxies > 0 && len(c.trustedProxyCIDRs) == 0 {
+	if c.minTrustedProxies > 0 && !c.hasTrustedProxies() {
 		return fmt.Errorf("minTrustedProxies > 0 requires TrustedProxyPrefixes to be configured for security validation; to skip validation and trust all proxies, set TrustedProxyPrefixes to 0.0.0.0/0 and ::/0")
 	}
 	if c.maxChainLength <= 0 {
@@ -323,6 +476,18 @@ func (c *config) validate() error {
 	if !c.chainSelection.valid() {
 		return fmt.Errorf("invalid chain selection %d (must be RightmostUntrustedIP=1 or LeftmostUntrustedIP=2)", c.chainSelection)
 	}
+	if !c.opaqueNodes.valid() {
+		return fmt.Errorf("invalid opaque node policy %d", c.opaqueNodes)
+	}
+	if err := c.headerHygiene.validate(); err != nil {
+		return err
+	}
+	if !c.forwardedParsing.valid() {
+		return fmt.Errorf("invalid Forwarded parsing mode %d", c.forwardedParsing)
+	}
+	if !c.xffParsing.valid() {
+		return fmt.Errorf("invalid X-Forwarded-For parsing mode %d", c.xffParsing)
+	}
 	if len(c.sourcePriority) == 0 {
 		return fmt.Errorf("at least one source required in priority list")
 	}
@@ -332,12 +497,37 @@ func (c *config) validate() error {
 		return err
 	}
 
-	if hasChainSource && c.chainSelection == LeftmostUntrustedIP && len(c.trustedProxyCIDRs) == 0 {
+	if hasChainSource && c.chainSelection == LeftmostUntrustedIP && !c.hasTrustedProxies() {
 		return fmt.Errorf("LeftmostUntrustedIP selection requires trusted proxy prefixes to be configured; without trusted-proxy validation, this selection provides no security benefit over RightmostUntrustedIP")
 	}
 
-	if hasHeaderSource && len(c.trustedProxyCIDRs) == 0 {
-		return fmt.Errorf("header-based sources require trusted proxy prefixes; configure TrustedProxyPrefixes directly or use LoopbackProxyPrefixes, PrivateProxyPrefixes, LocalProxyPrefixes, or ProxyPrefixesFromAddrs")
+	if hasHeaderSource && !c.hasTrustedProxies() && c.peerIdentities == nil {
+		return fmt.Errorf("header-based sources require trusted proxy prefixes; configure TrustedProxyPrefixes directly or use LoopbackProxyPrefixes, PrivateProxyPrefixes, LocalProxyPrefixes, or ProxyPrefixesFromAddrs, or trust peers by certificate with WithTrustedPeerIdentities")
+	}
+	if c.peerIdentities != nil && c.peerIdentities.mode == PeerTrustAll && !c.hasTrustedProxies() {
+		return fmt.Errorf("PeerTrustAll requires trusted proxy prefixes")
+	}
+
+	if err := c.validateUntrustedPeerPolicies(); err != nil {
+		return err
+	}
+	if err := c.validateSourceFailurePolicies(); err != nil {
+		return err
+	}
+	if err := c.validateSourceClientIPPolicies(); err != nil {
+		return err
+	}
+	if err := c.validateSourceConditions(); err != nil {
+		return err
+	}
+	if err := c.validateOriginSecret(); err != nil {
+		return err
+	}
+	if err := c.validateConsistencyGroups(); err != nil {
+		return err
+	}
+	if err := c.validateForwardedBy(); err != nil {
+		return err
 	}
 
 	if isNilValue(c.logger) {
@@ -350,15 +540,30 @@ func (c *config) validate() error {
 }
 
 // validateSourcePriority rejects invalid or duplicate canonical sources and
-// enforces the one-chain-header rule. Mixing Forwarded and XFF would create two
-// independent proxy chains with unclear trust semantics.
+// enforces the one-chain-header rule for the standard headers. Mixing Forwarded
+// and XFF would create two independent records of the same hops with unclear
+// trust semantics, so it requires an explicit WithChainReconciliation mode.
+// ChainHeaderSource headers are explicitly named by the caller and may be
+// combined with either, but no header may be read by two sources.
 func (c *config) validateSourcePriority() (hasHeaderSource, hasChainSource bool, err error) {
 	seen := make(map[Source]struct{}, len(c.sourcePriority))
+	names := make(map[string]int, len(c.sourcePriority))
+	headers := make(map[string]struct{}, len(c.sourcePriority))
 	seenForwarded := false
 	seenXFF := false
 
 	for _, source := range c.sourcePriority {
 		source = canonicalSource(source)
+		if source.kind == sourceCustom && source.custom != nil && source.custom.extractor == nil {
+			return false, false, fmt.Errorf("custom source %q requires a non-nil Extractor", source)
+		}
+		if source.kind == sourceCustom && source.custom != nil {
+			if v, ok := source.custom.extractor.(validatingExtractor); ok {
+				if err := v.validate(); err != nil {
+					return false, false, fmt.Errorf("custom source %q: %w", source, err)
+				}
+			}
+		}
 		if !source.valid() {
 			return false, false, fmt.Errorf("source names cannot be empty")
 		}
@@ -379,13 +584,36 @@ func (c *config) validateSourcePriority() (hasHeaderSource, hasChainSource bool,
 			seenXFF = true
 			hasChainSource = true
 			hasHeaderSource = true
+		case sourceChainHeader:
+			hasChainSource = true
+			hasHeaderSource = true
 		case sourceXRealIP, sourceHeader:
 			hasHeaderSource = true
+		case sourceCustom:
+			hasHeaderSource = hasHeaderSource || source.peerChecked()
+		}
+
+		names[source.String()]++
+
+		if key, ok := source.headerKey(); ok {
+			key = textproto.CanonicalMIMEHeaderKey(key)
+			if _, ok := headers[key]; ok {
+				return false, false, fmt.Errorf("header %q is read by more than one source in the priority list", key)
+			}
+			headers[key] = struct{}{}
 		}
 	}
 
-	if seenForwarded && seenXFF {
-		return false, false, fmt.Errorf("priority cannot include both %q and %q; choose one proxy chain header", builtinSource(sourceForwarded), builtinSource(sourceXForwardedFor))
+	// Distinct header sources may share a normalized name ("Foo-Bar" and
+	// "Foo_Bar"), but custom sources are identified by name alone.
+	for _, source := range c.sourcePriority {
+		if source.kind == sourceCustom && names[source.String()] > 1 {
+			return false, false, fmt.Errorf("custom source name %q collides with another source in the priority list", source)
+		}
+	}
+
+	if err := c.validateChainReconciliation(seenForwarded, seenXFF); err != nil {
+		return false, false, err
 	}
 
 	return hasHeaderSource, hasChainSource, nil
@@ -425,6 +653,13 @@ func cloneSources(values []Source) []Source {
 	return slices.Clone(values)
 }
 
+// hasTrustedProxies reports whether trusted proxy prefixes or hostnames are
+// configured. It reads the derived proxy policy, which configFromPublic
+// builds before validation.
+func (c *config) hasTrustedProxies() bool {
+	return c.proxy.hasTrustedProxies()
+}
+
 // isNilValue catches typed nil interface values, such as (*myLogger)(nil),
 // that compare non-nil as an interface but would panic when called.
 func isNilValue(v any) bool {
@@ -527,6 +762,53 @@ func configFromPublic(public options) (*config, error) {
 		cfg.allowReservedClientPrefixes = mergeUniquePrefixes(nil, normalized...)
 	}
 
+	if public.RejectedClientPrefixes != nil {
+		normalized, err := normalizePrefixes(public.RejectedClientPrefixes, "rejected client prefix")
+		if err != nil {
+			return nil, err
+		}
+		cfg.rejectedClientPrefixes = mergeUniquePrefixes(nil, normalized...)
+	}
+
+	embeddedIPv4, err := newEmbeddedIPv4Unwrapper(public.EmbeddedIPv4)
+	if err != nil {
+		return nil, err
+	}
+	cfg.embeddedIPv4 = embeddedIPv4
+
+	forwardedBy, err := newForwardedByPolicy(public.ForwardedByValidation, public.ForwardedByIdentifiers)
+	if err != nil {
+		return nil, err
+	}
+	cfg.forwardedBy = forwardedBy
+
+	sourceClientIPPolicies, err := normalizeSourceClientIPPolicies(public.SourceClientIPPolicies)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sourceClientIPPolicies = sourceClientIPPolicies
+
+	peerIdentities, err := newPeerIdentityPolicy(public.TrustedPeerIdentities, public.PeerTrustMode)
+	if err != nil {
+		return nil, err
+	}
+	cfg.peerIdentities = peerIdentities
+	if public.TrustedProxyHosts != nil {
+		cfg.trustedProxyHosts = public.TrustedProxyHosts
+	}
+
+	originSecret, err := newOriginSecret(public.OriginSecretHeader, public.OriginSecrets)
+	if err != nil {
+		return nil, err
+	}
+	cfg.originSecret = originSecret
+
+	sourceConditions, err := normalizeSourceConditions(public.SourceConditions)
+	if err != nil {
+		return nil, err
+	}
+	cfg.sourceConditions = sourceConditions
+
 	if public.MaxChainLength != 0 {
 		cfg.maxChainLength = public.MaxChainLength
 	}
@@ -541,6 +823,18 @@ func configFromPublic(public options) (*config, error) {
 	cfg.maxTrustedProxies = public.MaxTrustedProxies
 	cfg.allowPrivateIPs = public.AllowPrivateIPs
 	cfg.debugMode = public.DebugInfo
+	cfg.reportOnly = public.ReportOnly
+	cfg.untrustedPeerPolicies = canonicalSourceMap(public.UntrustedPeerPolicies)
+	cfg.sourceFailurePolicies = canonicalSourceMap(public.SourceFailurePolicies)
+	cfg.consistencyGroups = normalizeConsistencyGroups(public.ConsistencyGroups)
+	cfg.chainReconciliation = public.ChainReconciliation
+	cfg.opaqueNodes = public.OpaqueNodes
+	cfg.xffParsing = public.XForwardedForParsing
+	cfg.forwardedParsing = public.ForwardedParsing
+	cfg.headerHygiene = headerHygiene{enabled: public.HeaderHygiene, maxBytes: public.MaxHeaderBytes}
+	if cfg.forwardedBy != nil {
+		cfg.forwardedBy.lenient = cfg.forwardedParsing == ForwardedLenient
+	}
 
 	if public.Logger != nil {
 		cfg.logger = public.Logger
@@ -551,16 +845,27 @@ func configFromPublic(public options) (*config, error) {
 	}
 
 	cfg.sourceHeaderKeys = sourceHeaderKeys(cfg.sourcePriority)
+	cfg.remoteAddrOnly = len(cfg.sourcePriority) == 1 && cfg.sourcePriority[0] == builtinSource(sourceRemoteAddr)
 	cfg.trustedProxyMatch = newPrefixMatcher(cfg.trustedProxyCIDRs)
 	cfg.clientIP = clientIPPolicy{
+		Name:                        defaultClientIPPolicyName,
 		AllowPrivateIPs:             cfg.allowPrivateIPs,
 		AllowReservedClientPrefixes: cfg.allowReservedClientPrefixes,
+		Validator:                   public.ClientIPValidator,
+		embedded:                    cfg.embeddedIPv4,
+	}
+	if len(cfg.rejectedClientPrefixes) > 0 {
+		cfg.clientIP.reserved = newReservedTable(cfg.rejectedClientPrefixes)
 	}
 	cfg.proxy = proxyPolicy{
 		TrustedProxyCIDRs: cfg.trustedProxyCIDRs,
 		TrustedProxyMatch: cfg.trustedProxyMatch,
 		MinTrustedProxies: cfg.minTrustedProxies,
 		MaxTrustedProxies: cfg.maxTrustedProxies,
+		OpaqueNodes:       cfg.opaqueNodes,
+		OriginSecret:      cfg.originSecret,
+		PeerIdentities:    cfg.peerIdentities,
+		Hosts:             cfg.trustedProxyHosts,
 	}
 
 	if err := cfg.validate(); err != nil {
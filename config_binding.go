@@ -0,0 +1,546 @@
+package clientip
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// flagNamePrefix namespaces flags registered by RegisterFlags so they do not
+// collide with application flags on a shared FlagSet.
+const flagNamePrefix = "clientip-"
+
+// configBinding describes one externally bindable setting. Environment
+// variables and command-line flags share the same table so both surfaces
+// accept identical names, values, and errors.
+type configBinding struct {
+	// key is the upper-case, underscore-separated setting name used for
+	// environment variables. Flag names are derived from it.
+	key     string
+	usage   string
+	boolean bool
+	parse   func(value string) (Option, error)
+}
+
+var configBindings = []configBinding{
+	{
+		key:   "TRUSTED_PROXIES",
+		usage: "comma-separated trusted proxy CIDRs",
+		parse: func(value string) (Option, error) {
+			prefixes, err := ParseCIDRs(splitBindingList(value)...)
+			if err != nil {
+				return nil, err
+			}
+			return WithTrustedProxies(prefixes...), nil
+		},
+	},
+	{
+		key:   "SOURCES",
+		usage: "comma-separated source priority (for example x_forwarded_for,remote_addr)",
+		parse: func(value string) (Option, error) {
+			names := splitBindingList(value)
+			if len(names) == 0 {
+				return nil, errors.New("at least one source is required")
+			}
+
+			sources := make([]Source, 0, len(names))
+			for _, name := range names {
+				source := sourceFromString(name)
+				if !source.valid() {
+					return nil, fmt.Errorf("invalid source %q", name)
+				}
+				sources = append(sources, source)
+			}
+			return WithSources(sources...), nil
+		},
+	},
+	{
+		key:   "CHAIN_SELECTION",
+		usage: "chain selection: rightmost_untrusted or leftmost_untrusted",
+		parse: func(value string) (Option, error) {
+			selection, err := parseChainSelection(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithChainSelection(selection), nil
+		},
+	},
+	{
+		key:   "CHAIN_RECONCILIATION",
+		usage: "Forwarded/X-Forwarded-For reconciliation: off, require_agreement, prefer_forwarded, or prefer_x_forwarded_for",
+		parse: func(value string) (Option, error) {
+			mode, err := parseChainReconciliation(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithChainReconciliation(mode), nil
+		},
+	},
+	{
+		key:   "OPAQUE_NODES",
+		usage: "handling of unknown and obfuscated chain nodes: invalid, skip, terminal, or anonymous",
+		parse: func(value string) (Option, error) {
+			policy, err := parseOpaqueNodePolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithOpaqueNodePolicy(policy), nil
+		},
+	},
+	{
+		key:   "HEADER_HYGIENE",
+		usage: "pre-parse header validation: true, false, or a maximum header size in bytes",
+		parse: func(value string) (Option, error) {
+			if enabled, err := strconv.ParseBool(value); err == nil {
+				if !enabled {
+					return nil, nil
+				}
+				return WithHeaderHygiene(0), nil
+			}
+			n, err := parseBindingInt(value)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid header hygiene %q (must be a boolean or a positive byte count)", value)
+			}
+			return WithHeaderHygiene(n), nil
+		},
+	},
+	{
+		key:   "FORWARDED_PARSING",
+		usage: "Forwarded parse strictness for parameters other than for=: strict or lenient",
+		parse: func(value string) (Option, error) {
+			mode, err := parseForwardedParsing(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithForwardedParsing(mode), nil
+		},
+	},
+	{
+		key:   "X_FORWARDED_FOR_PARSING",
+		usage: "X-Forwarded-For parse strictness: standard, strict, or lenient",
+		parse: func(value string) (Option, error) {
+			mode, err := parseXForwardedForParsing(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithXForwardedForParsing(mode), nil
+		},
+	},
+	{
+		key:     "FORWARDED_BY_VALIDATION",
+		usage:   "validate RFC 7239 by= against the local listener and the proxy chain",
+		boolean: true,
+		parse: func(value string) (Option, error) {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean %q", value)
+			}
+			if !enabled {
+				return nil, nil
+			}
+			return WithForwardedByValidation(), nil
+		},
+	},
+	{
+		key:   "FORWARDED_BY_IDENTIFIERS",
+		usage: "comma-separated by= identifiers accepted besides the local listener address; enables by= validation",
+		parse: func(value string) (Option, error) {
+			identifiers := splitBindingList(value)
+			if _, err := newForwardedByPolicy(true, identifiers); err != nil {
+				return nil, err
+			}
+			return WithForwardedByValidation(identifiers...), nil
+		},
+	},
+	{
+		key:   "TRUSTED_PEER_URIS",
+		usage: "comma-separated client certificate URI SANs (for example SPIFFE IDs) trusted as the immediate peer",
+		parse: func(value string) (Option, error) {
+			return parsePeerIdentityBinding(value, func(item string) PeerIdentity { return PeerIdentity{URI: item} })
+		},
+	},
+	{
+		key:   "TRUSTED_PEER_DNS_NAMES",
+		usage: "comma-separated client certificate DNS SANs trusted as the immediate peer",
+		parse: func(value string) (Option, error) {
+			return parsePeerIdentityBinding(value, func(item string) PeerIdentity { return PeerIdentity{DNSName: item} })
+		},
+	},
+	{
+		key:   "PEER_TRUST_MODE",
+		usage: "how peer identities combine with trusted proxies: any or all",
+		parse: func(value string) (Option, error) {
+			mode, err := parsePeerTrustMode(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithPeerTrustMode(mode), nil
+		},
+	},
+	{
+		key:     "ALLOW_PRIVATE_IPS",
+		usage:   "allow RFC1918 and unique-local client addresses",
+		boolean: true,
+		parse: func(value string) (Option, error) {
+			allow, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean %q", value)
+			}
+			if !allow {
+				return nil, nil
+			}
+			return WithAllowPrivateIPs(), nil
+		},
+	},
+	{
+		key:   "ALLOWED_RESERVED_CLIENT_PREFIXES",
+		usage: "comma-separated reserved client CIDRs to allow",
+		parse: func(value string) (Option, error) {
+			prefixes, err := ParseCIDRs(splitBindingList(value)...)
+			if err != nil {
+				return nil, err
+			}
+			return WithAllowedReservedClientPrefixes(prefixes...), nil
+		},
+	},
+	{
+		key:   "REJECTED_CLIENT_PREFIXES",
+		usage: "comma-separated client CIDRs to reject as reserved",
+		parse: func(value string) (Option, error) {
+			prefixes, err := ParseCIDRs(splitBindingList(value)...)
+			if err != nil {
+				return nil, err
+			}
+			return WithRejectedClientPrefixes(prefixes...), nil
+		},
+	},
+	{
+		key:   "MAX_CHAIN_LENGTH",
+		usage: "maximum Forwarded/X-Forwarded-For chain length",
+		parse: func(value string) (Option, error) {
+			n, err := parseBindingInt(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithMaxChainLength(n), nil
+		},
+	},
+	{
+		key:   "MIN_TRUSTED_PROXIES",
+		usage: "minimum trusted proxies required in a parsed chain",
+		parse: func(value string) (Option, error) {
+			n, err := parseBindingInt(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithMinTrustedProxies(n), nil
+		},
+	},
+	{
+		key:   "MAX_TRUSTED_PROXIES",
+		usage: "maximum trusted proxies allowed in a parsed chain",
+		parse: func(value string) (Option, error) {
+			n, err := parseBindingInt(value)
+			if err != nil {
+				return nil, err
+			}
+			return WithMaxTrustedProxies(n), nil
+		},
+	},
+	{
+		key:     "DEBUG_INFO",
+		usage:   "include parsed chain diagnostics on successful chain results",
+		boolean: true,
+		parse: func(value string) (Option, error) {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean %q", value)
+			}
+			if !enabled {
+				return nil, nil
+			}
+			return WithDebugInfo(), nil
+		},
+	},
+	{
+		key:     "REPORT_ONLY",
+		usage:   "report strict failures without enforcing them",
+		boolean: true,
+		parse: func(value string) (Option, error) {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid boolean %q", value)
+			}
+			if !enabled {
+				return nil, nil
+			}
+			return WithReportOnly(), nil
+		},
+	},
+}
+
+// OptionsFromEnv builds options from these environment variables:
+//
+//   - PREFIX_TRUSTED_PROXIES, PREFIX_SOURCES, PREFIX_CHAIN_SELECTION
+//   - PREFIX_CHAIN_RECONCILIATION
+//   - PREFIX_OPAQUE_NODES
+//   - PREFIX_X_FORWARDED_FOR_PARSING
+//   - PREFIX_FORWARDED_PARSING
+//   - PREFIX_FORWARDED_BY_VALIDATION, PREFIX_FORWARDED_BY_IDENTIFIERS
+//   - PREFIX_HEADER_HYGIENE
+//   - PREFIX_TRUSTED_PEER_URIS, PREFIX_TRUSTED_PEER_DNS_NAMES, PREFIX_PEER_TRUST_MODE
+//   - PREFIX_ALLOW_PRIVATE_IPS, PREFIX_ALLOWED_RESERVED_CLIENT_PREFIXES
+//   - PREFIX_REJECTED_CLIENT_PREFIXES
+//   - PREFIX_MAX_CHAIN_LENGTH
+//   - PREFIX_MIN_TRUSTED_PROXIES, PREFIX_MAX_TRUSTED_PROXIES
+//   - PREFIX_DEBUG_INFO, PREFIX_REPORT_ONLY
+//
+// The prefix is upper-cased and joined with an underscore; an empty prefix uses
+// the bare setting names. Unset or empty variables leave the corresponding
+// default untouched. List values are comma-separated, and sources accept the
+// same names as Source.UnmarshalText.
+//
+// Every variable is parsed before returning, so the error reports all invalid
+// values together. The returned options still pass through New validation;
+// for example, header sources continue to require trusted proxies.
+func OptionsFromEnv(prefix string) ([]Option, error) {
+	return optionsFromLookup(prefix, os.LookupEnv)
+}
+
+func optionsFromLookup(prefix string, lookup func(string) (string, bool)) ([]Option, error) {
+	envPrefix := strings.ToUpper(strings.TrimSpace(prefix))
+	if envPrefix != "" && !strings.HasSuffix(envPrefix, "_") {
+		envPrefix += "_"
+	}
+
+	var (
+		opts []Option
+		errs []error
+	)
+	for _, binding := range configBindings {
+		name := envPrefix + binding.key
+		value, ok := lookup(name)
+		if !ok || strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		opt, err := binding.parse(strings.TrimSpace(value))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return opts, nil
+}
+
+// FlagOptions holds resolver settings bound to a flag.FlagSet by
+// RegisterFlags.
+//
+// Values are recorded during flag parsing and converted by Options, so invalid
+// values from several flags are reported together rather than one at a time.
+type FlagOptions struct {
+	values []*bindingFlagValue
+}
+
+// RegisterFlags binds the same settings as OptionsFromEnv to fs.
+//
+// Flags are named after the environment settings in lower-case kebab form with
+// a "clientip-" prefix:
+//
+//   - -clientip-trusted-proxies, -clientip-sources, -clientip-chain-selection
+//   - -clientip-chain-reconciliation
+//   - -clientip-opaque-nodes
+//   - -clientip-x-forwarded-for-parsing
+//   - -clientip-forwarded-parsing
+//   - -clientip-forwarded-by-validation, -clientip-forwarded-by-identifiers
+//   - -clientip-header-hygiene
+//   - -clientip-trusted-peer-uris, -clientip-trusted-peer-dns-names, -clientip-peer-trust-mode
+//   - -clientip-allow-private-ips, -clientip-allowed-reserved-client-prefixes
+//   - -clientip-rejected-client-prefixes
+//   - -clientip-max-chain-length
+//   - -clientip-min-trusted-proxies, -clientip-max-trusted-proxies
+//   - -clientip-debug-info, -clientip-report-only
+//
+// Call Options after fs.Parse to obtain the resulting options; flags that were
+// not set leave their defaults untouched.
+func RegisterFlags(fs *flag.FlagSet) *FlagOptions {
+	flags := &FlagOptions{values: make([]*bindingFlagValue, 0, len(configBindings))}
+	if fs == nil {
+		return flags
+	}
+
+	for i := range configBindings {
+		binding := &configBindings[i]
+		value := &bindingFlagValue{binding: binding}
+		fs.Var(value, flagNamePrefix+bindingFlagName(binding.key), binding.usage)
+		flags.values = append(flags.values, value)
+	}
+
+	return flags
+}
+
+// Options converts the parsed flag values into resolver options.
+//
+// It returns every invalid flag value joined into one error.
+func (f *FlagOptions) Options() ([]Option, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	var (
+		opts []Option
+		errs []error
+	)
+	for _, value := range f.values {
+		if !value.set {
+			continue
+		}
+
+		opt, err := value.binding.parse(strings.TrimSpace(value.raw))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("-%s%s: %w", flagNamePrefix, bindingFlagName(value.binding.key), err))
+			continue
+		}
+		if opt != nil {
+			opts = append(opts, opt)
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return opts, nil
+}
+
+// bindingFlagValue records the raw flag text instead of parsing it eagerly so
+// Options can report all invalid values together.
+type bindingFlagValue struct {
+	binding *configBinding
+	raw     string
+	set     bool
+}
+
+func (v *bindingFlagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return v.raw
+}
+
+func (v *bindingFlagValue) Set(raw string) error {
+	v.raw = raw
+	v.set = true
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be passed as bare -flag switches.
+func (v *bindingFlagValue) IsBoolFlag() bool {
+	return v != nil && v.binding != nil && v.binding.boolean
+}
+
+func bindingFlagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+func splitBindingList(value string) []string {
+	fields := strings.Split(value, ",")
+	items := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		items = append(items, field)
+	}
+	return items
+}
+
+func parseBindingInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", value)
+	}
+	return n, nil
+}
+
+// parseChainSelection accepts ChainSelection.String values and their short
+// rightmost/leftmost aliases.
+func parseChainSelection(value string) (ChainSelection, error) {
+	switch normalizeSourceName(strings.TrimSpace(value)) {
+	case RightmostUntrustedIP.String(), "rightmost":
+		return RightmostUntrustedIP, nil
+	case LeftmostUntrustedIP.String(), "leftmost":
+		return LeftmostUntrustedIP, nil
+	default:
+		return 0, fmt.Errorf("invalid chain selection %q", value)
+	}
+}
+
+// bindingMode is an enum whose values are enumerated from zero until valid
+// reports false.
+type bindingMode interface {
+	~uint8
+	String() string
+	valid() bool
+}
+
+// parseBindingMode accepts the String value of any valid M, using name to
+// describe the setting in errors.
+func parseBindingMode[M bindingMode](value, name string) (M, error) {
+	label := normalizeSourceName(strings.TrimSpace(value))
+	for mode := M(0); mode.valid(); mode++ {
+		if label == mode.String() {
+			return mode, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid %s %q", name, value)
+}
+
+// parseChainReconciliation accepts ChainReconciliation.String values.
+func parseChainReconciliation(value string) (ChainReconciliation, error) {
+	return parseBindingMode[ChainReconciliation](value, "chain reconciliation")
+}
+
+// parseOpaqueNodePolicy accepts OpaqueNodePolicy.String values.
+func parseOpaqueNodePolicy(value string) (OpaqueNodePolicy, error) {
+	return parseBindingMode[OpaqueNodePolicy](value, "opaque node policy")
+}
+
+// parseForwardedParsing accepts ForwardedParsing.String values.
+func parseForwardedParsing(value string) (ForwardedParsing, error) {
+	return parseBindingMode[ForwardedParsing](value, "Forwarded parsing mode")
+}
+
+// parseXForwardedForParsing accepts XForwardedForParsing.String values.
+func parseXForwardedForParsing(value string) (XForwardedForParsing, error) {
+	return parseBindingMode[XForwardedForParsing](value, "X-Forwarded-For parsing mode")
+}
+
+// parsePeerTrustMode accepts PeerTrustMode.String values.
+func parsePeerTrustMode(value string) (PeerTrustMode, error) {
+	return parseBindingMode[PeerTrustMode](value, "peer trust mode")
+}
+
+// parsePeerIdentityBinding accepts a comma-separated list of peer identities,
+// building each with identity.
+func parsePeerIdentityBinding(value string, identity func(string) PeerIdentity) (Option, error) {
+	items := splitBindingList(value)
+	identities := make([]PeerIdentity, 0, len(items))
+	for _, item := range items {
+		identities = append(identities, identity(item))
+	}
+	if _, err := newPeerIdentityPolicy(identities, PeerTrustAny); err != nil {
+		return nil, err
+	}
+	return WithTrustedPeerIdentities(identities...), nil
+}
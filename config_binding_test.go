@@ -0,0 +1,393 @@
+package clientip
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func mapLookup(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func TestOptionsFromEnv_BuildsConfig(t *testing.T) {
+	t.Setenv("APP_TRUSTED_PROXIES", "10.0.0.0/8, 127.0.0.1/32")
+	t.Setenv("APP_SOURCES", "X-Forwarded-For,remote_addr")
+	t.Setenv("APP_CHAIN_SELECTION", "leftmost_untrusted")
+	t.Setenv("APP_ALLOW_PRIVATE_IPS", "true")
+	t.Setenv("APP_MAX_CHAIN_LENGTH", "12")
+	t.Setenv("APP_MIN_TRUSTED_PROXIES", "1")
+	t.Setenv("APP_MAX_TRUSTED_PROXIES", "3")
+	t.Setenv("APP_DEBUG_INFO", "1")
+	t.Setenv("APP_REJECTED_CLIENT_PREFIXES", "44.0.0.0/8")
+
+	opts, err := OptionsFromEnv("app")
+	if err != nil {
+		t.Fatalf("OptionsFromEnv() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := snapshotConfig(resolver.extractor.config)
+	want := configSnapshot{
+		TrustedProxyCIDRs:     []string{"10.0.0.0/8", "127.0.0.1/32"},
+		MinTrustedProxies:     1,
+		MaxTrustedProxies:     3,
+		AllowPrivateIPs:       true,
+		AllowReservedPrefixes: []string{},
+		MaxChainLength:        12,
+		ChainSelection:        LeftmostUntrustedIP,
+		DebugMode:             true,
+		SourcePriority:        []string{SourceXForwardedFor.String(), SourceRemoteAddr.String()},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("config mismatch (-want +got):\n%s", diff)
+	}
+	if got := prefixStrings(resolver.Describe().RejectedClientPrefixes); len(got) != 1 || got[0] != "44.0.0.0/8" {
+		t.Fatalf("rejected client prefixes = %v, want [44.0.0.0/8]", got)
+	}
+}
+
+func TestOptionsFromEnv_UnsetAndEmptyKeepDefaults(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_SOURCES":           "  ",
+		"APP_ALLOW_PRIVATE_IPS": "false",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+	if len(opts) != 0 {
+		t.Fatalf("options = %d, want 0", len(opts))
+	}
+}
+
+func TestOptionsFromEnv_ReportsAllErrors(t *testing.T) {
+	_, err := optionsFromLookup("APP_", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":   "10.0.0.0/8,not-a-cidr",
+		"APP_CHAIN_SELECTION":   "middle",
+		"APP_ALLOW_PRIVATE_IPS": "maybe",
+		"APP_MAX_CHAIN_LENGTH":  "ten",
+	}))
+	if err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want joined errors")
+	}
+
+	for _, name := range []string{"APP_TRUSTED_PROXIES", "APP_CHAIN_SELECTION", "APP_ALLOW_PRIVATE_IPS", "APP_MAX_CHAIN_LENGTH"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Fatalf("error %q does not mention %s", err, name)
+		}
+	}
+}
+
+func TestOptionsFromEnv_EmptyPrefixUsesBareNames(t *testing.T) {
+	opts, err := optionsFromLookup("", mapLookup(map[string]string{"MAX_CHAIN_LENGTH": "5"}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.extractor.config.maxChainLength; got != 5 {
+		t.Fatalf("maxChainLength = %d, want 5", got)
+	}
+}
+
+func TestRegisterFlags_BuildsOptions(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := RegisterFlags(fs)
+
+	err := fs.Parse([]string{
+		"-clientip-trusted-proxies", "127.0.0.0/8",
+		"-clientip-sources", "x_real_ip,remote_addr",
+		"-clientip-allow-private-ips",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	opts, err := flags.Options()
+	if err != nil {
+		t.Fatalf("Options() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "127.0.0.1:8080", Header: make(http.Header)}
+	req.Header.Set("X-Real-IP", "192.168.1.10")
+
+	result := resolver.Resolve(req)
+	if result.Err != nil {
+		t.Fatalf("Resolve() error = %v", result.Err)
+	}
+	if got, want := result.IP.String(), "192.168.1.10"; got != want {
+		t.Fatalf("IP = %q, want %q", got, want)
+	}
+}
+
+func TestRegisterFlags_ReportsAllErrors(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	flags := RegisterFlags(fs)
+
+	err := fs.Parse([]string{
+		"-clientip-sources", " , ",
+		"-clientip-min-trusted-proxies", "x",
+		"-clientip-debug-info=nope",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	_, err = flags.Options()
+	if err == nil {
+		t.Fatal("Options() error = nil, want joined errors")
+	}
+
+	var joined interface{ Unwrap() []error }
+	if !errors.As(err, &joined) {
+		t.Fatalf("error %T does not wrap multiple errors", err)
+	}
+	if got := len(joined.Unwrap()); got != 3 {
+		t.Fatalf("joined errors = %d, want 3 (%v)", got, err)
+	}
+}
+
+func TestParseChainSelection(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ChainSelection
+		wantErr bool
+	}{
+		{value: "rightmost_untrusted", want: RightmostUntrustedIP},
+		{value: "Leftmost-Untrusted", want: LeftmostUntrustedIP},
+		{value: "rightmost", want: RightmostUntrustedIP},
+		{value: "first", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseChainSelection(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseChainSelection(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("parseChainSelection(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv_ChainReconciliation(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":      "10.0.0.0/8",
+		"APP_SOURCES":              "forwarded,x_forwarded_for,chain:X-Original-Forwarded-For",
+		"APP_CHAIN_RECONCILIATION": "prefer-x-forwarded-for",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if description.ChainReconciliation != ChainReconcilePreferXForwardedFor {
+		t.Fatalf("ChainReconciliation = %v, want %v", description.ChainReconciliation, ChainReconcilePreferXForwardedFor)
+	}
+	if got := description.Sources[2]; got != ChainHeaderSource("X-Original-Forwarded-For") {
+		t.Fatalf("Sources[2] = %v, want chain header source", got)
+	}
+
+	if _, err := optionsFromLookup("APP", mapLookup(map[string]string{"APP_CHAIN_RECONCILIATION": "merge"})); err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want invalid chain reconciliation")
+	}
+}
+
+func TestOptionsFromEnv_OpaqueNodes(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES": "10.0.0.0/8",
+		"APP_SOURCES":         "forwarded",
+		"APP_OPAQUE_NODES":    "Anonymous",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().OpaqueNodes; got != OpaqueNodeAnonymous {
+		t.Fatalf("OpaqueNodes = %v, want %v", got, OpaqueNodeAnonymous)
+	}
+
+	if _, err := optionsFromLookup("APP", mapLookup(map[string]string{"APP_OPAQUE_NODES": "drop"})); err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want invalid opaque node policy")
+	}
+}
+
+func TestOptionsFromEnv_ForwardedBy(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":          "10.0.0.0/8",
+		"APP_SOURCES":                  "forwarded",
+		"APP_FORWARDED_BY_IDENTIFIERS": "_edge, 10.0.0.9",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if !description.ForwardedByValidation || len(description.ForwardedByIdentifiers) != 2 {
+		t.Fatalf("Describe() forwarded by = %v %v", description.ForwardedByValidation, description.ForwardedByIdentifiers)
+	}
+
+	if _, err := optionsFromLookup("APP", mapLookup(map[string]string{"APP_FORWARDED_BY_IDENTIFIERS": "edge"})); err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want invalid identifier")
+	}
+	opts, err = optionsFromLookup("APP", mapLookup(map[string]string{"APP_FORWARDED_BY_VALIDATION": "true"}))
+	if err != nil || len(opts) != 1 {
+		t.Fatalf("optionsFromLookup() = %d options, %v", len(opts), err)
+	}
+}
+
+func TestOptionsFromEnv_XForwardedForParsing(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":         "10.0.0.0/8",
+		"APP_SOURCES":                 "x_forwarded_for",
+		"APP_X_FORWARDED_FOR_PARSING": "Lenient",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().XForwardedForParsing; got != XForwardedForLenient {
+		t.Fatalf("XForwardedForParsing = %v, want %v", got, XForwardedForLenient)
+	}
+
+	if _, err := optionsFromLookup("APP", mapLookup(map[string]string{"APP_X_FORWARDED_FOR_PARSING": "loose"})); err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want invalid parsing mode")
+	}
+}
+
+func TestOptionsFromEnv_ForwardedParsing(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":   "10.0.0.0/8",
+		"APP_SOURCES":           "forwarded",
+		"APP_FORWARDED_PARSING": "lenient",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().ForwardedParsing; got != ForwardedLenient {
+		t.Fatalf("ForwardedParsing = %v, want %v", got, ForwardedLenient)
+	}
+
+	if _, err := optionsFromLookup("APP", mapLookup(map[string]string{"APP_FORWARDED_PARSING": "standard"})); err == nil {
+		t.Fatal("optionsFromLookup() error = nil, want invalid parsing mode")
+	}
+}
+
+func TestOptionsFromEnv_HeaderHygiene(t *testing.T) {
+	tests := []struct {
+		value        string
+		wantEnabled  bool
+		wantMaxBytes int
+		wantErr      bool
+	}{
+		{value: "true", wantEnabled: true},
+		{value: "false"},
+		{value: "8192", wantEnabled: true, wantMaxBytes: 8192},
+		{value: "-1", wantErr: true},
+		{value: "big", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+				"APP_TRUSTED_PROXIES": "10.0.0.0/8",
+				"APP_SOURCES":         "x_forwarded_for",
+				"APP_HEADER_HYGIENE":  tt.value,
+			}))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("optionsFromLookup() error = nil, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("optionsFromLookup() error = %v", err)
+			}
+
+			resolver, err := New(opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			description := resolver.Describe()
+			if description.HeaderHygiene != tt.wantEnabled || description.MaxHeaderBytes != tt.wantMaxBytes {
+				t.Fatalf("Describe() header hygiene = %v, %d", description.HeaderHygiene, description.MaxHeaderBytes)
+			}
+		})
+	}
+}
+
+func TestOptionsFromEnv_PeerIdentities(t *testing.T) {
+	opts, err := optionsFromLookup("APP", mapLookup(map[string]string{
+		"APP_TRUSTED_PROXIES":        "10.0.0.0/8",
+		"APP_SOURCES":                "x_forwarded_for",
+		"APP_TRUSTED_PEER_URIS":      "spiffe://mesh.example/sa/envoy",
+		"APP_TRUSTED_PEER_DNS_NAMES": "envoy.mesh, gateway.mesh",
+		"APP_PEER_TRUST_MODE":        "All",
+	}))
+	if err != nil {
+		t.Fatalf("optionsFromLookup() error = %v", err)
+	}
+
+	resolver, err := New(opts...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if len(description.TrustedPeerIdentities) != 3 || description.PeerTrustMode != PeerTrustAll {
+		t.Fatalf("Describe() peer identities = %v, %v", description.TrustedPeerIdentities, description.PeerTrustMode)
+	}
+
+	for _, env := range []map[string]string{
+		{"APP_TRUSTED_PEER_URIS": "envoy"},
+		{"APP_PEER_TRUST_MODE": "some"},
+	} {
+		if _, err := optionsFromLookup("APP", mapLookup(env)); err == nil {
+			t.Fatalf("optionsFromLookup(%v) error = nil, want rejection", env)
+		}
+	}
+}
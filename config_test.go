@@ -384,6 +384,36 @@ func TestNew_InvalidBoundsAndDuplicatePriority(t *testing.T) {
 			},
 			wantSources: []Source{HeaderSource("Foo-Bar"), HeaderSource("Foo_Bar")},
 		},
+		{
+			name: "chain header alongside xff",
+			buildConfig: func() options {
+				cfg := defaultOptions()
+				cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+				cfg.Sources = []Source{ChainHeaderSource("X-Original-Forwarded-For"), SourceXForwardedFor}
+				return cfg
+			},
+			wantSources: []Source{ChainHeaderSource("X-Original-Forwarded-For"), SourceXForwardedFor},
+		},
+		{
+			name: "same header as chain and single source",
+			buildConfig: func() options {
+				cfg := defaultOptions()
+				cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+				cfg.Sources = []Source{ChainHeaderSource("True-Client-IP"), HeaderSource("True-Client-IP")}
+				return cfg
+			},
+			wantErrText: "read by more than one source",
+		},
+		{
+			name: "chain header requires trusted proxies for leftmost selection",
+			buildConfig: func() options {
+				cfg := defaultOptions()
+				cfg.ChainSelection = LeftmostUntrustedIP
+				cfg.Sources = []Source{ChainHeaderSource("X-Original-Forwarded-For")}
+				return cfg
+			},
+			wantErrText: "LeftmostUntrustedIP",
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,7 +66,9 @@
 //
 // Resolver walks configured sources in order. Source-unavailable errors allow
 // the next source to run, while malformed headers, proxy-trust failures, chain
-// limits, and implausible client IPs remain terminal.
+// limits, and implausible client IPs remain terminal unless a source opts in to
+// skipping them with WithSourceFailurePolicy or WithUntrustedPeerPolicy.
+// Skipped failures are recorded in Result.SkippedErr.
 //
 // Header-based sources require trusted upstream proxy ranges. Configure them
 // with WithTrustedProxies, optionally using LoopbackProxyPrefixes,
@@ -75,11 +77,14 @@
 // and WithMaxTrustedProxies validate the number of CIDR-trusted hops observed,
 // but do not make a header source trusted on their own.
 //
-// ChainSelection applies to SourceForwarded and SourceXForwardedFor. The
+// ChainSelection applies to SourceForwarded, SourceXForwardedFor, and
+// ChainHeaderSource sources. The
 // default RightmostUntrustedIP selects the nearest untrusted hop before the
 // trailing trusted proxy suffix. LeftmostUntrustedIP selects the earliest
 // untrusted entry and should only be used when trusted proxies are configured
 // and the forwarded chain is produced or sanitized by those proxies.
+// SourceForwarded and SourceXForwardedFor may only be configured together with
+// WithChainReconciliation.
 //
 // Operational fallback is explicit per call and useful for analytics/logging,
 // but it is not suitable for authorization or trust-boundary enforcement.
@@ -102,4 +107,9 @@
 //
 // Operational fallback is visible through Result.FallbackUsed,
 // Result.FallbackReason, and Result.Classify().
+//
+// WithReportOnly is a resolver-wide rollout switch: strict failures are
+// reported in Result.WouldFail and classified as ResultReportOnly while the
+// connecting peer is returned; Result.WouldFailKind and Result.WouldFailSource
+// report what strict resolution would have failed with.
 package clientip
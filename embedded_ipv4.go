@@ -0,0 +1,139 @@
+package clientip
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+var (
+	// nat64WellKnownPrefix is the RFC 6052 well-known NAT64 prefix.
+	nat64WellKnownPrefix = mustParsePrefix("64:ff9b::/96")
+	// sixToFourPrefix is the RFC 3056 6to4 prefix.
+	sixToFourPrefix = mustParsePrefix("2002::/16")
+	// teredoPrefix is the RFC 4380 Teredo prefix.
+	teredoPrefix = mustParsePrefix("2001::/32")
+)
+
+// EmbeddedIPv4Policy selects which IPv6 transition addresses are unwrapped to
+// the IPv4 client address they embed.
+//
+// The zero value unwraps nothing.
+type EmbeddedIPv4Policy struct {
+	// NAT64 unwraps the RFC 6052 well-known prefix 64:ff9b::/96.
+	NAT64 bool
+	// NAT64Prefixes are network-specific NAT64 prefixes. Lengths must be one
+	// of the RFC 6052 lengths: /32, /40, /48, /56, /64, or /96.
+	NAT64Prefixes []netip.Prefix
+	// SixToFour unwraps RFC 3056 6to4 addresses (2002::/16).
+	SixToFour bool
+	// Teredo unwraps the client address of RFC 4380 Teredo addresses
+	// (2001::/32).
+	Teredo bool
+}
+
+// WithEmbeddedIPv4 extracts IPv4 client addresses embedded in NAT64, 6to4,
+// and Teredo IPv6 addresses.
+//
+// This is useful on IPv6-only edges where the real client identity is the
+// embedded IPv4 address. The inner address is validated with the normal
+// client-IP policy and validator and returned in Result.IP; the original
+// address is recorded in Result.WrapperIP. Unwrapping is off by default.
+// Calling it again replaces the previous policy.
+func WithEmbeddedIPv4(policy EmbeddedIPv4Policy) Option {
+	policy.NAT64Prefixes = clonePrefixes(policy.NAT64Prefixes)
+	return optionFunc(func(c *options) { c.EmbeddedIPv4 = policy })
+}
+
+// embeddedIPv4Unwrapper is the normalized EmbeddedIPv4Policy used on hot
+// paths. NAT64 prefixes are ordered longest first so the most specific
+// configured prefix wins.
+type embeddedIPv4Unwrapper struct {
+	nat64     []netip.Prefix
+	sixToFour bool
+	teredo    bool
+}
+
+func newEmbeddedIPv4Unwrapper(policy EmbeddedIPv4Policy) (*embeddedIPv4Unwrapper, error) {
+	normalized, err := normalizePrefixes(policy.NAT64Prefixes, "NAT64 prefix")
+	if err != nil {
+		return nil, err
+	}
+
+	var nat64 []netip.Prefix
+	if policy.NAT64 {
+		nat64 = append(nat64, nat64WellKnownPrefix)
+	}
+	for _, prefix := range normalized {
+		if !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+			return nil, fmt.Errorf("NAT64 prefix %s must be IPv6", prefix)
+		}
+		switch prefix.Bits() {
+		case 32, 40, 48, 56, 64, 96:
+		default:
+			return nil, fmt.Errorf("NAT64 prefix %s must be /32, /40, /48, /56, /64, or /96", prefix)
+		}
+	}
+	nat64 = mergeUniquePrefixes(nat64, normalized...)
+	slices.SortStableFunc(nat64, func(a, b netip.Prefix) int { return b.Bits() - a.Bits() })
+
+	if len(nat64) == 0 && !policy.SixToFour && !policy.Teredo {
+		return nil, nil
+	}
+	return &embeddedIPv4Unwrapper{nat64: nat64, sixToFour: policy.SixToFour, teredo: policy.Teredo}, nil
+}
+
+// unwrap returns the embedded IPv4 address and the original wrapper address.
+// When ip is not a configured transition address it returns ip unchanged and
+// a zero wrapper.
+func (u *embeddedIPv4Unwrapper) unwrap(ip netip.Addr) (inner, wrapper netip.Addr) {
+	if u == nil || !ip.Is6() || ip.Is4In6() {
+		return ip, netip.Addr{}
+	}
+
+	bytes := ip.As16()
+	for _, prefix := range u.nat64 {
+		if prefix.Contains(ip) {
+			return nat64EmbeddedIPv4(bytes, prefix.Bits()), ip
+		}
+	}
+	if u.sixToFour && sixToFourPrefix.Contains(ip) {
+		return netip.AddrFrom4([4]byte{bytes[2], bytes[3], bytes[4], bytes[5]}), ip
+	}
+	if u.teredo && teredoPrefix.Contains(ip) {
+		// The Teredo client address is stored bit-inverted in the last 32 bits.
+		return netip.AddrFrom4([4]byte{^bytes[12], ^bytes[13], ^bytes[14], ^bytes[15]}), ip
+	}
+	return ip, netip.Addr{}
+}
+
+// nat64EmbeddedIPv4 extracts the IPv4 address from an RFC 6052 address with a
+// prefix of the given length, skipping the reserved "u" octet (bits 64-71).
+func nat64EmbeddedIPv4(bytes [16]byte, prefixBits int) netip.Addr {
+	var v4 [4]byte
+	n := 0
+	for i := prefixBits / 8; n < len(v4); i++ {
+		if i == 8 {
+			continue
+		}
+		v4[n] = bytes[i]
+		n++
+	}
+	return netip.AddrFrom4(v4)
+}
+
+func (u *embeddedIPv4Unwrapper) describe() EmbeddedIPv4Policy {
+	if u == nil {
+		return EmbeddedIPv4Policy{}
+	}
+
+	policy := EmbeddedIPv4Policy{SixToFour: u.sixToFour, Teredo: u.teredo}
+	for _, prefix := range u.nat64 {
+		if prefix == nat64WellKnownPrefix {
+			policy.NAT64 = true
+			continue
+		}
+		policy.NAT64Prefixes = append(policy.NAT64Prefixes, prefix)
+	}
+	return policy
+}
@@ -0,0 +1,180 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestEmbeddedIPv4UnwrapperRFC6052Prefixes(t *testing.T) {
+	// Examples from RFC 6052 section 2.4, all embedding 192.0.2.33.
+	tests := []struct {
+		prefix string
+		addr   string
+	}{
+		{prefix: "2001:db8::/32", addr: "2001:db8:c000:221::"},
+		{prefix: "2001:db8:100::/40", addr: "2001:db8:1c0:2:21::"},
+		{prefix: "2001:db8:122::/48", addr: "2001:db8:122:c000:2:2100::"},
+		{prefix: "2001:db8:122:300::/56", addr: "2001:db8:122:3c0:0:221::"},
+		{prefix: "2001:db8:122:344::/64", addr: "2001:db8:122:344:c0:2:2100:0"},
+		{prefix: "2001:db8:122:344::/96", addr: "2001:db8:122:344::192.0.2.33"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			u, err := newEmbeddedIPv4Unwrapper(EmbeddedIPv4Policy{NAT64Prefixes: []netip.Prefix{netip.MustParsePrefix(tt.prefix)}})
+			if err != nil {
+				t.Fatalf("newEmbeddedIPv4Unwrapper() error = %v", err)
+			}
+
+			wrapper := netip.MustParseAddr(tt.addr)
+			inner, gotWrapper := u.unwrap(wrapper)
+			if want := netip.MustParseAddr("192.0.2.33"); inner != want {
+				t.Fatalf("unwrap(%s) = %v, want %v", tt.addr, inner, want)
+			}
+			if gotWrapper != wrapper {
+				t.Fatalf("wrapper = %v, want %v", gotWrapper, wrapper)
+			}
+		})
+	}
+}
+
+func TestEmbeddedIPv4UnwrapperTransitionPrefixes(t *testing.T) {
+	u, err := newEmbeddedIPv4Unwrapper(EmbeddedIPv4Policy{NAT64: true, SixToFour: true, Teredo: true})
+	if err != nil {
+		t.Fatalf("newEmbeddedIPv4Unwrapper() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		addr      string
+		wantInner string
+		unwrapped bool
+	}{
+		{name: "well-known NAT64", addr: "64:ff9b::808:808", wantInner: "8.8.8.8", unwrapped: true},
+		{name: "6to4", addr: "2002:808:404::1", wantInner: "8.8.4.4", unwrapped: true},
+		{name: "Teredo RFC 4380 example", addr: "2001:0:4136:e378:8000:63bf:3fff:fdd2", wantInner: "192.0.2.45", unwrapped: true},
+		{name: "native IPv6", addr: "2606:4700::1", wantInner: "2606:4700::1"},
+		{name: "IPv4", addr: "1.1.1.1", wantInner: "1.1.1.1"},
+		{name: "local-use NAT64 not configured", addr: "64:ff9b:1::808:808", wantInner: "64:ff9b:1::808:808"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := netip.MustParseAddr(tt.addr)
+			inner, wrapper := u.unwrap(addr)
+			if inner != netip.MustParseAddr(tt.wantInner) {
+				t.Fatalf("unwrap(%s) = %v, want %s", tt.addr, inner, tt.wantInner)
+			}
+			if wrapper.IsValid() != tt.unwrapped {
+				t.Fatalf("wrapper = %v, want unwrapped=%v", wrapper, tt.unwrapped)
+			}
+		})
+	}
+
+	var disabled *embeddedIPv4Unwrapper
+	addr := netip.MustParseAddr("64:ff9b::808:808")
+	if inner, wrapper := disabled.unwrap(addr); inner != addr || wrapper.IsValid() {
+		t.Fatalf("nil unwrap = %v, %v; want input unchanged", inner, wrapper)
+	}
+}
+
+func TestEmbeddedIPv4UnwrapperValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix netip.Prefix
+	}{
+		{name: "invalid prefix", prefix: netip.Prefix{}},
+		{name: "IPv4 prefix", prefix: netip.MustParsePrefix("10.0.0.0/8")},
+		{name: "unsupported length", prefix: netip.MustParsePrefix("2001:db8::/44")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(WithEmbeddedIPv4(EmbeddedIPv4Policy{NAT64Prefixes: []netip.Prefix{tt.prefix}})); err == nil {
+				t.Fatal("New() error = nil, want error")
+			}
+		})
+	}
+
+	if u, err := newEmbeddedIPv4Unwrapper(EmbeddedIPv4Policy{}); err != nil || u != nil {
+		t.Fatalf("zero policy = %v, %v; want nil unwrapper", u, err)
+	}
+}
+
+func TestExtract_EmbeddedIPv4(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXForwardedFor, SourceRemoteAddr}
+	WithEmbeddedIPv4(EmbeddedIPv4Policy{NAT64: true}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantIP     string
+		wantSource Source
+		wantErr    error
+	}{
+		{name: "xff NAT64", remoteAddr: "127.0.0.1:8080", xff: "64:ff9b::808:808", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "remote addr NAT64", remoteAddr: "[64:ff9b::101:101]:443", wantIP: "1.1.1.1", wantSource: SourceRemoteAddr},
+		{name: "inner private address rejected", remoteAddr: "127.0.0.1:8080", xff: "64:ff9b::a00:1", wantErr: ErrPrivateIP},
+		{name: "6to4 not enabled", remoteAddr: "127.0.0.1:8080", xff: "2002:808:808::1", wantIP: "2002:808:808::1", wantSource: SourceXForwardedFor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(tt.remoteAddr, "")
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			result, err := extractor.Extract(req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v, want nil", err)
+			}
+			if result.IP != netip.MustParseAddr(tt.wantIP) || result.Source != tt.wantSource {
+				t.Fatalf("result = %v from %v, want %s from %v", result.IP, result.Source, tt.wantIP, tt.wantSource)
+			}
+			if wantWrapped := tt.wantIP != tt.xff; result.WrapperIP.IsValid() != wantWrapped {
+				t.Fatalf("WrapperIP = %v, want wrapped=%v", result.WrapperIP, wantWrapped)
+			}
+		})
+	}
+
+	// Without the option the well-known NAT64 prefix stays reserved.
+	cfg = defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXForwardedFor}
+	req := newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Forwarded-For", "64:ff9b::808:808")
+	if _, err := mustNewExtractor(t, cfg).Extract(req); !errors.Is(err, ErrReservedIP) {
+		t.Fatalf("default error = %v, want ErrReservedIP", err)
+	}
+}
+
+func TestResolverDescribe_EmbeddedIPv4(t *testing.T) {
+	resolver, err := New(WithEmbeddedIPv4(EmbeddedIPv4Policy{
+		NAT64:         true,
+		NAT64Prefixes: []netip.Prefix{netip.MustParsePrefix("2001:db8:1::1/48")},
+		Teredo:        true,
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := resolver.Describe().EmbeddedIPv4
+	if !got.NAT64 || !got.Teredo || got.SixToFour {
+		t.Fatalf("EmbeddedIPv4 = %+v, want NAT64 and Teredo", got)
+	}
+	if len(got.NAT64Prefixes) != 1 || got.NAT64Prefixes[0] != netip.MustParsePrefix("2001:db8:1::/48") {
+		t.Fatalf("NAT64Prefixes = %v, want [2001:db8:1::/48]", got.NAT64Prefixes)
+	}
+}
@@ -17,12 +17,21 @@ type extractor struct {
 }
 
 type configuredSource struct {
-	source         Source
-	name           string
-	unavailableErr *ExtractionError
-	chain          chainExtractor
-	single         singleHeaderExtractor
-	remote         remoteAddrExtractor
+	source              Source
+	name                string
+	unavailableErr      *ExtractionError
+	ignoreUntrustedPeer bool
+	skippableFailures   resultKindSet
+	chain               chainExtractor
+	single              singleHeaderExtractor
+	remote              remoteAddrExtractor
+	custom              customExtractor
+	consistency         []consistencyCheck
+	// condition gates the source on request attributes; nil always runs.
+	condition *sourceCondition
+	// chainPartner is the index of the other chain header source when
+	// WithChainReconciliation is enabled, or -1.
+	chainPartner int
 }
 
 // newExtractor creates an extractor from a options.
@@ -38,29 +47,31 @@ func newExtractor(public options) (*extractor, error) {
 
 	extractor := &extractor{config: cfg}
 	extractor.sources = extractor.buildConfiguredSources(cfg.sourcePriority)
+	extractor.buildConsistencyChecks()
+	extractor.buildChainPartners()
 
 	return extractor, nil
 }
 
 // Extract resolves client IP and metadata for the request.
 //
-// Configured sources are attempted in order. ErrSourceUnavailable allows the
-// next source to run; malformed headers, proxy-trust failures, chain limits,
-// invalid client IPs, and context errors are terminal.
+// Configured sources are attempted in order. The next source runs when a
+// source returns ErrSourceUnavailable, when its SourceCondition does not
+// match, when UntrustedPeerIgnore skips it for an untrusted peer, or when
+// its failure kind is skippable under WithSourceFailurePolicy. Skipped
+// failures are joined into Result.SkippedErr. Other malformed headers,
+// proxy-trust failures, chain limits, invalid client IPs, and context errors
+// are terminal.
 func (e *extractor) Extract(r *http.Request) (Extraction, error) {
 	if r == nil {
 		return Extraction{}, ErrNilRequest
 	}
 
-	// sourceHeaderKeys is empty only when the configured sources contain no
-	// header-based source. Validation guarantees at least one configured
-	// source, so reaching this branch means the only configured source is
-	// SourceRemoteAddr.
-	if len(e.config.sourceHeaderKeys) == 0 {
+	if e.config.remoteAddrOnly {
 		if ctx := r.Context(); ctx.Err() != nil {
 			return Extraction{}, ctx.Err()
 		}
-		return e.extractFromRemoteAddr(r.RemoteAddr)
+		return e.extractFromRemoteAddr(requestViewFromRequest(r))
 	}
 
 	return e.extractRequestView(requestViewFromRequest(r))
@@ -69,17 +80,16 @@ func (e *extractor) Extract(r *http.Request) (Extraction, error) {
 // ExtractInput resolves client IP and metadata from framework-agnostic request
 // input.
 //
-// It follows the same source ordering and terminal-error rules as Extract.
+// It follows the same source ordering, fall-through, and terminal-error rules
+// as Extract.
 func (e *extractor) ExtractInput(input Input) (Extraction, error) {
 	ctx := requestInputContext(input)
 	if err := ctx.Err(); err != nil {
 		return Extraction{}, err
 	}
 
-	// See Extract: an empty sourceHeaderKeys means SourceRemoteAddr is the
-	// only configured source.
-	if len(e.config.sourceHeaderKeys) == 0 {
-		return e.extractFromRemoteAddr(input.RemoteAddr)
+	if e.config.remoteAddrOnly {
+		return e.extractFromRemoteAddr(requestViewFromInput(input))
 	}
 
 	return e.extractRequestView(requestViewFromInput(input))
@@ -90,6 +100,10 @@ func (e *extractor) extractRequestView(r requestView) (Extraction, error) {
 		return Extraction{}, err
 	}
 
+	var (
+		spoofIgnored bool
+		skipped      []error
+	)
 	for i := range e.sources {
 		source := &e.sources[i]
 		if i > 0 {
@@ -98,42 +112,29 @@ func (e *extractor) extractRequestView(r requestView) (Extraction, error) {
 			}
 		}
 
-		var (
-			result Extraction
-			err    error
-		)
-
-		switch source.source.kind {
-		case sourceForwarded:
-			result, err = e.extractChainSource(
-				r,
-				source,
-				"Forwarded chain exceeds configured maximum length",
-				"request received from untrusted proxy while Forwarded is present",
-				func(err error) {
-					if !errors.Is(err, ErrInvalidForwardedHeader) {
-						return
-					}
-					e.logSecurityWarning(r, source.source, SecurityEventMalformedForwarded, "malformed Forwarded header received", "parse_error", err.Error())
-				},
-			)
-		case sourceXForwardedFor:
-			result, err = e.extractChainSource(
-				r,
-				source,
-				"X-Forwarded-For chain exceeds configured maximum length",
-				"request received from untrusted proxy while X-Forwarded-For is present",
-				nil,
-			)
-		case sourceRemoteAddr:
-			result, err = e.extractRemoteAddrSource(r, source)
-		default:
-			result, err = e.extractSingleHeaderSource(r, source)
+		result, err := e.extractSource(r, source)
+		if source.chainPartner >= 0 && !errors.Is(err, ErrSourceUnavailable) {
+			result, err = e.reconcileChains(r, source, result, err)
+		}
+		if err == nil && len(source.consistency) > 0 {
+			result, err = e.checkConsistency(r, source, result)
 		}
 		if err == nil {
+			result.SpoofAttemptIgnored = spoofIgnored
+			result.SkippedErr = errors.Join(skipped...)
 			return result, nil
 		}
 
+		if skip, ignored := source.skipFailure(err); skip {
+			// Security events were already logged while adapting the
+			// failure; only the terminal decision changes here.
+			spoofIgnored = spoofIgnored || ignored
+			skipped = append(skipped, err)
+			result, err = Extraction{}, source.unavailableErr
+		}
+		result.SpoofAttemptIgnored = spoofIgnored
+		result.SkippedErr = errors.Join(skipped...)
+
 		if !errors.Is(err, ErrSourceUnavailable) {
 			if !result.Source.valid() {
 				result.Source = source.source
@@ -149,14 +150,60 @@ func (e *extractor) extractRequestView(r requestView) (Extraction, error) {
 		}
 	}
 
-	return Extraction{}, ErrSourceUnavailable
+	return Extraction{SpoofAttemptIgnored: spoofIgnored, SkippedErr: errors.Join(skipped...)}, ErrSourceUnavailable
 }
 
-func (e *extractor) extractFromRemoteAddr(remoteAddr string) (Extraction, error) {
+// extractSource runs one configured source and adapts its failures to the
+// public error surface.
+func (e *extractor) extractSource(r requestView, source *configuredSource) (Extraction, error) {
+	if !source.condition.matches(r) {
+		return Extraction{}, source.unavailableErr
+	}
+
+	switch source.source.kind {
+	case sourceForwarded:
+		return e.extractChainSource(
+			r,
+			source,
+			"Forwarded chain exceeds configured maximum length",
+			"request received from untrusted proxy while Forwarded is present",
+			func(err error) {
+				if !errors.Is(err, ErrInvalidForwardedHeader) {
+					return
+				}
+				e.logSecurityWarning(r, source.source, SecurityEventMalformedForwarded, "malformed Forwarded header received", "parse_error", err.Error())
+			},
+		)
+	case sourceXForwardedFor:
+		return e.extractChainSource(
+			r,
+			source,
+			"X-Forwarded-For chain exceeds configured maximum length",
+			"request received from untrusted proxy while X-Forwarded-For is present",
+			e.logMalformedXFF(r, source.source, "malformed X-Forwarded-For header received"),
+		)
+	case sourceChainHeader:
+		return e.extractChainSource(
+			r,
+			source,
+			"chain header exceeds configured maximum length",
+			"request received from untrusted proxy while chain header is present",
+			e.logMalformedXFF(r, source.source, "malformed chain header received"),
+		)
+	case sourceRemoteAddr:
+		return e.extractRemoteAddrSource(r, source)
+	case sourceCustom:
+		return e.extractCustomSource(r, source)
+	default:
+		return e.extractSingleHeaderSource(r, source)
+	}
+}
+
+func (e *extractor) extractFromRemoteAddr(r requestView) (Extraction, error) {
 	source := builtinSource(sourceRemoteAddr)
-	result, failure := remoteAddrExtractor{clientIPPolicy: e.config.clientIP}.extract(remoteAddr, source)
+	result, failure := remoteAddrExtractor{clientIPPolicy: e.config.clientIPPolicyFor(source)}.extract(r.context(), r.remoteAddr(), source)
 	if failure != nil {
-		err := adaptRemoteAddrFailure(failure, source)
+		err := e.adaptRemoteAddrFailure(r, source, failure)
 		result.Source = source
 		return result, err
 	}
@@ -164,6 +211,21 @@ func (e *extractor) extractFromRemoteAddr(remoteAddr string) (Extraction, error)
 	return result, nil
 }
 
+// forwardedTolerantParser returns the ForwardedLenient parser for source, or
+// nil in strict mode.
+func (e *extractor) forwardedTolerantParser(source Source) func([]string) ([]string, []error, error) {
+	if e.config.forwardedParsing != ForwardedLenient {
+		return nil
+	}
+	return func(values []string) ([]string, []error, error) {
+		parts, defects, err := parseForwardedValuesLenient(values, e.config.maxChainLength)
+		if err != nil {
+			return nil, nil, adaptForwardedParseError(err, source, e)
+		}
+		return parts, defects, nil
+	}
+}
+
 func (e *extractor) buildConfiguredSources(sources []Source) []configuredSource {
 	configured := make([]configuredSource, len(sources))
 	for i, source := range sources {
@@ -174,9 +236,13 @@ func (e *extractor) buildConfiguredSources(sources []Source) []configuredSource
 		}
 
 		configuredSource := configuredSource{
-			source:         source,
-			name:           source.String(),
-			unavailableErr: &ExtractionError{Err: ErrSourceUnavailable, Source: source},
+			source:              source,
+			name:                source.String(),
+			unavailableErr:      &ExtractionError{Err: ErrSourceUnavailable, Source: source},
+			ignoreUntrustedPeer: e.config.untrustedPeerPolicies[source] == UntrustedPeerIgnore,
+			skippableFailures:   newResultKindSet(e.config.sourceFailurePolicies[source]),
+			condition:           e.config.conditionFor(source),
+			chainPartner:        -1,
 		}
 
 		switch source.kind {
@@ -190,37 +256,48 @@ func (e *extractor) buildConfiguredSources(sources []Source) []configuredSource
 					}
 					return parts, nil
 				},
+				parseTolerant:     e.forwardedTolerantParser(source),
 				parseClientIP:     parseChainIP,
-				clientIP:          e.config.clientIP,
+				clientIP:          e.config.clientIPPolicyFor(source),
 				trustedProxy:      e.config.proxy,
 				selection:         e.config.chainSelection,
-				collectDebugInfo:  e.config.debugMode,
+				collectDebugInfo:  e.config.debugMode || e.config.chainReconciliation != ChainReconcileOff,
 				untrustedChainSep: ", ",
+				hygiene:           e.config.headerHygiene,
+				forwardedBy:       e.config.forwardedBy,
 			}}
-		case sourceXForwardedFor:
+		case sourceXForwardedFor, sourceChainHeader:
+			parseXFF := xffParser(e.config.xffParsing)
 			configuredSource.chain = chainExtractor{policy: chainPolicy{
 				headerName: headerName,
 				parseValues: func(values []string) ([]string, error) {
-					parts, err := parseXFFValues(values, e.config.maxChainLength)
+					parts, err := parseXFF(values, e.config.maxChainLength)
 					if err != nil {
 						return nil, adaptXFFParseError(err, source, e)
 					}
 					return parts, nil
 				},
 				parseClientIP:     parseIP,
-				clientIP:          e.config.clientIP,
+				clientIP:          e.config.clientIPPolicyFor(source),
 				trustedProxy:      e.config.proxy,
 				selection:         e.config.chainSelection,
-				collectDebugInfo:  e.config.debugMode,
+				collectDebugInfo:  e.config.debugMode || e.config.chainReconciliation != ChainReconcileOff,
 				untrustedChainSep: ", ",
+				hygiene:           e.config.headerHygiene,
 			}}
 		case sourceRemoteAddr:
-			configuredSource.remote = remoteAddrExtractor{clientIPPolicy: e.config.clientIP}
+			configuredSource.remote = remoteAddrExtractor{clientIPPolicy: e.config.clientIPPolicyFor(source)}
+		case sourceCustom:
+			configuredSource.custom = customExtractor{
+				clientIP:     e.config.clientIPPolicyFor(source),
+				trustedProxy: e.config.proxy,
+			}
 		default:
 			configuredSource.single = singleHeaderExtractor{policy: singleHeaderPolicy{
 				headerName:   headerName,
-				clientIP:     e.config.clientIP,
+				clientIP:     e.config.clientIPPolicyFor(source),
 				trustedProxy: e.config.proxy,
+				hygiene:      e.config.headerHygiene,
 			}}
 		}
 
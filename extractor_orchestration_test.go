@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/netip"
 	"net/textproto"
 	"testing"
 )
@@ -88,3 +89,478 @@ func TestExtractInput_ContextCanceledBeforeFallbackSource(t *testing.T) {
 		t.Fatalf("requested headers = %v, want [%q]", requestedHeaders, cfHeader)
 	}
 }
+
+func TestExtract_UntrustedPeerIgnoreFallsThrough(t *testing.T) {
+	logger := &capturedLogger{}
+
+	cfg := defaultOptions()
+	cfg.Logger = logger
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXForwardedFor, SourceXRealIP, SourceRemoteAddr}
+	WithUntrustedPeerPolicy(HeaderSource("X-Forwarded-For"), UntrustedPeerIgnore).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("8.8.4.4:443", "/ignore")
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+
+	result, err := extractor.Extract(req)
+	if err != nil {
+		t.Fatalf("error = %v, want nil", err)
+	}
+	if got, want := extractionStateOf(result), (extractionState{HasIP: true, IP: "8.8.4.4", Source: SourceRemoteAddr}); got != want {
+		t.Fatalf("extraction = %+v, want %+v", got, want)
+	}
+	if !result.SpoofAttemptIgnored {
+		t.Fatal("SpoofAttemptIgnored = false, want true")
+	}
+
+	entries := logger.snapshot()
+	if len(entries) != 1 {
+		t.Fatalf("logged entries = %d, want 1", len(entries))
+	}
+	assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventUntrustedProxy, SourceXForwardedFor, "/ignore", "8.8.4.4:443")
+
+	// A reject-policy source later in the list still fails closed.
+	req.Header.Set("X-Real-IP", "2.2.2.2")
+	result, err = extractor.Extract(req)
+	if !errors.Is(err, ErrUntrustedProxy) {
+		t.Fatalf("error = %v, want ErrUntrustedProxy", err)
+	}
+	if result.Source != SourceXRealIP || !result.SpoofAttemptIgnored {
+		t.Fatalf("result = %+v, want X-Real-IP failure with SpoofAttemptIgnored", result)
+	}
+}
+
+func TestExtract_UntrustedPeerIgnoreOnLastSourceIsUnavailable(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXRealIP}
+	WithUntrustedPeerPolicy(SourceXRealIP, UntrustedPeerIgnore).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("8.8.4.4:443", "")
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+
+	result, err := extractor.Extract(req)
+	if !errors.Is(err, ErrSourceUnavailable) {
+		t.Fatalf("error = %v, want ErrSourceUnavailable", err)
+	}
+	if result.Source != SourceXRealIP || !result.SpoofAttemptIgnored {
+		t.Fatalf("result = %+v, want X-Real-IP unavailable with SpoofAttemptIgnored", result)
+	}
+}
+
+func TestNew_UntrustedPeerPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "source not configured",
+			opts: []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(SourceXForwardedFor), WithUntrustedPeerPolicy(SourceXRealIP, UntrustedPeerIgnore)},
+		},
+		{
+			name: "remote addr source",
+			opts: []Option{WithUntrustedPeerPolicy(SourceRemoteAddr, UntrustedPeerIgnore)},
+		},
+		{
+			name: "unknown policy",
+			opts: []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(SourceXRealIP), WithUntrustedPeerPolicy(SourceXRealIP, UntrustedPeerPolicy(9))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts...); err == nil {
+				t.Fatal("New() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestExtract_SourceFailurePolicySkipsDeclaredKinds(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{HeaderSource("X-Client-IP"), SourceXForwardedFor, SourceRemoteAddr}
+	WithSourceFailurePolicy(HeaderSource("x-client-ip"), ResultInvalid, ResultMalformed).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name        string
+		clientIP    []string
+		xff         string
+		want        extractionState
+		wantErr     error
+		wantSkipped error
+	}{
+		{
+			name:        "invalid ip skipped",
+			clientIP:    []string{"not-an-ip"},
+			xff:         "8.8.8.8",
+			want:        extractionState{HasIP: true, IP: "8.8.8.8", Source: SourceXForwardedFor},
+			wantSkipped: ErrInvalidIP,
+		},
+		{
+			name:        "duplicate headers skipped",
+			clientIP:    []string{"1.1.1.1", "2.2.2.2"},
+			xff:         "8.8.8.8",
+			want:        extractionState{HasIP: true, IP: "8.8.8.8", Source: SourceXForwardedFor},
+			wantSkipped: ErrMultipleSingleIPHeaders,
+		},
+		{
+			name:     "xff stays fail-closed",
+			clientIP: []string{"not-an-ip"},
+			xff:      "10.0.0.1",
+			want:     extractionState{Source: SourceXForwardedFor},
+			wantErr:  ErrInvalidIP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest("127.0.0.1:8080", "")
+			req.Header["X-Client-Ip"] = tt.clientIP
+			req.Header.Set("X-Forwarded-For", tt.xff)
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := extractionStateOf(result); got != tt.want {
+				t.Fatalf("extraction = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantSkipped != nil && !errors.Is(result.SkippedErr, tt.wantSkipped) {
+				t.Fatalf("SkippedErr = %v, want %v", result.SkippedErr, tt.wantSkipped)
+			}
+
+			var skippedSource interface{ SourceValue() Source }
+			if !errors.As(result.SkippedErr, &skippedSource) || skippedSource.SourceValue() != HeaderSource("X-Client-IP") {
+				t.Fatalf("SkippedErr = %v, want error from X-Client-IP", result.SkippedErr)
+			}
+		})
+	}
+}
+
+func TestExtract_SourceFailurePolicyLeavesUndeclaredKindsTerminal(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{HeaderSource("X-Client-IP"), SourceRemoteAddr}
+	WithSourceFailurePolicy(HeaderSource("X-Client-IP"), ResultMalformed).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Client-IP", "10.0.0.1")
+
+	result, err := extractor.Extract(req)
+	if !errors.Is(err, ErrInvalidIP) {
+		t.Fatalf("error = %v, want ErrInvalidIP", err)
+	}
+	if result.SkippedErr != nil {
+		t.Fatalf("SkippedErr = %v, want nil", result.SkippedErr)
+	}
+}
+
+func TestNew_SourceFailurePolicyValidation(t *testing.T) {
+	base := []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(SourceXRealIP, SourceRemoteAddr)}
+
+	tests := []struct {
+		name    string
+		opt     Option
+		wantErr bool
+	}{
+		{name: "allowed kinds", opt: WithSourceFailurePolicy(SourceXRealIP, ResultInvalid, ResultMalformed, ResultUntrusted)},
+		{name: "remote addr invalid", opt: WithSourceFailurePolicy(SourceRemoteAddr, ResultInvalid)},
+		{name: "canceled not skippable", opt: WithSourceFailurePolicy(SourceXRealIP, ResultCanceled), wantErr: true},
+		{name: "unknown not skippable", opt: WithSourceFailurePolicy(SourceXRealIP, ResultUnknown), wantErr: true},
+		{name: "source not configured", opt: WithSourceFailurePolicy(SourceForwarded, ResultMalformed), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(append(base, tt.opt)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtract_SourceClientIPPolicyScopesExceptions(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{HeaderSource("X-Internal-Client-IP"), SourceXForwardedFor, SourceRemoteAddr}
+	WithSourceClientIPPolicy(HeaderSource("x-internal-client-ip"), ClientIPPolicy{Name: "internal-mesh", AllowPrivateIPs: true}).applyOption(&cfg)
+	WithSourceClientIPPolicy(SourceRemoteAddr, ClientIPPolicy{}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Internal-Client-IP", "10.1.2.3")
+	result, err := extractor.Extract(req)
+	if err != nil {
+		t.Fatalf("internal header error = %v, want nil", err)
+	}
+	if got, want := extractionStateOf(result), (extractionState{HasIP: true, IP: "10.1.2.3", Source: HeaderSource("X-Internal-Client-IP")}); got != want {
+		t.Fatalf("extraction = %+v, want %+v", got, want)
+	}
+
+	req = newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Forwarded-For", "10.1.2.3")
+	_, err = extractor.Extract(req)
+	var invalidIP *InvalidIPError
+	if !errors.As(err, &invalidIP) {
+		t.Fatalf("X-Forwarded-For error = %v, want InvalidIPError", err)
+	}
+	if invalidIP.Policy != "" {
+		t.Fatalf("InvalidIPError.Policy = %q, want empty for the resolver-wide policy", invalidIP.Policy)
+	}
+
+	_, err = extractor.Extract(newTestRequest("127.0.0.1:8080", ""))
+	var remoteErr *RemoteAddrError
+	if !errors.As(err, &remoteErr) {
+		t.Fatalf("RemoteAddr error = %v, want RemoteAddrError", err)
+	}
+	if remoteErr.Policy != "source:remote_addr" {
+		t.Fatalf("RemoteAddrError.Policy = %q, want %q", remoteErr.Policy, "source:remote_addr")
+	}
+
+	req = newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Internal-Client-IP", "garbage")
+	_, err = extractor.Extract(req)
+	if !errors.As(err, &invalidIP) || invalidIP.Policy != "" {
+		t.Fatalf("unparsable header error = %v, want InvalidIPError without policy", err)
+	}
+	if want := `x_internal_client_ip: invalid or implausible IP address (ip="garbage")`; err.Error() != want {
+		t.Fatalf("unparsable header error = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestExtract_SourceClientIPPolicyIgnoresResolverWideExceptions(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.AllowPrivateIPs = true
+	cfg.Sources = []Source{SourceXRealIP}
+	WithSourceClientIPPolicy(SourceXRealIP, ClientIPPolicy{Name: "public-only"}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Real-IP", "192.168.1.10")
+
+	_, err := extractor.Extract(req)
+	var invalidIP *InvalidIPError
+	if !errors.As(err, &invalidIP) || invalidIP.Policy != "public-only" {
+		t.Fatalf("error = %v, want InvalidIPError from public-only policy", err)
+	}
+}
+
+func TestNew_SourceClientIPPolicyValidation(t *testing.T) {
+	base := []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(SourceXRealIP, SourceRemoteAddr)}
+
+	tests := []struct {
+		name    string
+		opt     Option
+		wantErr bool
+	}{
+		{name: "configured source", opt: WithSourceClientIPPolicy(SourceXRealIP, ClientIPPolicy{AllowPrivateIPs: true})},
+		{name: "reserved prefix", opt: WithSourceClientIPPolicy(SourceRemoteAddr, ClientIPPolicy{AllowedReservedClientPrefixes: mustParseCIDRs(t, "100.64.0.0/10")})},
+		{name: "invalid prefix", opt: WithSourceClientIPPolicy(SourceRemoteAddr, ClientIPPolicy{AllowedReservedClientPrefixes: []netip.Prefix{{}}}), wantErr: true},
+		{name: "source not configured", opt: WithSourceClientIPPolicy(SourceForwarded, ClientIPPolicy{}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(append(base, tt.opt)...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExtract_ClientIPValidatorRunsInEverySource(t *testing.T) {
+	rejection := errors.New("known scanner range")
+	scanners := mustParseCIDRs(t, "45.33.32.0/24")[0]
+	validator := func(_ context.Context, ip netip.Addr, _ Source) error {
+		if scanners.Contains(ip) {
+			return rejection
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name       string
+		sources    []Source
+		remoteAddr string
+		headers    map[string]string
+		policy     string
+		wantSource Source
+	}{
+		{name: "x-forwarded-for", sources: []Source{SourceXForwardedFor}, remoteAddr: "127.0.0.1:8080", headers: map[string]string{"X-Forwarded-For": "45.33.32.7"}, wantSource: SourceXForwardedFor},
+		{name: "per-source policy", sources: []Source{SourceXForwardedFor}, remoteAddr: "127.0.0.1:8080", headers: map[string]string{"X-Forwarded-For": "45.33.32.7"}, policy: "edge", wantSource: SourceXForwardedFor},
+		{name: "forwarded", sources: []Source{SourceForwarded}, remoteAddr: "127.0.0.1:8080", headers: map[string]string{"Forwarded": "for=45.33.32.7"}, wantSource: SourceForwarded},
+		{name: "single header", sources: []Source{SourceXRealIP}, remoteAddr: "127.0.0.1:8080", headers: map[string]string{"X-Real-IP": "45.33.32.7"}, wantSource: SourceXRealIP},
+		{name: "remote addr only", sources: []Source{SourceRemoteAddr}, remoteAddr: "45.33.32.7:443", wantSource: SourceRemoteAddr},
+		{name: "remote addr after header", sources: []Source{SourceXRealIP, SourceRemoteAddr}, remoteAddr: "45.33.32.7:443", wantSource: SourceRemoteAddr},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+			cfg.Sources = tt.sources
+			WithClientIPValidator(validator).applyOption(&cfg)
+			if tt.policy != "" {
+				WithSourceClientIPPolicy(tt.wantSource, ClientIPPolicy{Name: tt.policy}).applyOption(&cfg)
+			}
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest(tt.remoteAddr, "/validate")
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, ErrInvalidIP) || !errors.Is(err, rejection) {
+				t.Fatalf("error = %v, want ErrInvalidIP wrapping validator error", err)
+			}
+			if got := ClassifyError(err); got != ResultInvalid {
+				t.Fatalf("ClassifyError() = %v, want %v", got, ResultInvalid)
+			}
+			if result.Source != tt.wantSource {
+				t.Fatalf("source = %v, want %v", result.Source, tt.wantSource)
+			}
+
+			entries := logger.snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("logged entries = %d, want 1", len(entries))
+			}
+			assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventClientIPRejected, tt.wantSource, "/validate", tt.remoteAddr)
+			assertAttr(t, entries[0].attrs, "error", rejection.Error())
+			if tt.policy != "" {
+				assertAttr(t, entries[0].attrs, "policy", tt.policy)
+			} else if _, ok := entries[0].attrs["policy"]; ok {
+				t.Fatalf("policy attr = %v, want absent", entries[0].attrs["policy"])
+			}
+
+			var invalidErr *InvalidIPError
+			var remoteErr *RemoteAddrError
+			switch {
+			case errors.As(err, &invalidErr):
+				if invalidErr.Policy != tt.policy {
+					t.Fatalf("InvalidIPError.Policy = %q, want %q", invalidErr.Policy, tt.policy)
+				}
+			case errors.As(err, &remoteErr):
+				if remoteErr.Policy != tt.policy {
+					t.Fatalf("RemoteAddrError.Policy = %q, want %q", remoteErr.Policy, tt.policy)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_ClientIPValidatorAcceptsAndSeesSource(t *testing.T) {
+	var calls []Source
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXForwardedFor, SourceRemoteAddr}
+	WithClientIPValidator(func(_ context.Context, _ netip.Addr, source Source) error {
+		calls = append(calls, source)
+		return nil
+	}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("127.0.0.1:8080", "")
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+	if _, err := extractor.Extract(req); err != nil {
+		t.Fatalf("error = %v, want nil", err)
+	}
+
+	// Addresses rejected by the built-in checks never reach the validator.
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	if _, err := extractor.Extract(req); !errors.Is(err, ErrInvalidIP) {
+		t.Fatalf("error = %v, want ErrInvalidIP", err)
+	}
+
+	if len(calls) != 1 || calls[0] != SourceXForwardedFor {
+		t.Fatalf("validator calls = %v, want [x_forwarded_for]", calls)
+	}
+}
+
+func TestExtract_ClientIPRejectionSentinels(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXRealIP, SourceRemoteAddr}
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       error
+		notWant    error
+	}{
+		{name: "private header", remoteAddr: "127.0.0.1:8080", realIP: "10.0.0.1", want: ErrPrivateIP, notWant: ErrReservedIP},
+		{name: "reserved header", remoteAddr: "127.0.0.1:8080", realIP: "192.0.2.1", want: ErrReservedIP, notWant: ErrPrivateIP},
+		{name: "loopback header", remoteAddr: "127.0.0.1:8080", realIP: "127.0.0.2", want: ErrInvalidIP, notWant: ErrPrivateIP},
+		{name: "private remote addr", remoteAddr: "192.168.1.1:8080", want: ErrPrivateIP, notWant: ErrReservedIP},
+		{name: "cgnat remote addr", remoteAddr: "100.64.0.1:8080", want: ErrReservedIP, notWant: ErrPrivateIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(tt.remoteAddr, "")
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			_, err := extractor.Extract(req)
+			if !errors.Is(err, tt.want) || !errors.Is(err, ErrInvalidIP) {
+				t.Fatalf("error = %v, want %v wrapping ErrInvalidIP", err, tt.want)
+			}
+			if errors.Is(err, tt.notWant) {
+				t.Fatalf("error = %v, unexpectedly matches %v", err, tt.notWant)
+			}
+			if got := ClassifyError(err); got != ResultInvalid {
+				t.Fatalf("ClassifyError() = %v, want %v", got, ResultInvalid)
+			}
+		})
+	}
+}
+
+func TestExtract_RejectedClientPrefixes(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{SourceXForwardedFor, SourceRemoteAddr}
+	WithRejectedClientPrefixes(netip.MustParsePrefix("44.1.2.3/16")).applyOption(&cfg)
+	WithAllowedReservedClientPrefixes(netip.MustParsePrefix("44.1.200.0/24")).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		wantErr    error
+	}{
+		{name: "xff rejected", remoteAddr: "127.0.0.1:8080", xff: "44.1.9.9", wantErr: ErrReservedIP},
+		{name: "remote addr rejected", remoteAddr: "44.1.9.9:443", wantErr: ErrReservedIP},
+		{name: "allowlist wins", remoteAddr: "127.0.0.1:8080", xff: "44.1.200.1"},
+		{name: "outside rejected block", remoteAddr: "127.0.0.1:8080", xff: "44.2.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(tt.remoteAddr, "")
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if _, err := extractor.Extract(req); !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := New(WithRejectedClientPrefixes(netip.Prefix{})); err == nil {
+		t.Fatal("New() with invalid rejected prefix error = nil, want error")
+	}
+}
@@ -15,6 +15,14 @@ const (
 	SecurityEventReservedIP            = "reserved_ip"
 	SecurityEventPrivateIP             = "private_ip"
 	SecurityEventMalformedForwarded    = "malformed_forwarded"
+	SecurityEventClientIPRejected      = "client_ip_rejected"
+	SecurityEventInconsistentSources   = "inconsistent_sources"
+	SecurityEventForwardedByMismatch   = "forwarded_by_mismatch"
+	SecurityEventMalformedXFF          = "malformed_x_forwarded_for"
+	SecurityEventForwardedDefect       = "forwarded_defect_tolerated"
+	SecurityEventInvalidHeaderValue    = "invalid_header_value"
+	SecurityEventOriginSecretMismatch  = "origin_secret_mismatch"
+	SecurityEventInvalidSignature      = "invalid_signature"
 )
 
 // Logger records security-significant events emitted by extractor.
@@ -10,6 +10,11 @@
 // result label is Result.Classify().String(), producing low-cardinality values
 // such as "success", "untrusted", "malformed", and "fallback".
 //
+// Results of a clientip.WithReportOnly resolver that would have failed are
+// counted with result="report_only" and additionally in
+// ip_resolution_report_only_total{source,result}, where source is
+// Result.WouldFailSource() and result is Result.WouldFailKind().String().
+//
 // This adapter is intentionally a separate module so the root clientip package
 // does not depend on Prometheus.
 package prometheus
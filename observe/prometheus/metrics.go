@@ -15,9 +15,12 @@ import (
 // It exports ip_resolution_total{source,result} counters. The source label
 // uses clientip.Source.String() and the result label uses
 // clientip.ResultKind.String() via Result.Classify(), keeping labels
-// low-cardinality.
+// low-cardinality. Report-only results are also counted in
+// ip_resolution_report_only_total{source,result}, labeled with
+// Result.WouldFailSource() and Result.WouldFailKind().
 type Observer struct {
 	resolutionTotal *prom.CounterVec
+	reportOnlyTotal *prom.CounterVec
 }
 
 // New creates Prometheus-backed metrics and registers its collectors on
@@ -51,8 +54,21 @@ func NewWithRegisterer(registerer prom.Registerer) (*Observer, error) {
 		return nil, err
 	}
 
+	reportOnlyTotalCollector := prom.NewCounterVec(
+		prom.CounterOpts{
+			Name: "ip_resolution_report_only_total",
+			Help: "Total number of report-only client IP resolutions by failed source and the result classification that would have been enforced.",
+		},
+		[]string{"source", "result"},
+	)
+	reportOnlyTotal, err := registerCounterVec(registerer, reportOnlyTotalCollector, "ip_resolution_report_only_total")
+	if err != nil {
+		return nil, err
+	}
+
 	return &Observer{
 		resolutionTotal: resolutionTotal,
+		reportOnlyTotal: reportOnlyTotal,
 	}, nil
 }
 
@@ -100,9 +116,16 @@ func (m *Observer) OnResolved(_ context.Context, result clientip.Result) {
 	if m == nil {
 		return
 	}
-	source := result.Source.String()
-	if source == "" {
-		source = "unknown"
+	kind := result.Classify()
+	m.resolutionTotal.WithLabelValues(sourceLabel(result.Source), kind.String()).Inc()
+	if kind == clientip.ResultReportOnly {
+		m.reportOnlyTotal.WithLabelValues(sourceLabel(result.WouldFailSource()), result.WouldFailKind().String()).Inc()
+	}
+}
+
+func sourceLabel(source clientip.Source) string {
+	if label := source.String(); label != "" {
+		return label
 	}
-	m.resolutionTotal.WithLabelValues(source, result.Classify().String()).Inc()
+	return "unknown"
 }
@@ -92,6 +92,43 @@ func TestIntegration_ObserverRecordsFallback(t *testing.T) {
 	}
 }
 
+func TestIntegration_ObserverRecordsReportOnly(t *testing.T) {
+	registry := prom.NewRegistry()
+	metrics, err := clientipprom.NewWithRegisterer(registry)
+	if err != nil {
+		t.Fatalf("NewWithRegisterer() error = %v", err)
+	}
+
+	resolver, err := clientip.New(
+		clientip.WithObserver(metrics),
+		clientip.WithTrustedProxies(clientip.LoopbackProxyPrefixes()...),
+		clientip.WithSources(clientip.SourceXForwardedFor),
+		clientip.WithReportOnly(),
+	)
+	if err != nil {
+		t.Fatalf("clientip.New() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "1.1.1.1:12345", Header: make(http.Header)}
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+	if result := resolver.Resolve(req); result.Err != nil || result.WouldFail == nil {
+		t.Fatalf("Resolve() = %+v, want report-only result", result)
+	}
+
+	labels := map[string]string{
+		"source": clientip.SourceRemoteAddr.String(),
+		"result": clientip.ResultReportOnly.String(),
+	}
+	if got := mustCounterValue(t, registry, "ip_resolution_total", labels); got != 1 {
+		t.Fatalf("ip_resolution_total report-only counter = %v, want 1", got)
+	}
+	labels["source"] = clientip.SourceXForwardedFor.String()
+	labels["result"] = clientip.ResultUntrusted.String()
+	if got := mustCounterValue(t, registry, "ip_resolution_report_only_total", labels); got != 1 {
+		t.Fatalf("ip_resolution_report_only_total counter = %v, want 1", got)
+	}
+}
+
 func TestNewWithRegisterer_Creation(t *testing.T) {
 	registry := prom.NewRegistry()
 	metricsA, err := clientipprom.NewWithRegisterer(registry)
@@ -1,7 +1,6 @@
 package clientip
 
 import (
-	"errors"
 	"fmt"
 	"strings"
 )
@@ -11,91 +10,178 @@ import (
 // malformed syntax fails closed because a sabotaged Forwarded header can hide
 // or reorder client attribution.
 func parseForwardedValues(values []string, maxChainLength int) ([]string, error) {
+	parts, _, err := parseForwardedValuesMode(values, maxChainLength, forwardedParseMode{})
+	return parts, err
+}
+
+// parseForwardedValuesLenient is parseForwardedValues under ForwardedLenient:
+// malformed parameters other than for= are returned as defects instead of
+// failing the header.
+func parseForwardedValuesLenient(values []string, maxChainLength int) ([]string, []error, error) {
+	return parseForwardedValuesMode(values, maxChainLength, forwardedParseMode{lenient: true})
+}
+
+func parseForwardedValuesMode(values []string, maxChainLength int, mode forwardedParseMode) ([]string, []error, error) {
 	if len(values) == 0 {
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	parts := make([]string, 0, chainPartsCapacity(values, maxChainLength))
+	defects, err := scanForwardedElements(values, maxChainLength, mode, func(element forwardedElement) {
+		parts = append(parts, element.forNode)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 
+	return parts, defects, nil
+}
+
+// parseForwardedByValues extracts the by= value of every element that carries
+// for=, aligned with the entries returned by parseForwardedValues. Elements
+// without by= yield an empty string, and duplicate by= parameters are
+// rejected. lenient must match the mode that produced the for= entries.
+func parseForwardedByValues(values []string, maxChainLength int, lenient bool) ([]string, error) {
+	byValues := make([]string, 0, chainPartsCapacity(values, maxChainLength))
+	_, err := scanForwardedElements(values, maxChainLength, forwardedParseMode{withBy: true, lenient: lenient}, func(element forwardedElement) {
+		byValues = append(byValues, element.byNode)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return byValues, nil
+}
+
+// forwardedParseMode selects optional Forwarded parser behavior.
+type forwardedParseMode struct {
+	// withBy parses by= with the same strictness as for=.
+	withBy bool
+	// lenient tolerates malformed parameters other than for= and, with
+	// withBy, by=.
+	lenient bool
+}
+
+// forwardedElement holds the node parameters of one Forwarded element.
+type forwardedElement struct {
+	forNode string
+	byNode  string
+	hasFor  bool
+	hasBy   bool
+}
+
+// scanForwardedElements calls onElement for every element that carries for=,
+// enforcing maxChainLength, and returns the defects tolerated in lenient mode.
+func scanForwardedElements(values []string, maxChainLength int, mode forwardedParseMode, onElement func(forwardedElement)) ([]error, error) {
+	var defects []error
+	count := 0
 	for _, value := range values {
-		err := scanForwardedSegments(value, ',', "element", func(element string) error {
-			forwardedFor, hasFor, parseErr := parseForwardedElement(element)
+		err := scanForwardedSegments(value, ',', func(raw string) error {
+			if raw == "" {
+				return fmt.Errorf("empty forwarded element in %q", value)
+			}
+			element, parseErr := parseForwardedElement(raw, mode, &defects)
 			if parseErr != nil {
 				return parseErr
 			}
-			if !hasFor {
+			if !element.hasFor {
 				return nil
 			}
 
-			if len(parts) >= maxChainLength {
+			if count >= maxChainLength {
 				return &chainTooLongParseError{
-					ChainLength: len(parts) + 1,
+					ChainLength: count + 1,
 					MaxLength:   maxChainLength,
 				}
 			}
 
-			parts = append(parts, forwardedFor)
+			count++
+			onElement(element)
 			return nil
 		})
 		if err != nil {
-			var chainErr *chainTooLongParseError
-			if errors.As(err, &chainErr) {
-				return nil, err
-			}
-
 			return nil, err
 		}
 	}
 
-	return parts, nil
+	return defects, nil
 }
 
-// parseForwardedElement extracts at most one for= parameter from an element.
-// Duplicate for= parameters are rejected as ambiguous instead of choosing one.
-func parseForwardedElement(element string) (forwardedFor string, hasFor bool, err error) {
-	err = scanForwardedSegments(element, ';', "parameter", func(param string) error {
-		eq := strings.IndexByte(param, '=')
-		if eq <= 0 {
-			return fmt.Errorf("invalid forwarded parameter %q", param)
+// parseForwardedElement extracts at most one for= parameter, and with withBy
+// at most one by= parameter, from an element. Duplicates are rejected as
+// ambiguous instead of choosing one. In lenient mode, empty parameters and
+// malformed parameters other than those are appended to defects and skipped.
+func parseForwardedElement(raw string, mode forwardedParseMode, defects *[]error) (forwardedElement, error) {
+	var element forwardedElement
+	err := scanForwardedSegments(raw, ';', func(param string) error {
+		if param == "" {
+			defect := fmt.Errorf("empty forwarded parameter in %q", raw)
+			if mode.lenient {
+				*defects = append(*defects, defect)
+				return nil
+			}
+			return defect
 		}
 
-		key := strings.TrimSpace(param[:eq])
-		value := strings.TrimSpace(param[eq+1:])
-		if key == "" {
-			return fmt.Errorf("empty parameter key in %q", param)
+		key, value, hasValue := strings.Cut(param, "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		nodeParam := strings.EqualFold(key, "for") || (mode.withBy && strings.EqualFold(key, "by"))
+
+		var defect error
+		switch {
+		case !hasValue || key == "":
+			defect = fmt.Errorf("invalid forwarded parameter %q", param)
+		case value == "":
+			defect = fmt.Errorf("empty parameter value for %q", key)
 		}
-		if value == "" {
-			return fmt.Errorf("empty parameter value for %q", key)
+		if defect != nil {
+			if mode.lenient && !nodeParam {
+				*defects = append(*defects, defect)
+				return nil
+			}
+			return defect
 		}
 
-		if !strings.EqualFold(key, "for") {
+		var (
+			node    *string
+			present *bool
+		)
+		switch {
+		case strings.EqualFold(key, "for"):
+			node, present = &element.forNode, &element.hasFor
+		case mode.withBy && strings.EqualFold(key, "by"):
+			node, present = &element.byNode, &element.hasBy
+		default:
 			return nil
 		}
 
-		if hasFor {
-			return fmt.Errorf("duplicate for parameter in element %q", element)
+		if *present {
+			return fmt.Errorf("duplicate %s parameter in element %q", strings.ToLower(key), raw)
 		}
 
-		parsedValue, parseErr := parseForwardedForValue(value)
+		parsedValue, parseErr := parseForwardedNodeValue(strings.ToLower(key), value)
 		if parseErr != nil {
 			return parseErr
 		}
 
-		forwardedFor = parsedValue
-		hasFor = true
+		*node = parsedValue
+		*present = true
 		return nil
 	})
 	if err != nil {
-		return "", false, err
+		return forwardedElement{}, err
 	}
 
-	return forwardedFor, hasFor, nil
+	return element, nil
 }
 
 // scanForwardedSegments splits on delimiter while respecting quoted strings
 // and quoted-pair escapes. This prevents commas or semicolons inside quoted
-// values from changing the element/parameter structure we validate.
-func scanForwardedSegments(value string, delimiter byte, segmentKind string, onSegment func(string) error) error {
+// values from changing the element/parameter structure we validate. Empty
+// segments are passed to onSegment as "" so callers decide whether to reject
+// or tolerate them.
+func scanForwardedSegments(value string, delimiter byte, onSegment func(string) error) error {
 	start := 0
 	inQuotes := false
 	escaped := false
@@ -132,9 +218,6 @@ func scanForwardedSegments(value string, delimiter byte, segmentKind string, onS
 		}
 
 		segment := strings.TrimSpace(value[start:i])
-		if segment == "" {
-			return fmt.Errorf("empty forwarded %s in %q", segmentKind, value)
-		}
 		if err := onSegment(segment); err != nil {
 			return err
 		}
@@ -145,12 +228,13 @@ func scanForwardedSegments(value string, delimiter byte, segmentKind string, onS
 	return nil
 }
 
-// parseForwardedForValue normalizes the value side of for=. Quoted values must
-// be fully quoted and valid; partially quoted or empty values are malformed.
-func parseForwardedForValue(value string) (string, error) {
+// parseForwardedNodeValue normalizes the value side of for= or by=. Quoted
+// values must be fully quoted and valid; partially quoted or empty values are
+// malformed.
+func parseForwardedNodeValue(key, value string) (string, error) {
 	value = strings.TrimSpace(value)
 	if value == "" {
-		return "", fmt.Errorf("empty for value")
+		return "", fmt.Errorf("empty %s value", key)
 	}
 
 	if value[0] == '"' {
@@ -162,7 +246,7 @@ func parseForwardedForValue(value string) (string, error) {
 	}
 
 	if value == "" {
-		return "", fmt.Errorf("empty for value")
+		return "", fmt.Errorf("empty %s value", key)
 	}
 
 	return value, nil
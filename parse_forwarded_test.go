@@ -98,7 +98,7 @@ func TestParseForwardedValues_MalformedParameterMatrix(t *testing.T) {
 	}
 }
 
-func TestParseForwardedForValue(t *testing.T) {
+func TestParseForwardedNodeValue(t *testing.T) {
 	tests := []struct {
 		name    string
 		input   string
@@ -117,19 +117,95 @@ func TestParseForwardedForValue(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseForwardedForValue(tt.input)
+			got, err := parseForwardedNodeValue("for", tt.input)
 			if tt.wantErr {
 				if err == nil {
-					t.Fatalf("parseForwardedForValue() error = nil, want error")
+					t.Fatalf("parseForwardedNodeValue() error = nil, want error")
 				}
 				return
 			}
 
 			if err != nil {
-				t.Fatalf("parseForwardedForValue() error = %v, want nil", err)
+				t.Fatalf("parseForwardedNodeValue() error = %v, want nil", err)
 			}
 			if got != tt.want {
-				t.Fatalf("parseForwardedForValue() = %q, want %q", got, tt.want)
+				t.Fatalf("parseForwardedNodeValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseForwardedByValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "aligned with for", values: []string{`for=1.1.1.1;by=10.0.0.1, for=10.0.0.1;by="[2001:db8::1]:443"`}, want: []string{"10.0.0.1", "[2001:db8::1]:443"}},
+		{name: "missing by", values: []string{"for=1.1.1.1", "for=10.0.0.1;BY=_edge"}, want: []string{"", "_edge"}},
+		{name: "element without for skipped", values: []string{"by=10.0.0.9, for=1.1.1.1;by=10.0.0.1"}, want: []string{"10.0.0.1"}},
+		{name: "duplicate by", values: []string{"for=1.1.1.1;by=10.0.0.1;by=10.0.0.2"}, wantErr: true},
+		{name: "empty quoted by", values: []string{`for=1.1.1.1;by=""`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseForwardedByValues(tt.values, 100, false)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("parseForwardedByValues() error = nil, want parse error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseForwardedByValues() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("parseForwardedByValues() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseForwardedValuesLenient(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []string
+		want        []string
+		wantDefects int
+		wantErr     bool
+	}{
+		{name: "clean header", values: []string{"for=1.1.1.1;proto=https"}, want: []string{"1.1.1.1"}},
+		{name: "empty proto tolerated", values: []string{"for=1.1.1.1;proto=, for=10.0.0.2"}, want: []string{"1.1.1.1", "10.0.0.2"}, wantDefects: 1},
+		{name: "extension token tolerated", values: []string{"for=1.1.1.1;secure;=x"}, want: []string{"1.1.1.1"}, wantDefects: 2},
+		{name: "bare element tolerated", values: []string{"garbage, for=1.1.1.1"}, want: []string{"1.1.1.1"}, wantDefects: 1},
+		{name: "empty for stays strict", values: []string{"for=;proto=https"}, wantErr: true},
+		{name: "bare for stays strict", values: []string{"for"}, wantErr: true},
+		{name: "duplicate for stays strict", values: []string{"for=1.1.1.1;for=2.2.2.2"}, wantErr: true},
+		{name: "unterminated quote stays fatal", values: []string{`for=1.1.1.1;host="a`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, defects, err := parseForwardedValuesLenient(tt.values, 100)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseForwardedValuesLenient() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseForwardedValuesLenient() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("parseForwardedValuesLenient() mismatch (-want +got):\n%s", diff)
+			}
+			if len(defects) != tt.wantDefects {
+				t.Fatalf("defects = %v, want %d", defects, tt.wantDefects)
+			}
+			if _, strictErr := parseForwardedValues(tt.values, 100); (strictErr != nil) != (tt.wantDefects > 0) {
+				t.Fatalf("parseForwardedValues() error = %v, want error %v", strictErr, tt.wantDefects > 0)
 			}
 		})
 	}
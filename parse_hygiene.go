@@ -0,0 +1,77 @@
+package clientip
+
+import "fmt"
+
+// WithHeaderHygiene validates raw source header values before they are parsed.
+//
+// Header lines may contain only visible ASCII, space, and horizontal tab. This
+// rejects NULs, other control characters, obs-fold remnants, and non-ASCII
+// bytes that net/http would refuse but other frameworks and Input adapters
+// may pass through. When maxBytes is positive, the lines of one header may
+// total at most maxBytes bytes, which bounds parsing work before the chain is
+// split and WithMaxChainLength applies.
+//
+// Checks run after the trusted-peer check for every built-in header source.
+// Violations emit the invalid_header_value security event and fail with a
+// HeaderHygieneError wrapping ErrInvalidHeaderValue, classified as
+// ResultMalformed. CustomSource extractors read headers themselves and are
+// not checked.
+func WithHeaderHygiene(maxBytes int) Option {
+	return optionFunc(func(c *options) {
+		c.HeaderHygiene = true
+		c.MaxHeaderBytes = maxBytes
+	})
+}
+
+// headerHygiene is the normalized WithHeaderHygiene setting.
+type headerHygiene struct {
+	enabled  bool
+	maxBytes int
+}
+
+func (h headerHygiene) validate() error {
+	if h.maxBytes < 0 {
+		return fmt.Errorf("max header bytes must be >= 0, got %d", h.maxBytes)
+	}
+	return nil
+}
+
+// check returns nil when values pass, or a failure describing the first
+// violation. offset is the position of the first disallowed byte across the
+// concatenated lines, or -1 for a size violation.
+func (h headerHygiene) check(source Source, headerName string, values []string) *extractionFailure {
+	if !h.enabled {
+		return nil
+	}
+
+	size := 0
+	for _, value := range values {
+		size += len(value)
+	}
+	failure := func(offset int) *extractionFailure {
+		return &extractionFailure{
+			kind:           failureHeaderHygiene,
+			source:         source,
+			headerName:     headerName,
+			headerSize:     size,
+			maxHeaderBytes: h.maxBytes,
+			index:          offset,
+		}
+	}
+
+	if h.maxBytes > 0 && size > h.maxBytes {
+		return failure(-1)
+	}
+
+	offset := 0
+	for _, value := range values {
+		for i := 0; i < len(value); i++ {
+			ch := value[i]
+			if (ch < ' ' && ch != '\t') || ch > '~' {
+				return failure(offset + i)
+			}
+		}
+		offset += len(value)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestHeaderHygieneCheck(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBytes   int
+		values     []string
+		wantOffset int
+		wantSize   int
+		wantPass   bool
+	}{
+		{name: "visible ascii with space and tab", values: []string{"1.1.1.1,\t8.8.8.8", `for="[2001:db8::1]:80"`}, wantPass: true},
+		{name: "size at limit", maxBytes: 7, values: []string{"1.1.1.1"}, wantPass: true},
+		{name: "size over limit across lines", maxBytes: 10, values: []string{"1.1.1.1", "8.8.8.8"}, wantOffset: -1, wantSize: 14},
+		{name: "nul", values: []string{"1.1.1.1\x00"}, wantOffset: 7, wantSize: 8},
+		{name: "obs-fold remnant in second line", values: []string{"1.1.1.1", "8.8.8.8\r\n 9.9.9.9"}, wantOffset: 14, wantSize: 24},
+		{name: "del", values: []string{"\x7f"}, wantOffset: 0, wantSize: 1},
+		{name: "non-ascii", values: []string{"1.1.1.1\xc2\xa0"}, wantOffset: 7, wantSize: 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hygiene := headerHygiene{enabled: true, maxBytes: tt.maxBytes}
+			failure := hygiene.check(SourceXForwardedFor, "X-Forwarded-For", tt.values)
+			if tt.wantPass {
+				if failure != nil {
+					t.Fatalf("check() = %+v, want pass", failure)
+				}
+				return
+			}
+			if failure == nil {
+				t.Fatal("check() = nil, want failure")
+			}
+			if failure.kind != failureHeaderHygiene || failure.index != tt.wantOffset || failure.headerSize != tt.wantSize || failure.maxHeaderBytes != tt.maxBytes {
+				t.Fatalf("check() = %+v, want offset=%d size=%d", failure, tt.wantOffset, tt.wantSize)
+			}
+		})
+	}
+
+	if failure := (headerHygiene{}).check(SourceXForwardedFor, "X-Forwarded-For", []string{"\x00"}); failure != nil {
+		t.Fatalf("disabled check() = %+v, want nil", failure)
+	}
+}
+
+func TestExtract_HeaderHygiene(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     Source
+		header     string
+		value      string
+		remoteAddr string
+		wantIP     string
+		wantErr    error
+		wantOffset int
+	}{
+		{name: "clean chain", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, 10.0.0.2", remoteAddr: "10.0.0.1:443", wantIP: "8.8.8.8"},
+		{name: "control byte in chain", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8\x01, 10.0.0.2", remoteAddr: "10.0.0.1:443", wantErr: ErrInvalidHeaderValue, wantOffset: 7},
+		{name: "oversized forwarded", source: SourceForwarded, header: "Forwarded", value: "for=8.8.8.8, for=10.0.0.2, for=10.0.0.3, for=10.0.0.4", remoteAddr: "10.0.0.1:443", wantErr: ErrInvalidHeaderValue, wantOffset: -1},
+		{name: "single header", source: SourceXRealIP, header: "X-Real-IP", value: "8.8.8.8\x00", remoteAddr: "10.0.0.1:443", wantErr: ErrInvalidHeaderValue, wantOffset: 7},
+		{name: "untrusted peer checked first", source: SourceXRealIP, header: "X-Real-IP", value: "8.8.8.8\x00", remoteAddr: "1.1.1.1:443", wantErr: ErrUntrustedProxy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{tt.source}
+			WithHeaderHygiene(48).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest(tt.remoteAddr, "/")
+			req.Header.Set(tt.header, tt.value)
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+			if !errors.Is(tt.wantErr, ErrInvalidHeaderValue) {
+				return
+			}
+
+			var hygieneErr *HeaderHygieneError
+			if !errors.As(err, &hygieneErr) {
+				t.Fatalf("error = %T, want *HeaderHygieneError", err)
+			}
+			if hygieneErr.HeaderName != tt.header && hygieneErr.HeaderName != "X-Real-Ip" {
+				t.Fatalf("HeaderName = %q, want %q", hygieneErr.HeaderName, tt.header)
+			}
+			if hygieneErr.Offset != tt.wantOffset || hygieneErr.Size != len(tt.value) || hygieneErr.MaxBytes != 48 {
+				t.Fatalf("HeaderHygieneError = %+v", hygieneErr)
+			}
+			if ClassifyError(err) != ResultMalformed {
+				t.Fatalf("ClassifyError() = %v, want %v", ClassifyError(err), ResultMalformed)
+			}
+
+			entries := logger.snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d events, want 1", len(entries))
+			}
+			assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventInvalidHeaderValue, tt.source, "/", tt.remoteAddr)
+			assertAttr(t, entries[0].attrs, "offset", tt.wantOffset)
+			assertAttr(t, entries[0].attrs, "size", len(tt.value))
+		})
+	}
+}
+
+func TestNew_HeaderHygieneValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceXForwardedFor), WithHeaderHygiene(-1)); err == nil {
+		t.Fatal("New() error = nil, want rejection of negative max header bytes")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceXForwardedFor), WithHeaderHygiene(4096))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if !description.HeaderHygiene || description.MaxHeaderBytes != 4096 {
+		t.Fatalf("Describe() header hygiene = %v, %d", description.HeaderHygiene, description.MaxHeaderBytes)
+	}
+}
@@ -0,0 +1,104 @@
+package clientip
+
+// ForwardedParsing controls how strictly Forwarded header parameters other
+// than for= are parsed.
+type ForwardedParsing uint8
+
+const (
+	// ForwardedStrict fails the whole header with ErrInvalidForwardedHeader
+	// on any malformed parameter. This is the default.
+	ForwardedStrict ForwardedParsing = iota
+	// ForwardedLenient tolerates malformed parameters other than for=, such
+	// as a sloppy proto=, a bare vendor extension token, or an empty ";;"
+	// parameter, by skipping them.
+	// for= and, with WithForwardedByValidation, by= stay strict, and quoting
+	// errors that make the element structure ambiguous still fail the
+	// header. Each tolerated defect emits the forwarded_defect_tolerated
+	// security event and is joined into Result.ParseDefectErr when the
+	// Forwarded source resolves.
+	ForwardedLenient
+)
+
+// String returns the stable label for m.
+func (m ForwardedParsing) String() string {
+	switch m {
+	case ForwardedStrict:
+		return "strict"
+	case ForwardedLenient:
+		return "lenient"
+	default:
+		return "unknown"
+	}
+}
+
+func (m ForwardedParsing) valid() bool {
+	return m <= ForwardedLenient
+}
+
+// WithForwardedParsing sets the parse strictness for Forwarded parameters
+// other than for=.
+func WithForwardedParsing(mode ForwardedParsing) Option {
+	return optionFunc(func(c *options) { c.ForwardedParsing = mode })
+}
+
+// XForwardedForParsing controls how strictly X-Forwarded-For and
+// ChainHeaderSource values are parsed.
+type XForwardedForParsing uint8
+
+const (
+	// XForwardedForStandard ignores empty comma-created elements and accepts
+	// quoted, bracketed, and port-suffixed addresses. Elements that are not
+	// addresses stay in the chain as untrusted hops and fail with ErrInvalidIP
+	// when selected as the client. This is the default.
+	XForwardedForStandard XForwardedForParsing = iota
+	// XForwardedForStrict accepts only bare IP addresses. Empty elements,
+	// quotes, brackets, ports, zones, and non-IP tokens fail the header with
+	// ErrInvalidXForwardedForHeader, classified as ResultMalformed, and emit
+	// the malformed_x_forwarded_for security event. "unknown" and obfuscated
+	// nodes are non-IP tokens too, so they fail the header before
+	// WithOpaqueNodePolicy is consulted; the policy then only affects
+	// Forwarded.
+	XForwardedForStrict
+	// XForwardedForLenient drops elements that do not parse as an address,
+	// such as hostnames, before trust analysis. Use it only for legacy proxies
+	// that write such tokens: a dropped element is never reported, and the hop
+	// to its left takes its place. "unknown" and obfuscated nodes are kept and
+	// handled by WithOpaqueNodePolicy.
+	XForwardedForLenient
+)
+
+// String returns the stable label for m.
+func (m XForwardedForParsing) String() string {
+	switch m {
+	case XForwardedForStandard:
+		return "standard"
+	case XForwardedForStrict:
+		return "strict"
+	case XForwardedForLenient:
+		return "lenient"
+	default:
+		return "unknown"
+	}
+}
+
+func (m XForwardedForParsing) valid() bool {
+	return m <= XForwardedForLenient
+}
+
+// WithXForwardedForParsing sets the parse strictness for X-Forwarded-For and
+// ChainHeaderSource headers.
+func WithXForwardedForParsing(mode XForwardedForParsing) Option {
+	return optionFunc(func(c *options) { c.XForwardedForParsing = mode })
+}
+
+// xffParser returns the parser for mode.
+func xffParser(mode XForwardedForParsing) func([]string, int) ([]string, error) {
+	switch mode {
+	case XForwardedForStrict:
+		return parseXFFValuesStrict
+	case XForwardedForLenient:
+		return parseXFFValuesLenient
+	default:
+		return parseXFFValues
+	}
+}
@@ -0,0 +1,219 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestExtract_XForwardedForParsing(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      XForwardedForParsing
+		source    Source
+		header    string
+		value     string
+		wantIP    string
+		wantErr   error
+		wantEvent bool
+	}{
+		{name: "standard ignores empty element", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, , 10.0.0.2", wantIP: "8.8.8.8"},
+		{name: "standard rejects token client", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown", wantErr: ErrInvalidIP},
+		{name: "strict accepts bare chain", mode: XForwardedForStrict, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, 10.0.0.2", wantIP: "8.8.8.8"},
+		{name: "strict rejects empty element", mode: XForwardedForStrict, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, , 10.0.0.2", wantErr: ErrInvalidXForwardedForHeader, wantEvent: true},
+		{name: "strict rejects opaque node", mode: XForwardedForStrict, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown", wantErr: ErrInvalidXForwardedForHeader, wantEvent: true},
+		{name: "strict rejects port", mode: XForwardedForStrict, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8:1234", wantErr: ErrInvalidXForwardedForHeader, wantEvent: true},
+		{name: "strict applies to chain header", mode: XForwardedForStrict, source: ChainHeaderSource("X-Original-Forwarded-For"), header: "X-Original-Forwarded-For", value: `"8.8.8.8"`, wantErr: ErrInvalidXForwardedForHeader, wantEvent: true},
+		{name: "lenient drops hostname", mode: XForwardedForLenient, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, proxy.internal", wantIP: "8.8.8.8"},
+		{name: "lenient keeps opaque node", mode: XForwardedForLenient, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown", wantErr: ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{tt.source}
+			WithXForwardedForParsing(tt.mode).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			req.Header.Set(tt.header, tt.value)
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+			if errors.Is(tt.wantErr, ErrInvalidXForwardedForHeader) && ClassifyError(err) != ResultMalformed {
+				t.Fatalf("ClassifyError() = %v, want %v", ClassifyError(err), ResultMalformed)
+			}
+
+			entries := logger.snapshot()
+			if got := len(entries) == 1; got != tt.wantEvent {
+				t.Fatalf("logged %d events, want event %v", len(entries), tt.wantEvent)
+			}
+			if tt.wantEvent {
+				assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventMalformedXFF, tt.source, "/", "10.0.0.1:443")
+			}
+		})
+	}
+}
+
+func TestExtract_XForwardedForLenientKeepsOpaqueNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   OpaqueNodePolicy
+		wantErr  error
+		wantNode string
+	}{
+		{name: "invalid", policy: OpaqueNodeInvalid, wantErr: ErrInvalidIP},
+		{name: "terminal", policy: OpaqueNodeTerminal, wantErr: ErrOpaqueNode},
+		{name: "anonymous", policy: OpaqueNodeAnonymous, wantNode: "unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultOptions()
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{SourceXForwardedFor}
+			WithXForwardedForParsing(XForwardedForLenient).applyOption(&cfg)
+			WithOpaqueNodePolicy(tt.policy).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			req.Header.Set("X-Forwarded-For", "8.8.8.8, unknown")
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if result.IP.IsValid() || result.AnonymousNode != tt.wantNode {
+				t.Fatalf("result = %+v, want no IP and AnonymousNode %q; the hop behind the opaque node must not be selected", result, tt.wantNode)
+			}
+		})
+	}
+}
+
+func TestNew_XForwardedForParsingValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceXForwardedFor), WithXForwardedForParsing(XForwardedForParsing(9))); err == nil {
+		t.Fatal("New() error = nil, want rejection of invalid parsing mode")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceXForwardedFor), WithXForwardedForParsing(XForwardedForStrict))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().XForwardedForParsing; got != XForwardedForStrict {
+		t.Fatalf("Describe().XForwardedForParsing = %v, want %v", got, XForwardedForStrict)
+	}
+}
+
+func TestNew_ForwardedParsingValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceForwarded), WithForwardedParsing(ForwardedParsing(9))); err == nil {
+		t.Fatal("New() error = nil, want rejection of invalid parsing mode")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceForwarded), WithForwardedParsing(ForwardedLenient))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().ForwardedParsing; got != ForwardedLenient {
+		t.Fatalf("Describe().ForwardedParsing = %v, want %v", got, ForwardedLenient)
+	}
+}
+
+func TestExtract_ForwardedParsing(t *testing.T) {
+	tests := []struct {
+		name        string
+		mode        ForwardedParsing
+		value       string
+		wantIP      string
+		wantErr     error
+		wantDefects int
+		wantEvent   string
+	}{
+		{name: "strict rejects sloppy proto", value: "for=8.8.8.8;proto=, for=10.0.0.2", wantErr: ErrInvalidForwardedHeader, wantEvent: SecurityEventMalformedForwarded},
+		{name: "lenient tolerates sloppy proto", mode: ForwardedLenient, value: "for=8.8.8.8;proto=, for=10.0.0.2;secure", wantIP: "8.8.8.8", wantDefects: 2, wantEvent: SecurityEventForwardedDefect},
+		{name: "lenient keeps for strict", mode: ForwardedLenient, value: "for=8.8.8.8;for=1.1.1.1", wantErr: ErrInvalidForwardedHeader, wantEvent: SecurityEventMalformedForwarded},
+		{name: "strict rejects empty parameter", value: "for=1.2.3.4;;proto=http", wantErr: ErrInvalidForwardedHeader, wantEvent: SecurityEventMalformedForwarded},
+		{name: "lenient tolerates empty parameter", mode: ForwardedLenient, value: "for=1.2.3.4;;proto=http", wantIP: "1.2.3.4", wantDefects: 1, wantEvent: SecurityEventForwardedDefect},
+		{name: "lenient clean header", mode: ForwardedLenient, value: "for=8.8.8.8;proto=https", wantIP: "8.8.8.8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{SourceForwarded}
+			WithForwardedParsing(tt.mode).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			req.Header.Set("Forwarded", tt.value)
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+
+			var defects []error
+			if joined, ok := result.ParseDefectErr.(interface{ Unwrap() []error }); ok {
+				defects = joined.Unwrap()
+			}
+			if len(defects) != tt.wantDefects {
+				t.Fatalf("ParseDefectErr = %v, want %d defects", result.ParseDefectErr, tt.wantDefects)
+			}
+			for _, defect := range defects {
+				var extractionErr *ExtractionError
+				if !errors.As(defect, &extractionErr) || extractionErr.Source != SourceForwarded || !errors.Is(defect, ErrInvalidForwardedHeader) {
+					t.Fatalf("defect = %#v, want Forwarded ExtractionError", defect)
+				}
+			}
+
+			entries := logger.snapshot()
+			wantEntries := tt.wantDefects
+			if tt.wantErr != nil {
+				wantEntries = 1
+			}
+			if len(entries) != wantEntries {
+				t.Fatalf("logged %d events, want %d", len(entries), wantEntries)
+			}
+			for _, entry := range entries {
+				assertCommonSecurityWarningAttrs(t, entry.attrs, tt.wantEvent, SourceForwarded, "/", "10.0.0.1:443")
+			}
+		})
+	}
+}
+
+func TestExtract_ForwardedLenientWithByValidation(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{SourceForwarded}
+	WithForwardedParsing(ForwardedLenient).applyOption(&cfg)
+	WithForwardedByValidation("_edge").applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("10.0.0.1:443", "/")
+	req.Header.Set("Forwarded", "for=8.8.8.8;by=_edge;proto=")
+
+	result, err := extractor.Extract(req)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.IP != netip.MustParseAddr("8.8.8.8") || result.ParseDefectErr == nil {
+		t.Fatalf("result = %+v, want 8.8.8.8 with a tolerated defect", result)
+	}
+}
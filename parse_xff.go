@@ -1,6 +1,11 @@
 package clientip
 
-import "strings"
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
 
 // parseXFFValues parses X-Forwarded-For header lines into a logical chain.
 //
@@ -58,3 +63,92 @@ func parseXFFValues(values []string, maxChainLength int) ([]string, error) {
 
 	return parts, nil
 }
+
+// parseXFFValuesStrict parses X-Forwarded-For header lines that may only
+// contain comma-separated bare IP addresses. Anything else fails the header.
+func parseXFFValuesStrict(values []string, maxChainLength int) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	parts := make([]string, 0, chainPartsCapacity(values, maxChainLength))
+	for _, v := range values {
+		start := 0
+		for i := 0; i <= len(v); i++ {
+			if i != len(v) && v[i] != ',' {
+				continue
+			}
+
+			part := trimHTTPWhitespace(v[start:i])
+			if err := validateStrictXFFElement(part); err != nil {
+				return nil, err
+			}
+			if len(parts) >= maxChainLength {
+				return nil, &chainTooLongParseError{
+					ChainLength: len(parts) + 1,
+					MaxLength:   maxChainLength,
+				}
+			}
+
+			parts = append(parts, part)
+			start = i + 1
+		}
+	}
+
+	return parts, nil
+}
+
+func validateStrictXFFElement(part string) error {
+	if part == "" {
+		return fmt.Errorf("empty element")
+	}
+	if strings.ContainsAny(part, `"'`) {
+		return fmt.Errorf("quoted element %q", part)
+	}
+
+	ip, err := netip.ParseAddr(part)
+	if err == nil {
+		if ip.Zone() != "" {
+			return fmt.Errorf("zoned address %q", part)
+		}
+		return nil
+	}
+	if _, err := netip.ParseAddrPort(part); err == nil || strings.HasPrefix(part, "[") {
+		return fmt.Errorf("port or brackets in element %q", part)
+	}
+	return fmt.Errorf("element %q is not an IP address", part)
+}
+
+// parseXFFValuesLenient parses like parseXFFValues and then drops elements
+// that neither parse as an address nor are opaque nodes. Opaque nodes are
+// kept so OpaqueNodePolicy still decides how they are handled.
+func parseXFFValuesLenient(values []string, maxChainLength int) ([]string, error) {
+	parts, err := parseXFFValues(values, maxChainLength)
+	if err != nil {
+		return nil, err
+	}
+
+	first := slices.IndexFunc(parts, dropLenientXFFElement)
+	if first < 0 {
+		return parts, nil
+	}
+
+	// parts may alias the caller's header values, so filter into a copy.
+	kept := make([]string, first, len(parts)-1)
+	copy(kept, parts[:first])
+	for _, part := range parts[first+1:] {
+		if !dropLenientXFFElement(part) {
+			kept = append(kept, part)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, nil
+	}
+	return kept, nil
+}
+
+// dropLenientXFFElement reports whether lenient parsing discards part: a
+// hostname or other token that is neither an address nor an opaque node.
+func dropLenientXFFElement(part string) bool {
+	return !parseIP(part).IsValid() && !isOpaqueNode(part)
+}
@@ -66,3 +66,76 @@ func TestParseXFFValues_MaxChainLength_AcrossHeaderLines(t *testing.T) {
 		t.Fatalf("parseXFFValues() error = %v, want chainTooLongParseError", err)
 	}
 }
+
+func TestParseXFFValuesStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "bare addresses", values: []string{" 1.1.1.1 ,2001:db8::1", "8.8.8.8"}, want: []string{"1.1.1.1", "2001:db8::1", "8.8.8.8"}},
+		{name: "empty list", values: []string{}, want: nil},
+		{name: "empty element", values: []string{"1.1.1.1, , 8.8.8.8"}, wantErr: true},
+		{name: "trailing comma", values: []string{"1.1.1.1,"}, wantErr: true},
+		{name: "empty header line", values: []string{""}, wantErr: true},
+		{name: "quoted", values: []string{`"1.1.1.1"`}, wantErr: true},
+		{name: "ipv4 port", values: []string{"1.1.1.1:80"}, wantErr: true},
+		{name: "bracketed ipv6", values: []string{"[2001:db8::1]"}, wantErr: true},
+		{name: "zone", values: []string{"fe80::1%eth0"}, wantErr: true},
+		{name: "token", values: []string{"unknown"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseXFFValuesStrict(tt.values, 100)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseXFFValuesStrict() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseXFFValuesStrict() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("parseXFFValuesStrict() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	var chainErr *chainTooLongParseError
+	if _, err := parseXFFValuesStrict([]string{"1.1.1.1, 2.2.2.2, 3.3.3.3"}, 2); !errors.As(err, &chainErr) {
+		t.Fatalf("parseXFFValuesStrict() error = %v, want chainTooLongParseError", err)
+	}
+}
+
+func TestParseXFFValuesLenient(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{name: "all valid", values: []string{"1.1.1.1, [2001:db8::1]:443"}, want: []string{"1.1.1.1", "[2001:db8::1]:443"}},
+		{name: "hostnames dropped", values: []string{"1.1.1.1, proxy.internal, garbage, 10.0.0.2"}, want: []string{"1.1.1.1", "10.0.0.2"}},
+		{name: "leading hostname dropped", values: []string{"proxy.internal, 10.0.0.2"}, want: []string{"10.0.0.2"}},
+		{name: "opaque nodes kept", values: []string{"1.1.1.1, unknown, proxy.internal, _hidden, 10.0.0.2"}, want: []string{"1.1.1.1", "unknown", "_hidden", "10.0.0.2"}},
+		{name: "only hostnames", values: []string{"proxy.internal"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := append([]string(nil), tt.values...)
+			got, err := parseXFFValuesLenient(values, 100)
+			if err != nil {
+				t.Fatalf("parseXFFValuesLenient() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("parseXFFValuesLenient() mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.values, values); diff != "" {
+				t.Fatalf("parseXFFValuesLenient() mutated input (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
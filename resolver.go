@@ -57,6 +57,8 @@ const (
 	FallbackReasonInvalidIP
 	// FallbackReasonUnknown indicates fallback was used because strict extraction returned an unclassified error.
 	FallbackReasonUnknown
+	// FallbackReasonAnonymousClient indicates fallback was used because strict extraction resolved an anonymous client without an IP.
+	FallbackReasonAnonymousClient
 )
 
 // String returns the stable label for r.
@@ -74,6 +76,8 @@ func (r FallbackReason) String() string {
 		return "invalid_ip"
 	case FallbackReasonUnknown:
 		return "unknown"
+	case FallbackReasonAnonymousClient:
+		return "anonymous_client"
 	default:
 		return "unknown"
 	}
@@ -85,7 +89,9 @@ func (r FallbackReason) String() string {
 // On fallback success Source is SourceRemoteAddr for RemoteAddrFallback or
 // SourceStaticFallback for StaticFallback, and FallbackReason carries the
 // strict failure category that triggered the fallback. On error Source may
-// still identify the source that failed.
+// still identify the source that failed. On report-only success IP is the
+// connecting peer, Source is SourceRemoteAddr, and WouldFailSource reports the
+// source whose strict attempt failed.
 type Result struct {
 	// Extraction contains the IP and source metadata. It may still contain a
 	// Source when Err is non-nil.
@@ -101,9 +107,17 @@ type Result struct {
 
 	// FallbackReason reports why operational fallback was used.
 	FallbackReason FallbackReason
+
+	// WouldFail is the strict error a WithReportOnly resolver would have
+	// returned. When set, Err is nil, IP is the connecting peer, and Source is
+	// SourceRemoteAddr.
+	WouldFail error
 }
 
-// OK reports whether the resolution produced a usable IP without error.
+// OK reports whether the resolution produced a usable IP without error. An
+// anonymous client (Classify returns ResultAnonymous) resolves without error
+// but has no IP, so OK reports false for it unless operational fallback or
+// WithReportOnly substituted an address.
 func (r Result) OK() bool {
 	return r.Err == nil && r.IP.IsValid()
 }
@@ -114,9 +128,38 @@ func (r Result) Classify() ResultKind {
 	if r.FallbackUsed {
 		return ResultFallback
 	}
+	if r.Err == nil && r.WouldFail != nil {
+		return ResultReportOnly
+	}
+	if r.Err == nil && r.AnonymousNode != "" {
+		return ResultAnonymous
+	}
 	return ClassifyError(r.Err)
 }
 
+// anonymous reports whether r is an anonymous client without an IP.
+func (r Result) anonymous() bool {
+	return r.Err == nil && r.AnonymousNode != "" && !r.IP.IsValid()
+}
+
+// WouldFailKind classifies WouldFail: the kind a WithReportOnly resolver
+// would have returned from Classify if it enforced strict resolution. It is
+// ResultSuccess when WouldFail is nil.
+func (r Result) WouldFailKind() ResultKind {
+	return ClassifyError(r.WouldFail)
+}
+
+// WouldFailSource returns the source named by WouldFail: the source whose
+// strict attempt a WithReportOnly resolver would have failed on. It is the
+// zero Source when WouldFail is nil or names no source.
+func (r Result) WouldFailSource() Source {
+	var sourceErr interface{ SourceValue() Source }
+	if errors.As(r.WouldFail, &sourceErr) {
+		return sourceErr.SourceValue()
+	}
+	return Source{}
+}
+
 // Resolver resolves client IP information using the configured trust policy.
 //
 // Resolver instances are safe for concurrent reuse.
@@ -178,13 +221,7 @@ func (r *Resolver) ResolveOperational(req *http.Request, fallback Fallback) Resu
 		return result
 	}
 
-	strict := r.resolveStrictRequest(req)
-	result := strict
-	if strict.Err != nil && !isResolverTerminalContextError(strict.Err) {
-		if resolved, ok := r.applyFallback(req.RemoteAddr, fallback, strict.Err); ok {
-			result = resolved
-		}
-	}
+	result := r.applyOperational(r.resolveStrictRequest(req), req.RemoteAddr, fallback)
 	r.observe(req.Context(), result)
 	return result
 }
@@ -212,13 +249,7 @@ func (r *Resolver) ResolveInputOperational(input Input, fallback Fallback) Resul
 	if r == nil || r.extractor == nil {
 		return Result{Err: errNilResolverExtractor}
 	}
-	strict := r.resolveStrictInput(input)
-	result := strict
-	if strict.Err != nil && !isResolverTerminalContextError(strict.Err) {
-		if resolved, ok := r.applyFallback(input.RemoteAddr, fallback, strict.Err); ok {
-			result = resolved
-		}
-	}
+	result := r.applyOperational(r.resolveStrictInput(input), input.RemoteAddr, fallback)
 	r.observe(requestInputContext(input), result)
 	return result
 }
@@ -254,12 +285,65 @@ func FromContext(ctx context.Context) (Result, bool) {
 
 func (r *Resolver) resolveStrictRequest(req *http.Request) Result {
 	extraction, err := r.extractor.Extract(req)
-	return Result{Extraction: extraction, Err: err}
+	return r.applyReportOnly(Result{Extraction: extraction, Err: err}, req.RemoteAddr)
 }
 
 func (r *Resolver) resolveStrictInput(input Input) Result {
 	extraction, err := r.extractor.ExtractInput(input)
-	return Result{Extraction: extraction, Err: err}
+	return r.applyReportOnly(Result{Extraction: extraction, Err: err}, input.RemoteAddr)
+}
+
+// applyReportOnly moves a strict failure into WouldFail and substitutes the
+// connecting peer when WithReportOnly is enabled. Anonymous clients get the
+// peer too, with AnonymousNode kept, because they carry no IP. Like
+// applyFallback it drops the chain-derived metadata of the strict attempt,
+// keeping only the audit fields about skipped sources. Context errors and
+// unparsable peers keep the strict failure because no usable IP exists.
+func (r *Resolver) applyReportOnly(result Result, remoteAddr string) Result {
+	if !r.extractor.config.reportOnly {
+		return result
+	}
+	if !result.anonymous() && (result.Err == nil || isResolverTerminalContextError(result.Err)) {
+		return result
+	}
+
+	ip, err := ParseRemoteAddr(remoteAddr)
+	if err != nil {
+		return result
+	}
+
+	return Result{
+		Extraction: Extraction{
+			IP:                  ip,
+			Source:              SourceRemoteAddr,
+			AnonymousNode:       result.AnonymousNode,
+			SpoofAttemptIgnored: result.SpoofAttemptIgnored,
+			SkippedErr:          result.SkippedErr,
+		},
+		WouldFail: result.Err,
+	}
+}
+
+// applyOperational applies fallback to a strict failure, other than a context
+// error, and to an anonymous client, which resolves without an IP. A fallback
+// for an anonymous client keeps AnonymousNode.
+func (r *Resolver) applyOperational(strict Result, remoteAddr string, fallback Fallback) Result {
+	var reason FallbackReason
+	switch {
+	case strict.anonymous():
+		reason = FallbackReasonAnonymousClient
+	case strict.Err != nil && !isResolverTerminalContextError(strict.Err):
+		reason = fallbackReasonFromError(strict.Err)
+	default:
+		return strict
+	}
+
+	resolved, ok := r.applyFallback(remoteAddr, fallback, reason)
+	if !ok {
+		return strict
+	}
+	resolved.AnonymousNode = strict.AnonymousNode
+	return resolved
 }
 
 func (r *Resolver) observe(ctx context.Context, result Result) {
@@ -269,8 +353,7 @@ func (r *Resolver) observe(ctx context.Context, result Result) {
 	r.extractor.config.observer.OnResolved(ctx, result)
 }
 
-func (r *Resolver) applyFallback(remoteAddr string, fallback Fallback, strictErr error) (Result, bool) {
-	reason := fallbackReasonFromError(strictErr)
+func (r *Resolver) applyFallback(remoteAddr string, fallback Fallback, reason FallbackReason) (Result, bool) {
 	switch fallback.mode {
 	case fallbackRemoteAddr:
 		ip, err := ParseRemoteAddr(remoteAddr)
@@ -295,7 +378,7 @@ func (r *Resolver) applyFallback(remoteAddr string, fallback Fallback, strictErr
 
 func fallbackReasonFromError(err error) FallbackReason {
 	switch ClassifyError(err) {
-	case ResultSuccess, ResultCanceled, ResultFallback:
+	case ResultSuccess, ResultCanceled, ResultFallback, ResultReportOnly, ResultAnonymous:
 		return FallbackReasonNone
 	case ResultUntrusted:
 		return FallbackReasonUntrustedProxy
@@ -0,0 +1,416 @@
+package clientip
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"slices"
+)
+
+// Description is a snapshot of a Resolver's effective configuration after
+// defaults, prefix normalization, deduplication, and source canonicalization.
+//
+// Describe returns a fresh copy on every call, so mutating a Description never
+// changes resolver behavior.
+type Description struct {
+	// TrustedProxyPrefixes are the masked, deduplicated trusted proxy ranges.
+	TrustedProxyPrefixes []netip.Prefix
+	// MinTrustedProxies is the configured minimum trusted-proxy count.
+	MinTrustedProxies int
+	// MaxTrustedProxies is the configured maximum trusted-proxy count.
+	MaxTrustedProxies int
+	// AllowPrivateIPs reports whether private client addresses are accepted.
+	AllowPrivateIPs bool
+	// AllowedReservedClientPrefixes are the masked, deduplicated reserved
+	// client ranges that bypass reserved-range rejection.
+	AllowedReservedClientPrefixes []netip.Prefix
+	// MaxChainLength is the effective chain-length limit.
+	MaxChainLength int
+	// ChainSelection is the effective chain selection algorithm.
+	ChainSelection ChainSelection
+	// DebugInfo reports whether chain diagnostics are attached to results.
+	DebugInfo bool
+	// Sources is the canonical strict extraction order.
+	Sources []Source
+	// ReportOnly reports whether strict failures are reported instead of
+	// enforced.
+	ReportOnly bool
+	// IgnoreUntrustedPeerSources lists header sources configured with
+	// UntrustedPeerIgnore, in priority order.
+	IgnoreUntrustedPeerSources []Source
+	// SkippableFailures maps sources configured with WithSourceFailurePolicy
+	// to their skippable failure kinds.
+	SkippableFailures map[Source][]ResultKind
+	// SourceClientIPPolicies maps sources configured with
+	// WithSourceClientIPPolicy to their effective, named policies.
+	SourceClientIPPolicies map[Source]ClientIPPolicy
+	// ClientIPValidator reports whether WithClientIPValidator is configured.
+	ClientIPValidator bool
+	// RejectedClientPrefixes are the masked, deduplicated ranges added to the
+	// built-in reserved client table.
+	RejectedClientPrefixes []netip.Prefix
+	// EmbeddedIPv4 is the effective NAT64, 6to4, and Teredo unwrapping
+	// policy. NAT64Prefixes are ordered longest first.
+	EmbeddedIPv4 EmbeddedIPv4Policy
+	// ConsistencyGroups are the configured groups with canonical sources and
+	// effective names.
+	ConsistencyGroups []ConsistencyGroup
+	// ChainReconciliation is the Forwarded/X-Forwarded-For reconciliation
+	// mode.
+	ChainReconciliation ChainReconciliation
+	// OpaqueNodes is the policy for "unknown" and obfuscated chain nodes.
+	OpaqueNodes OpaqueNodePolicy
+	// HeaderHygiene reports whether WithHeaderHygiene is enabled.
+	HeaderHygiene bool
+	// MaxHeaderBytes is the per-header size limit, or 0 when unlimited.
+	MaxHeaderBytes int
+	// SourceConditions maps sources configured with WithSourceCondition to
+	// their normalized conditions.
+	SourceConditions map[Source]SourceCondition
+	// OriginSecretHeader is the WithOriginSecret header, or empty when origin
+	// secrets are not required.
+	OriginSecretHeader string
+	// OriginSecretCount is the number of accepted origin secrets. Secrets
+	// themselves are never described, so rotating one does not change the
+	// fingerprint.
+	OriginSecretCount int
+	// TrustedPeerIdentities renders the WithTrustedPeerIdentities matchers as
+	// labels such as "uri=spiffe://mesh.example/sa/envoy"; subject matchers
+	// render as "subject=custom".
+	TrustedPeerIdentities []string
+	// PeerTrustMode is how peer identities combine with trusted proxies.
+	PeerTrustMode PeerTrustMode
+	// TrustedProxyHosts are the WithTrustedProxyHosts hostnames.
+	TrustedProxyHosts []string
+	// TrustedProxyHostPrefixes are the single-address prefixes the hostnames
+	// resolved to when Describe was called. They are trusted alongside
+	// TrustedProxyPrefixes but change at runtime, so Fingerprint hashes the
+	// hostnames and not these addresses.
+	TrustedProxyHostPrefixes []netip.Prefix
+	// ForwardedParsing is the parse strictness for Forwarded parameters other
+	// than for=.
+	ForwardedParsing ForwardedParsing
+	// XForwardedForParsing is the parse strictness for X-Forwarded-For and
+	// ChainHeaderSource headers.
+	XForwardedForParsing XForwardedForParsing
+	// ForwardedByValidation reports whether RFC 7239 by= checks are enabled.
+	ForwardedByValidation bool
+	// ForwardedByIdentifiers are the normalized, sorted identifiers accepted
+	// as the nearest Forwarded element's by=.
+	ForwardedByIdentifiers []string
+}
+
+// Describe returns the resolver's effective configuration.
+//
+// Use it to verify what a running process actually resolved from options, for
+// example behind a debug endpoint or in startup logs. A nil Resolver returns a
+// zero Description.
+func (r *Resolver) Describe() Description {
+	if r == nil || r.extractor == nil {
+		return Description{}
+	}
+
+	cfg := r.extractor.config
+	return Description{
+		TrustedProxyPrefixes:          clonePrefixes(cfg.trustedProxyCIDRs),
+		MinTrustedProxies:             cfg.minTrustedProxies,
+		MaxTrustedProxies:             cfg.maxTrustedProxies,
+		AllowPrivateIPs:               cfg.allowPrivateIPs,
+		AllowedReservedClientPrefixes: clonePrefixes(cfg.allowReservedClientPrefixes),
+		MaxChainLength:                cfg.maxChainLength,
+		ChainSelection:                cfg.chainSelection,
+		DebugInfo:                     cfg.debugMode,
+		Sources:                       cloneSources(cfg.sourcePriority),
+		ReportOnly:                    cfg.reportOnly,
+		IgnoreUntrustedPeerSources:    cfg.ignoredUntrustedPeerSources(),
+		SkippableFailures:             cfg.describeSourceFailurePolicies(),
+		SourceClientIPPolicies:        cfg.describeSourceClientIPPolicies(),
+		ClientIPValidator:             cfg.clientIP.Validator != nil,
+		RejectedClientPrefixes:        clonePrefixes(cfg.rejectedClientPrefixes),
+		EmbeddedIPv4:                  cfg.embeddedIPv4.describe(),
+		ConsistencyGroups:             cfg.describeConsistencyGroups(),
+		ChainReconciliation:           cfg.chainReconciliation,
+		OpaqueNodes:                   cfg.opaqueNodes,
+		HeaderHygiene:                 cfg.headerHygiene.enabled,
+		MaxHeaderBytes:                cfg.headerHygiene.maxBytes,
+		SourceConditions:              cfg.describeSourceConditions(),
+		OriginSecretHeader:            cfg.originSecret.describeHeader(),
+		OriginSecretCount:             cfg.originSecret.count(),
+		TrustedPeerIdentities:         cfg.peerIdentities.describe(),
+		PeerTrustMode:                 cfg.peerIdentities.describeMode(),
+		TrustedProxyHosts:             cfg.trustedProxyHosts.Hosts(),
+		TrustedProxyHostPrefixes:      cfg.trustedProxyHosts.Prefixes(),
+		ForwardedParsing:              cfg.forwardedParsing,
+		XForwardedForParsing:          cfg.xffParsing,
+		ForwardedByValidation:         cfg.forwardedBy != nil,
+		ForwardedByIdentifiers:        cfg.describeForwardedByIdentifiers(),
+	}
+}
+
+// DescriptionHandler returns a net/http handler that renders Describe as JSON.
+//
+// The output contains trusted ranges and policy settings but no request data.
+// Mount it only on internal or authenticated debug listeners.
+func (r *Resolver) DescriptionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		body, err := json.MarshalIndent(r.Describe(), "", "  ")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(append(body, '\n'))
+	})
+}
+
+// descriptionJSON is the stable wire shape for Description. Field order is
+// part of the fingerprint input, so append new fields rather than reordering.
+type descriptionJSON struct {
+	TrustedProxyPrefixes          []string                       `json:"trusted_proxy_prefixes"`
+	MinTrustedProxies             int                            `json:"min_trusted_proxies"`
+	MaxTrustedProxies             int                            `json:"max_trusted_proxies"`
+	AllowPrivateIPs               bool                           `json:"allow_private_ips"`
+	AllowedReservedClientPrefixes []string                       `json:"allowed_reserved_client_prefixes"`
+	MaxChainLength                int                            `json:"max_chain_length"`
+	ChainSelection                string                         `json:"chain_selection"`
+	DebugInfo                     bool                           `json:"debug_info"`
+	Sources                       []Source                       `json:"sources"`
+	ReportOnly                    bool                           `json:"report_only"`
+	IgnoreUntrustedPeerSources    []Source                       `json:"ignore_untrusted_peer_sources"`
+	SkippableFailures             map[Source][]string            `json:"skippable_failures"`
+	SourceClientIPPolicies        map[Source]clientIPPolicyJSON  `json:"source_client_ip_policies"`
+	ClientIPValidator             bool                           `json:"client_ip_validator"`
+	RejectedClientPrefixes        []string                       `json:"rejected_client_prefixes"`
+	EmbeddedIPv4                  embeddedIPv4JSON               `json:"embedded_ipv4"`
+	ConsistencyGroups             []consistencyGroupJSON         `json:"consistency_groups"`
+	ChainReconciliation           string                         `json:"chain_reconciliation"`
+	OpaqueNodes                   string                         `json:"opaque_nodes"`
+	ForwardedByValidation         bool                           `json:"forwarded_by_validation"`
+	ForwardedByIdentifiers        []string                       `json:"forwarded_by_identifiers"`
+	XForwardedForParsing          string                         `json:"x_forwarded_for_parsing"`
+	ForwardedParsing              string                         `json:"forwarded_parsing"`
+	HeaderHygiene                 bool                           `json:"header_hygiene"`
+	MaxHeaderBytes                int                            `json:"max_header_bytes"`
+	SourceConditions              map[Source]sourceConditionJSON `json:"source_conditions"`
+	OriginSecretHeader            string                         `json:"origin_secret_header"`
+	OriginSecretCount             int                            `json:"origin_secret_count"`
+	TrustedPeerIdentities         []string                       `json:"trusted_peer_identities"`
+	PeerTrustMode                 string                         `json:"peer_trust_mode"`
+	TrustedProxyHosts             []string                       `json:"trusted_proxy_hosts"`
+	TrustedProxyHostPrefixes      []string                       `json:"trusted_proxy_host_prefixes,omitempty"`
+	Fingerprint                   string                         `json:"fingerprint,omitempty"`
+}
+
+type embeddedIPv4JSON struct {
+	NAT64         bool     `json:"nat64"`
+	NAT64Prefixes []string `json:"nat64_prefixes"`
+	SixToFour     bool     `json:"six_to_four"`
+	Teredo        bool     `json:"teredo"`
+}
+
+type consistencyGroupJSON struct {
+	Name    string   `json:"name"`
+	Sources []Source `json:"sources"`
+	Mode    string   `json:"mode"`
+}
+
+type clientIPPolicyJSON struct {
+	Name                          string   `json:"name"`
+	AllowPrivateIPs               bool     `json:"allow_private_ips"`
+	AllowedReservedClientPrefixes []string `json:"allowed_reserved_client_prefixes"`
+}
+
+func (d Description) wire() descriptionJSON {
+	return descriptionJSON{
+		TrustedProxyPrefixes:          prefixStrings(d.TrustedProxyPrefixes),
+		MinTrustedProxies:             d.MinTrustedProxies,
+		MaxTrustedProxies:             d.MaxTrustedProxies,
+		AllowPrivateIPs:               d.AllowPrivateIPs,
+		AllowedReservedClientPrefixes: prefixStrings(d.AllowedReservedClientPrefixes),
+		MaxChainLength:                d.MaxChainLength,
+		ChainSelection:                d.ChainSelection.String(),
+		DebugInfo:                     d.DebugInfo,
+		Sources:                       nonNilSources(d.Sources),
+		ReportOnly:                    d.ReportOnly,
+		IgnoreUntrustedPeerSources:    nonNilSources(d.IgnoreUntrustedPeerSources),
+		SkippableFailures:             resultKindLabels(d.SkippableFailures),
+		SourceClientIPPolicies:        clientIPPolicyWire(d.SourceClientIPPolicies),
+		ClientIPValidator:             d.ClientIPValidator,
+		RejectedClientPrefixes:        prefixStrings(d.RejectedClientPrefixes),
+		EmbeddedIPv4: embeddedIPv4JSON{
+			NAT64:         d.EmbeddedIPv4.NAT64,
+			NAT64Prefixes: prefixStrings(d.EmbeddedIPv4.NAT64Prefixes),
+			SixToFour:     d.EmbeddedIPv4.SixToFour,
+			Teredo:        d.EmbeddedIPv4.Teredo,
+		},
+		ConsistencyGroups:        consistencyGroupWire(d.ConsistencyGroups),
+		ChainReconciliation:      d.ChainReconciliation.String(),
+		OpaqueNodes:              d.OpaqueNodes.String(),
+		ForwardedByValidation:    d.ForwardedByValidation,
+		ForwardedByIdentifiers:   nonNilStrings(d.ForwardedByIdentifiers),
+		XForwardedForParsing:     d.XForwardedForParsing.String(),
+		ForwardedParsing:         d.ForwardedParsing.String(),
+		HeaderHygiene:            d.HeaderHygiene,
+		MaxHeaderBytes:           d.MaxHeaderBytes,
+		SourceConditions:         sourceConditionWire(d.SourceConditions),
+		OriginSecretHeader:       d.OriginSecretHeader,
+		OriginSecretCount:        d.OriginSecretCount,
+		TrustedPeerIdentities:    nonNilStrings(d.TrustedPeerIdentities),
+		PeerTrustMode:            d.PeerTrustMode.String(),
+		TrustedProxyHosts:        nonNilStrings(d.TrustedProxyHosts),
+		TrustedProxyHostPrefixes: prefixStrings(d.TrustedProxyHostPrefixes),
+	}
+}
+
+// Fingerprint returns a stable hex-encoded SHA-256 hash of the description.
+//
+// Prefix sets are hashed in sorted order, so equivalent configurations listed
+// in a different order share a fingerprint. Source order is significant and
+// changes the fingerprint. Compare fingerprints across pods or deploys to
+// confirm they run the same effective policy; fingerprints are only
+// comparable between processes using the same clientip version, because new
+// settings extend the hashed description. TrustedProxyHostPrefixes are not
+// hashed, so DNS changes behind TrustedProxyHosts do not change it.
+func (d Description) Fingerprint() string {
+	canonical := d
+	canonical.TrustedProxyHostPrefixes = nil
+	canonical.TrustedProxyPrefixes = sortedPrefixes(d.TrustedProxyPrefixes)
+	canonical.AllowedReservedClientPrefixes = sortedPrefixes(d.AllowedReservedClientPrefixes)
+	canonical.RejectedClientPrefixes = sortedPrefixes(d.RejectedClientPrefixes)
+	canonical.EmbeddedIPv4.NAT64Prefixes = sortedPrefixes(d.EmbeddedIPv4.NAT64Prefixes)
+	if d.SourceClientIPPolicies != nil {
+		canonical.SourceClientIPPolicies = make(map[Source]ClientIPPolicy, len(d.SourceClientIPPolicies))
+		for source, policy := range d.SourceClientIPPolicies {
+			policy.AllowedReservedClientPrefixes = sortedPrefixes(policy.AllowedReservedClientPrefixes)
+			canonical.SourceClientIPPolicies[source] = policy
+		}
+	}
+
+	// descriptionJSON contains only strings, ints, bools, Sources, and maps
+	// keyed by Source, whose marshaling cannot fail.
+	body, _ := json.Marshal(canonical.wire())
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// MarshalJSON renders the description with snake_case keys, text prefixes and
+// sources, the chain selection label, and the fingerprint.
+func (d Description) MarshalJSON() ([]byte, error) {
+	wire := d.wire()
+	wire.Fingerprint = d.Fingerprint()
+	return json.Marshal(wire)
+}
+
+// describeSourceFailurePolicies returns normalized (sorted, deduplicated)
+// skippable kinds per source.
+func (c *config) describeSourceFailurePolicies() map[Source][]ResultKind {
+	if len(c.sourceFailurePolicies) == 0 {
+		return nil
+	}
+
+	policies := make(map[Source][]ResultKind, len(c.sourceFailurePolicies))
+	for source, kinds := range c.sourceFailurePolicies {
+		policies[source] = newResultKindSet(kinds).kinds()
+	}
+	return policies
+}
+
+// describeSourceClientIPPolicies returns copies of the per-source client-IP
+// policies.
+func (c *config) describeSourceClientIPPolicies() map[Source]ClientIPPolicy {
+	if len(c.sourceClientIPPolicies) == 0 {
+		return nil
+	}
+
+	policies := make(map[Source]ClientIPPolicy, len(c.sourceClientIPPolicies))
+	for source, policy := range c.sourceClientIPPolicies {
+		policies[source] = ClientIPPolicy{
+			Name:                          policy.Name,
+			AllowPrivateIPs:               policy.AllowPrivateIPs,
+			AllowedReservedClientPrefixes: clonePrefixes(policy.AllowReservedClientPrefixes),
+		}
+	}
+	return policies
+}
+
+// describeConsistencyGroups returns copies of the normalized consistency
+// groups in configuration order.
+func (c *config) describeConsistencyGroups() []ConsistencyGroup {
+	if len(c.consistencyGroups) == 0 {
+		return nil
+	}
+
+	groups := make([]ConsistencyGroup, len(c.consistencyGroups))
+	for i, group := range c.consistencyGroups {
+		groups[i] = ConsistencyGroup{Name: group.name, Sources: cloneSources(group.sources), Mode: group.mode}
+	}
+	return groups
+}
+
+func consistencyGroupWire(groups []ConsistencyGroup) []consistencyGroupJSON {
+	wire := make([]consistencyGroupJSON, len(groups))
+	for i, group := range groups {
+		wire[i] = consistencyGroupJSON{Name: group.Name, Sources: nonNilSources(group.Sources), Mode: group.Mode.String()}
+	}
+	return wire
+}
+
+func clientIPPolicyWire(values map[Source]ClientIPPolicy) map[Source]clientIPPolicyJSON {
+	wire := make(map[Source]clientIPPolicyJSON, len(values))
+	for source, policy := range values {
+		wire[source] = clientIPPolicyJSON{
+			Name:                          policy.Name,
+			AllowPrivateIPs:               policy.AllowPrivateIPs,
+			AllowedReservedClientPrefixes: prefixStrings(policy.AllowedReservedClientPrefixes),
+		}
+	}
+	return wire
+}
+
+func resultKindLabels(values map[Source][]ResultKind) map[Source][]string {
+	labels := make(map[Source][]string, len(values))
+	for source, kinds := range values {
+		names := make([]string, len(kinds))
+		for i, kind := range kinds {
+			names[i] = kind.String()
+		}
+		labels[source] = names
+	}
+	return labels
+}
+
+func nonNilSources(sources []Source) []Source {
+	if sources == nil {
+		return []Source{}
+	}
+	return sources
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	values := make([]string, len(prefixes))
+	for i, prefix := range prefixes {
+		values[i] = prefix.String()
+	}
+	return values
+}
+
+func sortedPrefixes(prefixes []netip.Prefix) []netip.Prefix {
+	sorted := clonePrefixes(prefixes)
+	slices.SortFunc(sorted, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	return sorted
+}
@@ -0,0 +1,156 @@
+package clientip
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestResolverDescribe_ReturnsNormalizedConfig(t *testing.T) {
+	resolver, err := New(
+		WithTrustedProxies(
+			netip.MustParsePrefix("10.1.2.3/8"),
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("::1/128"),
+		),
+		WithSources(HeaderSource("x-real-ip"), HeaderSource("cf-connecting-ip"), SourceRemoteAddr),
+		WithMaxChainLength(0),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := resolver.Describe()
+	want := Description{
+		TrustedProxyPrefixes: []netip.Prefix{
+			netip.MustParsePrefix("10.0.0.0/8"),
+			netip.MustParsePrefix("::1/128"),
+		},
+		MaxChainLength: DefaultMaxChainLength,
+		ChainSelection: RightmostUntrustedIP,
+		Sources:        []Source{SourceXRealIP, HeaderSource("CF-Connecting-IP"), SourceRemoteAddr},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b Source) bool { return a == b }), cmp.Comparer(func(a, b netip.Prefix) bool { return a == b })); diff != "" {
+		t.Fatalf("Describe() mismatch (-want +got):\n%s", diff)
+	}
+
+	got.TrustedProxyPrefixes[0] = netip.MustParsePrefix("0.0.0.0/0")
+	got.Sources[0] = SourceForwarded
+	again := resolver.Describe()
+	if again.TrustedProxyPrefixes[0] != netip.MustParsePrefix("10.0.0.0/8") || again.Sources[0] != SourceXRealIP {
+		t.Fatal("mutating a Description changed the resolver snapshot")
+	}
+}
+
+func TestResolverDescribe_NilResolver(t *testing.T) {
+	var resolver *Resolver
+	if got := resolver.Describe(); got.MaxChainLength != 0 || got.Sources != nil {
+		t.Fatalf("nil Describe() = %+v, want zero value", got)
+	}
+}
+
+func TestDescriptionFingerprint(t *testing.T) {
+	build := func(t *testing.T, opts ...Option) string {
+		t.Helper()
+		resolver, err := New(opts...)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		return resolver.Describe().Fingerprint()
+	}
+
+	a := build(t, WithTrustedProxies(mustParseCIDRs(t, "10.0.0.0/8", "127.0.0.0/8")...), WithSources(SourceXForwardedFor, SourceRemoteAddr))
+	b := build(t, WithTrustedProxies(mustParseCIDRs(t, "127.0.0.0/8", "10.0.0.0/8")...), WithSources(SourceXForwardedFor, SourceRemoteAddr))
+	c := build(t, WithTrustedProxies(mustParseCIDRs(t, "10.0.0.0/8", "127.0.0.0/8")...), WithSources(SourceRemoteAddr, SourceXForwardedFor))
+
+	if len(a) != 64 {
+		t.Fatalf("fingerprint length = %d, want 64", len(a))
+	}
+	if a != b {
+		t.Fatalf("prefix order changed fingerprint: %s != %s", a, b)
+	}
+	if a == c {
+		t.Fatal("source order did not change fingerprint")
+	}
+}
+
+func TestResolverDescriptionHandler(t *testing.T) {
+	resolver, err := New(PresetLoopbackReverseProxy(), WithAllowPrivateIPs())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	resolver.DescriptionHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/clientip", nil))
+
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if got := body["chain_selection"]; got != "rightmost_untrusted" {
+		t.Fatalf("chain_selection = %v, want rightmost_untrusted", got)
+	}
+	if got := body["allow_private_ips"]; got != true {
+		t.Fatalf("allow_private_ips = %v, want true", got)
+	}
+	if diff := cmp.Diff([]any{"x_forwarded_for", "remote_addr"}, body["sources"]); diff != "" {
+		t.Fatalf("sources mismatch (-want +got):\n%s", diff)
+	}
+	if got := body["fingerprint"]; got != resolver.Describe().Fingerprint() {
+		t.Fatalf("fingerprint = %v, want %s", got, resolver.Describe().Fingerprint())
+	}
+}
+
+func TestResolverDescribe_SourceClientIPPolicies(t *testing.T) {
+	resolver, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(HeaderSource("x-real-ip"), SourceRemoteAddr),
+		WithSourceClientIPPolicy(SourceXRealIP, ClientIPPolicy{
+			AllowPrivateIPs: true,
+			AllowedReservedClientPrefixes: []netip.Prefix{
+				netip.MustParsePrefix("100.64.1.2/10"),
+				netip.MustParsePrefix("100.64.0.0/10"),
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := resolver.Describe().SourceClientIPPolicies
+	want := map[Source]ClientIPPolicy{
+		SourceXRealIP: {
+			Name:                          "source:x_real_ip",
+			AllowPrivateIPs:               true,
+			AllowedReservedClientPrefixes: []netip.Prefix{netip.MustParsePrefix("100.64.0.0/10")},
+		},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b Source) bool { return a == b }), cmp.Comparer(func(a, b netip.Prefix) bool { return a == b })); diff != "" {
+		t.Fatalf("SourceClientIPPolicies mismatch (-want +got):\n%s", diff)
+	}
+
+	body, err := json.Marshal(resolver.Describe())
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded struct {
+		Policies map[string]struct {
+			Name string `json:"name"`
+		} `json:"source_client_ip_policies"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got := decoded.Policies["x_real_ip"].Name; got != "source:x_real_ip" {
+		t.Fatalf("JSON policy name = %q, want source:x_real_ip", got)
+	}
+}
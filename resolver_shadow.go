@@ -0,0 +1,245 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+)
+
+// Divergence describes a request where a shadow candidate resolver disagreed
+// with the primary resolver.
+type Divergence struct {
+	// Primary is the result returned to the caller.
+	Primary Result
+	// Candidate is the result produced by the candidate resolver.
+	Candidate Result
+	// IPChanged reports whether the resolved IPs differ.
+	IPChanged bool
+	// KindChanged reports whether Result.Classify differs.
+	KindChanged bool
+	// SourceChanged reports whether the result sources differ.
+	SourceChanged bool
+}
+
+// DivergenceObserver receives shadow-resolution divergences.
+//
+// Implementations should be safe for concurrent use. They run synchronously on
+// the request path, so keep them cheap or hand work off asynchronously.
+type DivergenceObserver interface {
+	OnDivergence(ctx context.Context, divergence Divergence)
+}
+
+// DivergenceObserverFunc adapts a function to the DivergenceObserver interface.
+type DivergenceObserverFunc func(ctx context.Context, divergence Divergence)
+
+// OnDivergence implements DivergenceObserver.
+func (f DivergenceObserverFunc) OnDivergence(ctx context.Context, divergence Divergence) {
+	if f == nil {
+		return
+	}
+
+	f(ctx, divergence)
+}
+
+// ShadowOption configures a ShadowResolver.
+type ShadowOption interface {
+	applyShadowOption(*shadowOptions)
+}
+
+type shadowOptionFunc func(*shadowOptions)
+
+func (f shadowOptionFunc) applyShadowOption(c *shadowOptions) { f(c) }
+
+type shadowOptions struct {
+	observer   DivergenceObserver
+	sampleRate float64
+	sample     func() bool
+}
+
+// WithDivergenceObserver sets the observer that receives divergences. It is
+// required.
+func WithDivergenceObserver(observer DivergenceObserver) ShadowOption {
+	return shadowOptionFunc(func(c *shadowOptions) { c.observer = observer })
+}
+
+// WithShadowSampleRate sets the fraction of calls, between 0 and 1, that are
+// also resolved by the candidate. The default is 1, which shadows every call.
+// Unsampled calls skip candidate resolution entirely. Shadow rejects rates
+// outside that range, including NaN.
+func WithShadowSampleRate(rate float64) ShadowOption {
+	return shadowOptionFunc(func(c *shadowOptions) { c.sampleRate = rate })
+}
+
+// ShadowResolver runs a candidate configuration in report-only mode next to a
+// primary Resolver.
+//
+// Every call returns the primary Result unchanged. Sampled calls are also
+// resolved by the candidate, and differences in IP, Result.Classify, or source
+// are reported to the DivergenceObserver. Shadowing does not silence the
+// candidate: for every sampled call it still notifies its own Observer and
+// writes security warnings to its own Logger. Give the candidate a distinct
+// Observer (or none) and Logger to keep metrics and logs separate.
+//
+// ShadowResolver instances are safe for concurrent reuse.
+type ShadowResolver struct {
+	primary   *Resolver
+	candidate *Resolver
+	observer  DivergenceObserver
+	sample    func() bool
+}
+
+// Shadow wraps primary and candidate for safe configuration migrations.
+//
+// Use it before changing trusted ranges or sources to measure impact on real
+// traffic without affecting responses. Shadow returns an error when either
+// resolver is nil, no DivergenceObserver is configured, or the sample rate is
+// outside [0, 1].
+func Shadow(primary, candidate *Resolver, opts ...ShadowOption) (*ShadowResolver, error) {
+	if primary == nil || primary.extractor == nil {
+		return nil, errors.New("shadow primary resolver cannot be nil")
+	}
+	if candidate == nil || candidate.extractor == nil {
+		return nil, errors.New("shadow candidate resolver cannot be nil")
+	}
+
+	cfg := shadowOptions{sampleRate: 1}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt.applyShadowOption(&cfg)
+	}
+
+	if isNilValue(cfg.observer) {
+		return nil, errors.New("shadow divergence observer cannot be nil")
+	}
+	if math.IsNaN(cfg.sampleRate) || cfg.sampleRate < 0 || cfg.sampleRate > 1 {
+		return nil, fmt.Errorf("shadow sample rate must be within [0, 1], got %v", cfg.sampleRate)
+	}
+
+	sample := cfg.sample
+	if sample == nil {
+		sample = rateSampler(cfg.sampleRate)
+	}
+
+	return &ShadowResolver{
+		primary:   primary,
+		candidate: candidate,
+		observer:  cfg.observer,
+		sample:    sample,
+	}, nil
+}
+
+// Resolve resolves req with the primary resolver and, when sampled, compares it
+// with the candidate.
+func (s *ShadowResolver) Resolve(req *http.Request) Result {
+	if s == nil {
+		return Result{Err: errNilResolverExtractor}
+	}
+
+	primary := s.primary.Resolve(req)
+	if req == nil || !s.sample() {
+		return primary
+	}
+
+	s.compare(req.Context(), primary, s.candidate.Resolve(req))
+	return primary
+}
+
+// ResolveInput resolves input with the primary resolver and, when sampled,
+// compares it with the candidate.
+func (s *ShadowResolver) ResolveInput(input Input) Result {
+	if s == nil {
+		return Result{Err: errNilResolverExtractor}
+	}
+
+	primary := s.primary.ResolveInput(input)
+	if !s.sample() {
+		return primary
+	}
+
+	s.compare(requestInputContext(input), primary, s.candidate.ResolveInput(input))
+	return primary
+}
+
+// ResolveOperational resolves req with the primary resolver and fallback and,
+// when sampled, compares it with the candidate using the same fallback.
+func (s *ShadowResolver) ResolveOperational(req *http.Request, fallback Fallback) Result {
+	if s == nil {
+		return Result{Err: errNilResolverExtractor}
+	}
+
+	primary := s.primary.ResolveOperational(req, fallback)
+	if req == nil || !s.sample() {
+		return primary
+	}
+
+	s.compare(req.Context(), primary, s.candidate.ResolveOperational(req, fallback))
+	return primary
+}
+
+// ResolveInputOperational is the ShadowResolver counterpart of
+// Resolver.ResolveInputOperational.
+func (s *ShadowResolver) ResolveInputOperational(input Input, fallback Fallback) Result {
+	if s == nil {
+		return Result{Err: errNilResolverExtractor}
+	}
+
+	primary := s.primary.ResolveInputOperational(input, fallback)
+	if !s.sample() {
+		return primary
+	}
+
+	s.compare(requestInputContext(input), primary, s.candidate.ResolveInputOperational(input, fallback))
+	return primary
+}
+
+// ResolveHeaders is the ShadowResolver counterpart of Resolver.ResolveHeaders.
+func (s *ShadowResolver) ResolveHeaders(ctx context.Context, remoteAddr string, headers http.Header) Result {
+	return s.ResolveInput(Input{Context: ctx, RemoteAddr: remoteAddr, Headers: headers})
+}
+
+// Middleware returns pass-through net/http middleware that stores the primary
+// Result in the request context, like Resolver.Middleware.
+func (s *ShadowResolver) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			result := s.Resolve(req)
+			ctx := context.WithValue(req.Context(), resultContextKey{}, result)
+			next.ServeHTTP(w, req.WithContext(ctx))
+		})
+	}
+}
+
+func (s *ShadowResolver) compare(ctx context.Context, primary, candidate Result) {
+	divergence := Divergence{
+		Primary:       primary,
+		Candidate:     candidate,
+		IPChanged:     primary.IP != candidate.IP,
+		KindChanged:   primary.Classify() != candidate.Classify(),
+		SourceChanged: primary.Source != candidate.Source,
+	}
+	if !divergence.IPChanged && !divergence.KindChanged && !divergence.SourceChanged {
+		return
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.observer.OnDivergence(ctx, divergence)
+}
+
+func rateSampler(rate float64) func() bool {
+	switch {
+	case rate >= 1:
+		return func() bool { return true }
+	case rate <= 0:
+		return func() bool { return false }
+	default:
+		// Sampling only bounds shadow cost; it is not a security decision.
+		return func() bool { return rand.Float64() < rate } //nolint:gosec
+	}
+}
@@ -0,0 +1,228 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type recordingDivergenceObserver struct {
+	divergences []Divergence
+}
+
+func (o *recordingDivergenceObserver) OnDivergence(_ context.Context, divergence Divergence) {
+	o.divergences = append(o.divergences, divergence)
+}
+
+func withShadowSampler(sample func() bool) ShadowOption {
+	return shadowOptionFunc(func(c *shadowOptions) { c.sample = sample })
+}
+
+func mustNewShadowPair(t *testing.T) (*Resolver, *Resolver) {
+	t.Helper()
+
+	primary, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXRealIP, SourceRemoteAddr),
+	)
+	if err != nil {
+		t.Fatalf("New(primary) error = %v", err)
+	}
+
+	candidate, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXForwardedFor, SourceRemoteAddr),
+	)
+	if err != nil {
+		t.Fatalf("New(candidate) error = %v", err)
+	}
+
+	return primary, candidate
+}
+
+func TestShadow_ReportsDivergenceAndReturnsPrimary(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+
+	shadow, err := Shadow(primary, candidate, WithDivergenceObserver(observer))
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "127.0.0.1:8080", Header: make(http.Header)}
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+
+	result := shadow.Resolve(req)
+	if result.Err != nil || result.IP.String() != "8.8.8.8" || result.Source != SourceXRealIP {
+		t.Fatalf("Resolve() = %+v, want primary X-Real-IP result", result)
+	}
+
+	if len(observer.divergences) != 1 {
+		t.Fatalf("divergences = %d, want 1", len(observer.divergences))
+	}
+	divergence := observer.divergences[0]
+	if !divergence.IPChanged || !divergence.SourceChanged || divergence.KindChanged {
+		t.Fatalf("divergence flags = %+v, want IP and source changes only", divergence)
+	}
+	if got := divergence.Candidate.IP.String(); got != "9.9.9.9" {
+		t.Fatalf("candidate IP = %q, want 9.9.9.9", got)
+	}
+}
+
+func TestShadow_NoDivergenceWhenResultsAgree(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+
+	shadow, err := Shadow(primary, candidate, WithDivergenceObserver(observer))
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	result := shadow.ResolveHeaders(context.Background(), "8.8.4.4:443", nil)
+	if result.Err != nil || result.Source != SourceRemoteAddr {
+		t.Fatalf("ResolveHeaders() = %+v, want RemoteAddr success", result)
+	}
+	if len(observer.divergences) != 0 {
+		t.Fatalf("divergences = %d, want 0", len(observer.divergences))
+	}
+}
+
+func TestShadow_ReportsResultKindDivergence(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+
+	shadow, err := Shadow(primary, candidate, WithDivergenceObserver(observer))
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("X-Forwarded-For", "8.8.8.8")
+	shadow.ResolveHeaders(context.Background(), "203.0.113.10:443", headers)
+
+	if len(observer.divergences) != 1 {
+		t.Fatalf("divergences = %d, want 1", len(observer.divergences))
+	}
+	divergence := observer.divergences[0]
+	if !divergence.KindChanged {
+		t.Fatalf("KindChanged = false, want true (%+v)", divergence)
+	}
+	if !errors.Is(divergence.Candidate.Err, ErrUntrustedProxy) {
+		t.Fatalf("candidate error = %v, want ErrUntrustedProxy", divergence.Candidate.Err)
+	}
+}
+
+func TestShadow_ResolveOperational(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+
+	shadow, err := Shadow(primary, candidate, WithDivergenceObserver(observer))
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "8.8.4.4:443", Header: make(http.Header)}
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+
+	result := shadow.ResolveOperational(req, RemoteAddrFallback())
+	if result.Err != nil || result.FallbackUsed || result.Source != SourceRemoteAddr {
+		t.Fatalf("ResolveOperational() = %+v, want primary RemoteAddr success", result)
+	}
+
+	headers := req.Header.Clone()
+	shadow.ResolveInputOperational(Input{RemoteAddr: req.RemoteAddr, Headers: headers}, RemoteAddrFallback())
+
+	if len(observer.divergences) != 2 {
+		t.Fatalf("divergences = %d, want 2", len(observer.divergences))
+	}
+	for _, divergence := range observer.divergences {
+		if !divergence.KindChanged || divergence.IPChanged || divergence.Candidate.Classify() != ResultFallback {
+			t.Fatalf("divergence = %+v, want candidate fallback with the same IP", divergence)
+		}
+	}
+}
+
+func TestShadow_Sampling(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+	candidateObserver := &recordingObserver{}
+	candidate.extractor.config.observer = candidateObserver
+
+	sampled := false
+	shadow, err := Shadow(primary, candidate,
+		WithDivergenceObserver(observer),
+		withShadowSampler(func() bool { return sampled }),
+	)
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "127.0.0.1:8080", Header: make(http.Header)}
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+
+	shadow.Resolve(req)
+	if len(candidateObserver.events) != 0 || len(observer.divergences) != 0 {
+		t.Fatal("unsampled call resolved with candidate")
+	}
+
+	sampled = true
+	shadow.Resolve(req)
+	if len(candidateObserver.events) != 1 || len(observer.divergences) != 1 {
+		t.Fatalf("sampled call events = %d, divergences = %d, want 1 and 1", len(candidateObserver.events), len(observer.divergences))
+	}
+}
+
+func TestShadow_Middleware(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	shadow, err := Shadow(primary, candidate, WithDivergenceObserver(&recordingDivergenceObserver{}))
+	if err != nil {
+		t.Fatalf("Shadow() error = %v", err)
+	}
+
+	var got Result
+	handler := shadow.Middleware()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "127.0.0.1:8080"
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got.Source != SourceXRealIP {
+		t.Fatalf("context result source = %v, want %v", got.Source, SourceXRealIP)
+	}
+}
+
+func TestShadow_Validation(t *testing.T) {
+	primary, candidate := mustNewShadowPair(t)
+	observer := &recordingDivergenceObserver{}
+
+	tests := []struct {
+		name      string
+		primary   *Resolver
+		candidate *Resolver
+		opts      []ShadowOption
+	}{
+		{name: "nil primary", candidate: candidate, opts: []ShadowOption{WithDivergenceObserver(observer)}},
+		{name: "nil candidate", primary: primary, opts: []ShadowOption{WithDivergenceObserver(observer)}},
+		{name: "missing observer", primary: primary, candidate: candidate},
+		{name: "typed nil observer", primary: primary, candidate: candidate, opts: []ShadowOption{WithDivergenceObserver((*recordingDivergenceObserver)(nil))}},
+		{name: "sample rate too high", primary: primary, candidate: candidate, opts: []ShadowOption{WithDivergenceObserver(observer), WithShadowSampleRate(1.5)}},
+		{name: "negative sample rate", primary: primary, candidate: candidate, opts: []ShadowOption{WithDivergenceObserver(observer), WithShadowSampleRate(-0.1)}},
+		{name: "NaN sample rate", primary: primary, candidate: candidate, opts: []ShadowOption{WithDivergenceObserver(observer), WithShadowSampleRate(math.NaN())}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Shadow(tt.primary, tt.candidate, tt.opts...); err == nil {
+				t.Fatal("Shadow() error = nil, want error")
+			}
+		})
+	}
+}
@@ -366,3 +366,124 @@ func TestResolveInputOperational_RemoteAddrFallback(t *testing.T) {
 		t.Fatalf("Classify() = %v, want %v", got, want)
 	}
 }
+
+func TestResolve_ReportOnlyReturnsPeerAndWouldFail(t *testing.T) {
+	logger := &capturedLogger{}
+	observer := &recordingObserver{}
+	resolver, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXForwardedFor, SourceRemoteAddr),
+		WithLogger(logger),
+		WithObserver(observer),
+		WithReportOnly(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "8.8.4.4:443", Header: make(http.Header)}
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+
+	result := resolver.Resolve(req)
+	if result.Err != nil {
+		t.Fatalf("Resolve() error = %v, want nil", result.Err)
+	}
+	if !errors.Is(result.WouldFail, ErrUntrustedProxy) {
+		t.Fatalf("WouldFail = %v, want ErrUntrustedProxy", result.WouldFail)
+	}
+	if result.IP != netip.MustParseAddr("8.8.4.4") || result.Source != SourceRemoteAddr {
+		t.Fatalf("Resolve() = %v from %v, want peer 8.8.4.4 from remote_addr", result.IP, result.Source)
+	}
+	if got := result.WouldFailSource(); got != SourceXForwardedFor {
+		t.Fatalf("WouldFailSource() = %v, want %v", got, SourceXForwardedFor)
+	}
+	if got := result.Classify(); got != ResultReportOnly {
+		t.Fatalf("Classify() = %v, want %v", got, ResultReportOnly)
+	}
+	if got := result.WouldFailKind(); got != ResultUntrusted {
+		t.Fatalf("WouldFailKind() = %v, want %v", got, ResultUntrusted)
+	}
+
+	if len(observer.events) != 1 || !errors.Is(observer.events[0].result.WouldFail, ErrUntrustedProxy) {
+		t.Fatalf("observer events = %+v, want one report-only result", observer.events)
+	}
+
+	entries := logger.snapshot()
+	if len(entries) != 1 {
+		t.Fatalf("logged entries = %d, want 1", len(entries))
+	}
+	assertAttr(t, entries[0].attrs, "event", SecurityEventUntrustedProxy)
+	assertAttr(t, entries[0].attrs, "report_only", true)
+}
+
+func TestResolve_ReportOnlyReplacesChainMetadata(t *testing.T) {
+	resolver, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXRealIP, SourceXForwardedFor),
+		WithUntrustedPeerPolicy(SourceXRealIP, UntrustedPeerIgnore),
+		WithDebugInfo(),
+		WithReportOnly(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("X-Forwarded-For", "garbage, 127.0.0.2")
+	result := resolver.ResolveHeaders(context.Background(), "127.0.0.1:443", headers)
+
+	if result.Err != nil || !errors.Is(result.WouldFail, ErrInvalidIP) {
+		t.Fatalf("ResolveHeaders() = %+v, want report-only invalid XFF", result)
+	}
+	if result.IP != netip.MustParseAddr("127.0.0.1") || result.Source != SourceRemoteAddr || result.WouldFailSource() != SourceXForwardedFor {
+		t.Fatalf("ResolveHeaders() = %v from %v failing %v, want peer from remote_addr failing x_forwarded_for", result.IP, result.Source, result.WouldFailSource())
+	}
+	if result.TrustedProxyCount != 0 || result.DebugInfo != nil {
+		t.Fatalf("ResolveHeaders() = %+v, want chain metadata of the failed attempt cleared", result)
+	}
+	if result.Classify() != ResultReportOnly || result.WouldFailKind() != ResultInvalid {
+		t.Fatalf("Classify() = %v, WouldFailKind() = %v, want report_only and invalid", result.Classify(), result.WouldFailKind())
+	}
+
+	headers.Set("X-Real-IP", "1.2.3.4")
+	headers.Set("X-Forwarded-For", "9.9.9.9")
+	result = resolver.ResolveHeaders(context.Background(), "8.8.4.4:443", headers)
+	if !result.SpoofAttemptIgnored || result.WouldFailSource() != SourceXForwardedFor || result.WouldFailKind() != ResultUntrusted {
+		t.Fatalf("ResolveHeaders(untrusted peer) = %+v, want ignored spoof attempt kept with failed source", result)
+	}
+	if kind := (Result{}).WouldFailKind(); kind != ResultSuccess {
+		t.Fatalf("zero Result WouldFailKind() = %v, want %v", kind, ResultSuccess)
+	}
+	if source := (Result{}).WouldFailSource(); source != (Source{}) {
+		t.Fatalf("zero Result WouldFailSource() = %v, want zero Source", source)
+	}
+}
+
+func TestResolve_ReportOnlyKeepsSuccessAndTerminalErrors(t *testing.T) {
+	resolver, err := New(
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXForwardedFor),
+		WithReportOnly(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := &http.Request{RemoteAddr: "127.0.0.1:443", Header: make(http.Header)}
+	req.Header.Set("X-Forwarded-For", "9.9.9.9")
+	if result := resolver.Resolve(req); result.Err != nil || result.WouldFail != nil || result.Classify() != ResultSuccess {
+		t.Fatalf("Resolve() = %+v, want plain success", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if result := resolver.Resolve(req.WithContext(ctx)); !errors.Is(result.Err, context.Canceled) || result.WouldFail != nil {
+		t.Fatalf("Resolve(canceled) = %+v, want context.Canceled", result)
+	}
+
+	unparsable := &http.Request{RemoteAddr: "not-an-ip", Header: make(http.Header)}
+	unparsable.Header.Set("X-Forwarded-For", "9.9.9.9")
+	if result := resolver.Resolve(unparsable); !errors.Is(result.Err, ErrUntrustedProxy) || result.WouldFail != nil {
+		t.Fatalf("Resolve(unparsable peer) = %+v, want strict ErrUntrustedProxy", result)
+	}
+}
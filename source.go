@@ -17,6 +17,8 @@ const (
 	sourceRemoteAddr
 	sourceStaticFallback
 	sourceHeader
+	sourceCustom
+	sourceChainHeader
 )
 
 const (
@@ -27,6 +29,10 @@ const (
 	builtinSourceNameStaticFallback = "static_fallback"
 )
 
+// chainSourcePrefix marks the text form of a ChainHeaderSource. Header names
+// cannot contain ':', so the prefix never collides with a header name.
+const chainSourcePrefix = "chain:"
+
 // Exported source identifiers for comparison and display.
 //
 // These are vars because Go does not support const structs. Do not reassign
@@ -50,13 +56,16 @@ var (
 // Source identifies one extraction source in priority order.
 //
 // Construct Source values with the built-in variables (SourceForwarded,
-// SourceXForwardedFor, ...) or HeaderSource for custom headers. Sources stored
-// by the resolver are canonicalized at construction time, so == comparison
-// against a built-in or HeaderSource-produced value is reliable. Use Equal when
+// SourceXForwardedFor, ...), HeaderSource for custom headers, ChainHeaderSource
+// for custom comma-separated chain headers, or CustomSource for
+// application-defined extractors. Sources stored by the resolver are
+// canonicalized at construction time, so == comparison against a built-in,
+// HeaderSource-, or ChainHeaderSource-produced value is reliable. Use Equal when
 // comparing values that may not yet be canonical (for example, raw user input).
 type Source struct {
 	kind       sourceKind
 	headerName string
+	custom     *customSource
 }
 
 func builtinSource(kind sourceKind) Source {
@@ -73,12 +82,43 @@ func HeaderSource(name string) Source {
 	return sourceFromString(name)
 }
 
+// ChainHeaderSource returns a source backed by a custom header carrying a
+// comma-separated proxy chain, such as X-Original-Forwarded-For or
+// X-Envoy-External-Address.
+//
+// The header is parsed like X-Forwarded-For and the client is selected with the
+// configured ChainSelection, trusted proxies, and trusted-proxy count limits.
+// The name is canonicalized like HeaderSource. "X-Forwarded-For" and
+// "Forwarded" resolve to SourceXForwardedFor and SourceForwarded, and an empty
+// name or a non-header built-in name produces an invalid Source that New
+// rejects when used in WithSources.
+//
+// Chain header sources serialize as "chain:" followed by the header name, so
+// Source.UnmarshalText and the SOURCES binding round-trip them.
+func ChainHeaderSource(name string) Source {
+	source := sourceFromString(name)
+	switch source.kind {
+	case sourceForwarded, sourceXForwardedFor, sourceChainHeader:
+		return source
+	case sourceHeader:
+		return Source{kind: sourceChainHeader, headerName: source.headerName}
+	case sourceXRealIP:
+		return Source{kind: sourceChainHeader, headerName: textproto.CanonicalMIMEHeaderKey("X-Real-IP")}
+	default:
+		return Source{}
+	}
+}
+
 func canonicalSource(source Source) Source {
 	switch source.kind {
 	case sourceForwarded, sourceXForwardedFor, sourceXRealIP, sourceRemoteAddr, sourceStaticFallback:
 		return source
 	case sourceHeader:
 		return sourceFromString(source.headerName)
+	case sourceCustom:
+		return source
+	case sourceChainHeader:
+		return ChainHeaderSource(source.headerName)
 	default:
 		return Source{}
 	}
@@ -95,6 +135,9 @@ func sourceFromString(name string) Source {
 	if raw == "" {
 		return Source{}
 	}
+	if header, ok := strings.CutPrefix(raw, chainSourcePrefix); ok {
+		return ChainHeaderSource(header)
+	}
 
 	switch normalizeSourceName(raw) {
 	case builtinSourceNameForwarded:
@@ -144,7 +187,9 @@ func canonicalizeSources(sources []Source) []Source {
 // String returns the canonical source identifier.
 //
 // Built-in sources use stable snake_case identifiers. Custom header sources use
-// a lower-case, underscore-separated form of the canonical header name.
+// a lower-case, underscore-separated form of the canonical header name, and
+// chain header sources add the "chain:" prefix to that form so they stay
+// distinct from a HeaderSource for the same header in logs and metrics.
 func (s Source) String() string {
 	return s.name()
 }
@@ -171,15 +216,25 @@ func (s Source) name() string {
 		return builtinSourceNameStaticFallback
 	case sourceHeader:
 		return normalizeSourceName(s.headerName)
+	case sourceChainHeader:
+		return chainSourcePrefix + normalizeSourceName(s.headerName)
+	case sourceCustom:
+		if s.custom == nil {
+			return ""
+		}
+		return s.custom.name
 	default:
 		return ""
 	}
 }
 
 func (s Source) valid() bool {
-	if s.kind == sourceHeader {
+	if s.kind == sourceHeader || s.kind == sourceChainHeader {
 		return s.headerName != ""
 	}
+	if s.kind == sourceCustom {
+		return s.custom != nil && s.custom.name != "" && s.custom.extractor != nil
+	}
 
 	return s.kind == sourceForwarded ||
 		s.kind == sourceXForwardedFor ||
@@ -196,16 +251,32 @@ func (s Source) headerKey() (string, bool) {
 		return "X-Forwarded-For", true
 	case sourceXRealIP:
 		return "X-Real-IP", true
-	case sourceRemoteAddr, sourceStaticFallback, sourceInvalid:
+	case sourceRemoteAddr, sourceStaticFallback, sourceCustom, sourceInvalid:
 		return "", false
 	default:
 		return s.headerName, true
 	}
 }
 
+// peerChecked reports whether the source is only honored when the immediate
+// peer is a trusted proxy.
+func (s Source) peerChecked() bool {
+	switch s.kind {
+	case sourceRemoteAddr, sourceStaticFallback, sourceInvalid:
+		return false
+	case sourceCustom:
+		return s.custom != nil && !s.custom.anyPeer
+	default:
+		return true
+	}
+}
+
 func (s Source) marshalValue() string {
-	if s.kind == sourceHeader {
+	switch s.kind {
+	case sourceHeader:
 		return s.headerName
+	case sourceChainHeader:
+		return chainSourcePrefix + s.headerName
 	}
 
 	return s.String()
@@ -214,12 +285,14 @@ func (s Source) marshalValue() string {
 // MarshalText returns a stable text form for the source.
 //
 // Built-in sources serialize as canonical identifiers. Custom header sources
-// serialize as canonical MIME header names so they can be losslessly parsed.
+// serialize as canonical MIME header names, and chain header sources as
+// "chain:" plus the header name, so they can be losslessly parsed.
 func (s Source) MarshalText() ([]byte, error) {
 	return []byte(s.marshalValue()), nil
 }
 
-// UnmarshalText parses a source from a built-in alias or header name.
+// UnmarshalText parses a source from a built-in alias, header name, or
+// "chain:"-prefixed chain header name.
 //
 // Empty input produces an invalid Source; New rejects invalid sources in
 // WithSources.
@@ -1,20 +1,29 @@
 package clientip
 
 import (
+	"errors"
+	"fmt"
 	"net/netip"
 	"slices"
 	"strings"
 )
 
 type chainPolicy struct {
-	headerName        string
-	parseValues       func([]string) ([]string, error)
+	headerName  string
+	parseValues func([]string) ([]string, error)
+	// parseTolerant, when set, replaces parseValues and also returns the
+	// syntax defects it tolerated.
+	parseTolerant     func([]string) ([]string, []error, error)
 	parseClientIP     func(string) netip.Addr
 	clientIP          clientIPPolicy
 	trustedProxy      proxyPolicy
 	selection         ChainSelection
 	collectDebugInfo  bool
 	untrustedChainSep string
+	// forwardedBy enables RFC 7239 by= validation; it is set only for
+	// SourceForwarded.
+	forwardedBy *forwardedByPolicy
+	hygiene     headerHygiene
 }
 
 type chainExtractor struct {
@@ -30,11 +39,10 @@ func (e chainExtractor) extract(req requestView, source Source) (Extraction, *ex
 		return Extraction{}, errSourceUnavailable, nil
 	}
 
-	if len(e.policy.trustedProxy.TrustedProxyCIDRs) > 0 {
+	if e.policy.trustedProxy.checksPeer() {
 		// Do not inspect spoofable header content until the immediate peer is
-		// a configured trusted proxy.
-		remoteIP := parseRemoteAddr(req.remoteAddr())
-		if !isTrustedProxy(remoteIP, e.policy.trustedProxy.TrustedProxyMatch, e.policy.trustedProxy.TrustedProxyCIDRs) {
+		// trusted by address or identity.
+		if !e.policy.trustedProxy.trustsPeer(req) {
 			return Extraction{}, &extractionFailure{
 				kind:              failureUntrustedProxy,
 				source:            source,
@@ -46,7 +54,24 @@ func (e chainExtractor) extract(req requestView, source Source) (Extraction, *ex
 		}
 	}
 
-	parts, err := e.policy.parseValues(headerValues)
+	if failure := e.policy.trustedProxy.OriginSecret.check(req, source); failure != nil {
+		return Extraction{}, failure, nil
+	}
+
+	if failure := e.policy.hygiene.check(source, e.policy.headerName, headerValues); failure != nil {
+		return Extraction{}, failure, nil
+	}
+
+	var (
+		parts   []string
+		defects []error
+		err     error
+	)
+	if e.policy.parseTolerant != nil {
+		parts, defects, err = e.policy.parseTolerant(headerValues)
+	} else {
+		parts, err = e.policy.parseValues(headerValues)
+	}
 	if err != nil {
 		return Extraction{}, nil, err
 	}
@@ -66,7 +91,37 @@ func (e chainExtractor) extract(req requestView, source Source) (Extraction, *ex
 		}, nil
 	}
 
+	if e.policy.forwardedBy != nil {
+		if failure := e.checkForwardedBy(req, source, headerValues, parts); failure != nil {
+			failure.trustedProxyCount = analysis.TrustedCount
+			return Extraction{}, failure, nil
+		}
+	}
+
 	clientIPStr := parts[analysis.ClientIndex]
+	if !clientIP.IsValid() && isOpaqueNode(clientIPStr) {
+		switch e.policy.trustedProxy.OpaqueNodes {
+		case OpaqueNodeTerminal:
+			return Extraction{}, &extractionFailure{
+				kind:                failureInvalidClientIP,
+				source:              source,
+				chain:               strings.Join(parts, ", "),
+				index:               analysis.ClientIndex,
+				extractedIP:         clientIPStr,
+				trustedProxyCount:   analysis.TrustedCount,
+				clientIPDisposition: clientIPOpaque,
+			}, nil
+		case OpaqueNodeAnonymous:
+			result := Extraction{
+				TrustedProxyCount: analysis.TrustedCount,
+				Source:            source,
+				AnonymousNode:     clientIPStr,
+				ParseDefectErr:    joinParseDefects(defects, source),
+			}
+			return e.withDebugInfo(result, parts, analysis), nil, nil
+		}
+	}
+	clientIP, wrapper := e.policy.clientIP.embedded.unwrap(clientIP)
 	disposition := evaluateClientIP(clientIP, e.policy.clientIP)
 	if disposition != clientIPValid {
 		return Extraction{}, &extractionFailure{
@@ -77,25 +132,62 @@ func (e chainExtractor) extract(req requestView, source Source) (Extraction, *ex
 			extractedIP:         clientIPStr,
 			trustedProxyCount:   analysis.TrustedCount,
 			clientIPDisposition: disposition,
+			clientIPPolicy:      e.policy.clientIP.rejectionName(clientIP),
+		}, nil
+	}
+
+	clientIP = normalizeIP(clientIP)
+	if err := e.policy.clientIP.validate(req.context(), clientIP, source); err != nil {
+		return Extraction{}, &extractionFailure{
+			kind:              failureClientIPRejected,
+			source:            source,
+			chain:             strings.Join(parts, ", "),
+			index:             analysis.ClientIndex,
+			extractedIP:       clientIPStr,
+			trustedProxyCount: analysis.TrustedCount,
+			rejection:         err,
+			clientIPPolicy:    e.policy.clientIP.rejectionName(clientIP),
 		}, nil
 	}
 
 	result := Extraction{
-		IP:                normalizeIP(clientIP),
+		IP:                clientIP,
 		TrustedProxyCount: analysis.TrustedCount,
 		Source:            source,
+		WrapperIP:         wrapper,
+		ParseDefectErr:    joinParseDefects(defects, source),
 	}
+	return e.withDebugInfo(result, parts, analysis), nil, nil
+}
+
+// withDebugInfo attaches parsed chain details to a successful result when
+// they are collected. DebugInfo is success-only so failed requests do not
+// carry extra parsed attacker-controlled chain details through Result by
+// default.
+func (e chainExtractor) withDebugInfo(result Extraction, parts []string, analysis chainAnalysis) Extraction {
 	if e.policy.collectDebugInfo {
-		// DebugInfo is success-only so failed requests do not carry extra
-		// parsed attacker-controlled chain details through Result by default.
 		result.DebugInfo = &ChainDebugInfo{
 			FullChain:      slices.Clone(parts),
 			ClientIndex:    analysis.ClientIndex,
 			TrustedIndices: slices.Clone(analysis.TrustedIndices),
+			OpaqueIndices:  e.opaqueIndices(parts),
 		}
 	}
+	return result
+}
 
-	return result, nil, nil
+// joinParseDefects wraps tolerated Forwarded defects for
+// Extraction.ParseDefectErr.
+func joinParseDefects(defects []error, source Source) error {
+	if len(defects) == 0 {
+		return nil
+	}
+
+	wrapped := make([]error, len(defects))
+	for i, defect := range defects {
+		wrapped[i] = &ExtractionError{Err: fmt.Errorf("%w: %w", ErrInvalidForwardedHeader, defect), Source: source}
+	}
+	return errors.Join(wrapped...)
 }
 
 func (e chainExtractor) analyzeChain(parts []string) (chainAnalysis, netip.Addr, error) {
@@ -111,6 +203,22 @@ func (e chainExtractor) analyzeChain(parts []string) (chainAnalysis, netip.Addr,
 	return analyzeChainRightmost(parts, e.policy.trustedProxy, e.policy.collectDebugInfo, parseClientIP)
 }
 
+// opaqueIndices lists the chain entries that are opaque nodes.
+func (e chainExtractor) opaqueIndices(parts []string) []int {
+	parseClientIP := e.policy.parseClientIP
+	if parseClientIP == nil {
+		parseClientIP = parseIP
+	}
+
+	var indices []int
+	for i, part := range parts {
+		if !parseClientIP(part).IsValid() && isOpaqueNode(part) {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
 func (e chainExtractor) chainSeparator() string {
 	if e.policy.untrustedChainSep != "" {
 		return e.policy.untrustedChainSep
@@ -511,3 +511,56 @@ func TestChainExtractor_IPv6InChain(t *testing.T) {
 		t.Errorf("IP = %v, want %v", result.IP, wantIP)
 	}
 }
+
+func TestExtract_ChainHeaderSource(t *testing.T) {
+	original := ChainHeaderSource("X-Original-Forwarded-For")
+
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.MaxChainLength = 3
+	cfg.Sources = []Source{original, SourceXForwardedFor, SourceRemoteAddr}
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name        string
+		original    []string
+		xff         string
+		want        extractionState
+		wantTrusted int
+		wantErr     error
+	}{
+		{name: "trusted suffix skipped", original: []string{"1.1.1.1, 8.8.8.8", "10.0.0.2"}, xff: "9.9.9.9", want: extractionState{HasIP: true, IP: "8.8.8.8", Source: original}, wantTrusted: 1},
+		{name: "falls through to xff", xff: "9.9.9.9", want: extractionState{HasIP: true, IP: "9.9.9.9", Source: SourceXForwardedFor}},
+		{name: "chain too long", original: []string{"1.1.1.1, 2.2.2.2, 3.3.3.3, 4.4.4.4"}, want: extractionState{Source: original}, wantErr: ErrChainTooLong},
+		{name: "invalid client", original: []string{"garbage"}, want: extractionState{Source: original}, wantErr: ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest("10.0.0.1:443", "")
+			for _, value := range tt.original {
+				req.Header.Add("X-Original-Forwarded-For", value)
+			}
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := extractionStateOf(result); got != tt.want {
+				t.Fatalf("extraction = %+v, want %+v", got, tt.want)
+			}
+			if result.TrustedProxyCount != tt.wantTrusted {
+				t.Fatalf("TrustedProxyCount = %d, want %d", result.TrustedProxyCount, tt.wantTrusted)
+			}
+		})
+	}
+
+	req := newTestRequest("5.5.5.5:443", "")
+	req.Header.Set("X-Original-Forwarded-For", "8.8.8.8")
+	if _, err := extractor.Extract(req); !errors.Is(err, ErrUntrustedProxy) {
+		t.Fatalf("untrusted peer error = %v, want ErrUntrustedProxy", err)
+	}
+}
@@ -0,0 +1,229 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ChainReconciliation controls how a resolver configured with both
+// SourceForwarded and SourceXForwardedFor combines the two chains.
+type ChainReconciliation uint8
+
+const (
+	// ChainReconcileOff rejects configuring both chain headers. This is the
+	// default.
+	ChainReconcileOff ChainReconciliation = iota
+	// ChainReconcileRequireAgreement parses both chains when both headers are
+	// present and accepts the result only when they select the same client.
+	// A disagreement, or a failure of either chain, fails resolution.
+	ChainReconcileRequireAgreement
+	// ChainReconcilePreferForwarded uses the Forwarded result when both
+	// headers are present. A different X-Forwarded-For client is logged and
+	// recorded in Result.ConsistencyErr.
+	ChainReconcilePreferForwarded
+	// ChainReconcilePreferXForwardedFor uses the X-Forwarded-For result when
+	// both headers are present. A different Forwarded client is logged and
+	// recorded in Result.ConsistencyErr.
+	ChainReconcilePreferXForwardedFor
+)
+
+// String returns the stable label for m.
+func (m ChainReconciliation) String() string {
+	switch m {
+	case ChainReconcileOff:
+		return "off"
+	case ChainReconcileRequireAgreement:
+		return "require_agreement"
+	case ChainReconcilePreferForwarded:
+		return "prefer_forwarded"
+	case ChainReconcilePreferXForwardedFor:
+		return "prefer_x_forwarded_for"
+	default:
+		return "unknown"
+	}
+}
+
+func (m ChainReconciliation) valid() bool {
+	return m <= ChainReconcilePreferXForwardedFor
+}
+
+// preferred returns the source that wins a disagreement, or the zero Source
+// when both chains must agree.
+func (m ChainReconciliation) preferred() Source {
+	switch m {
+	case ChainReconcilePreferForwarded:
+		return builtinSource(sourceForwarded)
+	case ChainReconcilePreferXForwardedFor:
+		return builtinSource(sourceXForwardedFor)
+	default:
+		return Source{}
+	}
+}
+
+// WithChainReconciliation allows SourceForwarded and SourceXForwardedFor in the
+// same WithSources list and sets how their chains are reconciled.
+//
+// This is intended for migrations between proxies, when requests carry both
+// headers. When only one header is present it is used on its own. When both
+// are present, both chains are parsed and validated against the trusted
+// proxies; the hop where they first diverge, counted from the nearest proxy,
+// is reported in the inconsistent_sources security event. With
+// ChainReconcileRequireAgreement a different selected client fails with a
+// ConsistencyError; with a Prefer mode the preferred header wins and the
+// discrepancy is logged and recorded in Result.ConsistencyErr.
+func WithChainReconciliation(mode ChainReconciliation) Option {
+	return optionFunc(func(c *options) { c.ChainReconciliation = mode })
+}
+
+func (c *config) validateChainReconciliation(seenForwarded, seenXFF bool) error {
+	if !c.chainReconciliation.valid() {
+		return fmt.Errorf("invalid chain reconciliation %d", c.chainReconciliation)
+	}
+	if c.chainReconciliation == ChainReconcileOff {
+		if seenForwarded && seenXFF {
+			return fmt.Errorf("priority cannot include both %q and %q; choose one proxy chain header or use WithChainReconciliation", builtinSource(sourceForwarded), builtinSource(sourceXForwardedFor))
+		}
+		return nil
+	}
+	if !seenForwarded || !seenXFF {
+		return fmt.Errorf("chain reconciliation %q requires both %q and %q in the priority list", c.chainReconciliation, builtinSource(sourceForwarded), builtinSource(sourceXForwardedFor))
+	}
+	return nil
+}
+
+// buildChainPartners links the Forwarded and X-Forwarded-For sources to each
+// other when reconciliation is enabled.
+func (e *extractor) buildChainPartners() {
+	if e.config.chainReconciliation == ChainReconcileOff {
+		return
+	}
+
+	forwarded, xff := -1, -1
+	for i := range e.sources {
+		switch e.sources[i].source.kind {
+		case sourceForwarded:
+			forwarded = i
+		case sourceXForwardedFor:
+			xff = i
+		}
+	}
+	if forwarded < 0 || xff < 0 {
+		return
+	}
+	e.sources[forwarded].chainPartner = xff
+	e.sources[xff].chainPartner = forwarded
+}
+
+// reconcileChains combines the outcome of source with its partner chain
+// header. result and err are source's own outcome, which is returned
+// unchanged when the partner header is absent.
+func (e *extractor) reconcileChains(r requestView, source *configuredSource, result Extraction, err error) (Extraction, error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return result, err
+	}
+
+	partner := &e.sources[source.chainPartner]
+	other, otherErr := e.extractSource(r, partner)
+	if errors.Is(otherErr, ErrSourceUnavailable) {
+		return e.stripReconcileDebugInfo(result), err
+	}
+	if errors.Is(otherErr, context.Canceled) || errors.Is(otherErr, context.DeadlineExceeded) {
+		return Extraction{}, otherErr
+	}
+
+	mode := e.config.chainReconciliation
+	winner, winnerResult, winnerErr := source, result, err
+	loser, loserResult, loserErr := partner, other, otherErr
+	if preferred := mode.preferred(); preferred.valid() && partner.source == preferred {
+		winner, winnerResult, winnerErr = partner, other, otherErr
+		loser, loserResult, loserErr = source, result, err
+	}
+
+	if winnerErr != nil {
+		if !winnerResult.Source.valid() {
+			winnerResult.Source = winner.source
+		}
+		return winnerResult, winnerErr
+	}
+	if loserErr != nil {
+		if mode == ChainReconcileRequireAgreement {
+			if !loserResult.Source.valid() {
+				loserResult.Source = loser.source
+			}
+			return loserResult, loserErr
+		}
+		// The loser's own failure was already logged while adapting it.
+		return e.stripReconcileDebugInfo(winnerResult), nil
+	}
+
+	if winnerResult.IP == loserResult.IP {
+		return e.stripReconcileDebugInfo(winnerResult), nil
+	}
+
+	mismatch := &ConsistencyError{
+		ExtractionError:   ExtractionError{Err: ErrInconsistentSources, Source: winner.source},
+		Group:             chainReconciliationGroup,
+		IP:                winnerResult.IP,
+		ConflictingSource: loser.source,
+		ConflictingIP:     loserResult.IP,
+	}
+	e.logSecurityWarning(
+		r, winner.source, SecurityEventInconsistentSources, "Forwarded and X-Forwarded-For chains disagree",
+		"group", chainReconciliationGroup,
+		"mode", mode.String(),
+		"ip", winnerResult.IP.String(),
+		"conflicting_source", loser.source.String(),
+		"conflicting_ip", loserResult.IP.String(),
+		"hop", divergentHop(winnerResult.DebugInfo, winner.source, loserResult.DebugInfo, loser.source),
+	)
+	if mode == ChainReconcileRequireAgreement {
+		return Extraction{Source: winner.source}, mismatch
+	}
+
+	winnerResult = e.stripReconcileDebugInfo(winnerResult)
+	winnerResult.ConsistencyErr = mismatch
+	return winnerResult, nil
+}
+
+// chainReconciliationGroup names Forwarded/X-Forwarded-For reconciliation in
+// ConsistencyError.Group and logs.
+const chainReconciliationGroup = "chain_reconciliation"
+
+// stripReconcileDebugInfo drops the chain details collected for hop
+// comparison unless WithDebugInfo is enabled.
+func (e *extractor) stripReconcileDebugInfo(result Extraction) Extraction {
+	if !e.config.debugMode {
+		result.DebugInfo = nil
+	}
+	return result
+}
+
+// divergentHop returns the index, counted from the nearest proxy, of the first
+// hop where the two chains differ, or -1 when they are identical.
+func divergentHop(a *ChainDebugInfo, aSource Source, b *ChainDebugInfo, bSource Source) int {
+	if a == nil || b == nil {
+		return -1
+	}
+
+	for hop := 0; hop < len(a.FullChain) || hop < len(b.FullChain); hop++ {
+		if hop >= len(a.FullChain) || hop >= len(b.FullChain) {
+			return hop
+		}
+		aIP := chainHopAddr(aSource, a.FullChain[len(a.FullChain)-1-hop])
+		bIP := chainHopAddr(bSource, b.FullChain[len(b.FullChain)-1-hop])
+		if aIP != bIP || (!aIP.IsValid() && !strings.EqualFold(a.FullChain[len(a.FullChain)-1-hop], b.FullChain[len(b.FullChain)-1-hop])) {
+			return hop
+		}
+	}
+	return -1
+}
+
+func chainHopAddr(source Source, part string) netip.Addr {
+	if source.kind == sourceForwarded {
+		return normalizeIP(parseChainIP(part))
+	}
+	return normalizeIP(parseIP(part))
+}
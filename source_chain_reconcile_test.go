@@ -0,0 +1,129 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestExtract_ChainReconciliation(t *testing.T) {
+	tests := []struct {
+		name       string
+		mode       ChainReconciliation
+		forwarded  string
+		xff        string
+		wantIP     string
+		wantSource Source
+		wantErr    error
+		wantWarn   bool
+		wantHop    int
+	}{
+		{name: "agree", mode: ChainReconcileRequireAgreement, forwarded: "for=8.8.8.8, for=10.0.0.2", xff: "8.8.8.8, 10.0.0.2", wantIP: "8.8.8.8", wantSource: SourceForwarded},
+		{name: "agree on client with different proxies", mode: ChainReconcileRequireAgreement, forwarded: "for=8.8.8.8", xff: "8.8.8.8, 10.0.0.2", wantIP: "8.8.8.8", wantSource: SourceForwarded},
+		{name: "only xff present", mode: ChainReconcileRequireAgreement, xff: "8.8.8.8", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "disagree rejects", mode: ChainReconcileRequireAgreement, forwarded: "for=1.1.1.1, for=10.0.0.2", xff: "8.8.8.8, 10.0.0.2", wantSource: SourceForwarded, wantErr: ErrInconsistentSources, wantHop: 1},
+		{name: "partner failure rejects", mode: ChainReconcileRequireAgreement, forwarded: "for=8.8.8.8", xff: "garbage", wantSource: SourceXForwardedFor, wantErr: ErrInvalidIP},
+		{name: "prefer xff", mode: ChainReconcilePreferXForwardedFor, forwarded: "for=1.1.1.1", xff: "8.8.8.8", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor, wantWarn: true},
+		{name: "prefer forwarded", mode: ChainReconcilePreferForwarded, forwarded: "for=1.1.1.1", xff: "8.8.8.8", wantIP: "1.1.1.1", wantSource: SourceForwarded, wantWarn: true},
+		{name: "prefer forwarded ignores xff failure", mode: ChainReconcilePreferForwarded, forwarded: "for=1.1.1.1", xff: "garbage", wantIP: "1.1.1.1", wantSource: SourceForwarded},
+		{name: "preferred failure is terminal", mode: ChainReconcilePreferXForwardedFor, forwarded: "for=1.1.1.1", xff: "garbage", wantSource: SourceXForwardedFor, wantErr: ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{SourceForwarded, SourceXForwardedFor, SourceRemoteAddr}
+			WithChainReconciliation(tt.mode).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			if tt.forwarded != "" {
+				req.Header.Set("Forwarded", tt.forwarded)
+			}
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+			if result.Source != tt.wantSource {
+				t.Fatalf("Source = %v, want %v", result.Source, tt.wantSource)
+			}
+			if result.DebugInfo != nil {
+				t.Fatal("DebugInfo set without WithDebugInfo")
+			}
+			if got := result.ConsistencyErr != nil; got != tt.wantWarn {
+				t.Fatalf("ConsistencyErr = %v, want set %v", result.ConsistencyErr, tt.wantWarn)
+			}
+
+			var mismatch *ConsistencyError
+			if errors.As(err, &mismatch) || errors.As(result.ConsistencyErr, &mismatch) {
+				if mismatch.Group != chainReconciliationGroup || mismatch.ConflictingSource == tt.wantSource {
+					t.Fatalf("ConsistencyError = %+v", mismatch)
+				}
+				entries := logger.snapshot()
+				if len(entries) != 1 {
+					t.Fatalf("logged %d events, want 1", len(entries))
+				}
+				assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventInconsistentSources, tt.wantSource, "/", "10.0.0.1:443")
+				assertAttr(t, entries[0].attrs, "mode", tt.mode.String())
+				if tt.wantErr != nil {
+					assertAttr(t, entries[0].attrs, "hop", tt.wantHop)
+				}
+			}
+		})
+	}
+}
+
+func TestNew_ChainReconciliationValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceForwarded, SourceXForwardedFor)); err == nil {
+		t.Fatal("New() error = nil, want rejection of both chain headers without reconciliation")
+	}
+	if _, err := New(trusted, WithSources(SourceXForwardedFor), WithChainReconciliation(ChainReconcileRequireAgreement)); err == nil {
+		t.Fatal("New() error = nil, want rejection of reconciliation without both chain headers")
+	}
+	if _, err := New(trusted, WithSources(SourceForwarded, SourceXForwardedFor), WithChainReconciliation(ChainReconciliation(9))); err == nil {
+		t.Fatal("New() error = nil, want rejection of invalid reconciliation")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceXForwardedFor, SourceForwarded), WithChainReconciliation(ChainReconcilePreferForwarded))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().ChainReconciliation; got != ChainReconcilePreferForwarded {
+		t.Fatalf("Describe().ChainReconciliation = %v, want %v", got, ChainReconcilePreferForwarded)
+	}
+}
+
+func TestDivergentHop(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		xff       []string
+		want      int
+	}{
+		{name: "identical", forwarded: []string{"8.8.8.8", "[2001:db8::1]:443"}, xff: []string{"8.8.8.8", "2001:db8::1"}, want: -1},
+		{name: "nearest hop differs", forwarded: []string{"8.8.8.8", "10.0.0.3"}, xff: []string{"8.8.8.8", "10.0.0.2"}, want: 0},
+		{name: "length differs", forwarded: []string{"10.0.0.2"}, xff: []string{"8.8.8.8", "10.0.0.2"}, want: 1},
+		{name: "matching obfuscated hops", forwarded: []string{"unknown"}, xff: []string{"UNKNOWN"}, want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := divergentHop(&ChainDebugInfo{FullChain: tt.forwarded}, SourceForwarded, &ChainDebugInfo{FullChain: tt.xff}, SourceXForwardedFor)
+			if got != tt.want {
+				t.Fatalf("divergentHop() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,219 @@
+package clientip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// SourceCondition gates a source on request attributes. Every set field must
+// match; the zero value is invalid.
+type SourceCondition struct {
+	// Header names a marker header that must be present, such as
+	// X-Forwarded-Proto or Via.
+	Header string
+	// HeaderValues, when non-empty, lists accepted marker values. A value
+	// matches a comma-separated header element, or a whitespace-separated
+	// token within one, case-insensitively, so "https" matches
+	// X-Forwarded-Proto: https and "edge-lb" matches Via: 1.1 edge-lb.
+	HeaderValues []string
+	// LocalPort requires the request to arrive on this listener port, read
+	// from http.LocalAddrContextKey. Zero means any port.
+	LocalPort uint16
+	// PathPrefix requires the request path to start with this prefix. Input
+	// carries no path, so conditions with a PathPrefix never match there.
+	PathPrefix string
+}
+
+// WithSourceCondition runs source only for requests that match condition.
+//
+// Use it when a proxy sets its client IP header only on some traffic, for
+// example when a load balancer sets X-Forwarded-For together with
+// X-Forwarded-Proto while health checks reach the application directly. For
+// requests that do not match, source behaves as if its header were absent:
+// it is not read or peer-checked, and the next source runs. Conditions are
+// not a trust mechanism, because marker headers are as spoofable as the
+// source itself; trusted proxies still gate every header source. source must
+// be listed in WithSources and cannot be SourceRemoteAddr. Calling it again
+// for the same source replaces the condition.
+func WithSourceCondition(source Source, condition SourceCondition) Option {
+	condition.HeaderValues = slices.Clone(condition.HeaderValues)
+	return optionFunc(func(c *options) {
+		if c.SourceConditions == nil {
+			c.SourceConditions = make(map[Source]SourceCondition)
+		}
+		c.SourceConditions[source] = condition
+	})
+}
+
+// sourceCondition is a normalized SourceCondition.
+type sourceCondition struct {
+	header     string
+	values     []string
+	localPort  uint16
+	pathPrefix string
+}
+
+func normalizeSourceConditions(conditions map[Source]SourceCondition) (map[Source]sourceCondition, error) {
+	if len(conditions) == 0 {
+		return nil, nil
+	}
+
+	normalized := make(map[Source]sourceCondition, len(conditions))
+	for source, condition := range canonicalSourceMap(conditions) {
+		header := strings.TrimSpace(condition.Header)
+		if header == "" && len(condition.HeaderValues) > 0 {
+			return nil, fmt.Errorf("source condition for %q sets header values without a header", source)
+		}
+		if header == "" && condition.LocalPort == 0 && condition.PathPrefix == "" {
+			return nil, fmt.Errorf("source condition for %q must set a header, local port, or path prefix", source)
+		}
+		if header != "" {
+			header = textproto.CanonicalMIMEHeaderKey(header)
+		}
+
+		values := make([]string, 0, len(condition.HeaderValues))
+		for _, value := range condition.HeaderValues {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return nil, fmt.Errorf("source condition for %q has an empty header value", source)
+			}
+			values = append(values, value)
+		}
+
+		normalized[source] = sourceCondition{
+			header:     header,
+			values:     values,
+			localPort:  condition.LocalPort,
+			pathPrefix: condition.PathPrefix,
+		}
+	}
+	return normalized, nil
+}
+
+func (c *config) validateSourceConditions() error {
+	for source := range c.sourceConditions {
+		if err := c.validatePerSourceSetting("source condition", source, false); err != nil {
+			return err
+		}
+		if source == builtinSource(sourceRemoteAddr) {
+			return fmt.Errorf("source condition cannot be configured for %q", source)
+		}
+	}
+	return nil
+}
+
+// describeSourceConditions returns copies of the normalized conditions.
+func (c *config) describeSourceConditions() map[Source]SourceCondition {
+	if len(c.sourceConditions) == 0 {
+		return nil
+	}
+
+	conditions := make(map[Source]SourceCondition, len(c.sourceConditions))
+	for source, condition := range c.sourceConditions {
+		conditions[source] = SourceCondition{
+			Header:       condition.header,
+			HeaderValues: slices.Clone(condition.values),
+			LocalPort:    condition.localPort,
+			PathPrefix:   condition.pathPrefix,
+		}
+	}
+	return conditions
+}
+
+// conditionFor returns the condition for source, or nil when it always runs.
+func (c *config) conditionFor(source Source) *sourceCondition {
+	condition, ok := c.sourceConditions[source]
+	if !ok {
+		return nil
+	}
+	return &condition
+}
+
+// matches reports whether r satisfies the condition. A nil condition always
+// matches.
+func (c *sourceCondition) matches(r requestView) bool {
+	if c == nil {
+		return true
+	}
+
+	if c.pathPrefix != "" && !strings.HasPrefix(r.path(), c.pathPrefix) {
+		return false
+	}
+	if c.localPort != 0 && localAddrPort(r) != c.localPort {
+		return false
+	}
+	if c.header == "" {
+		return true
+	}
+
+	values := r.valuesCanonical(c.header)
+	if len(values) == 0 {
+		return false
+	}
+	if len(c.values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			if c.matchesElement(element) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *sourceCondition) matchesElement(element string) bool {
+	element = strings.TrimSpace(element)
+	for _, want := range c.values {
+		if strings.EqualFold(element, want) {
+			return true
+		}
+		for _, token := range strings.Fields(element) {
+			if strings.EqualFold(token, want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// localAddrPort returns the listener port net/http stored in the request
+// context, or 0.
+func localAddrPort(r requestView) uint16 {
+	addr, ok := r.context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok || addr == nil {
+		return 0
+	}
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return 0
+	}
+	return addrPort.Port()
+}
+
+// sourceConditionWire renders conditions for Description JSON.
+func sourceConditionWire(conditions map[Source]SourceCondition) map[Source]sourceConditionJSON {
+	wire := make(map[Source]sourceConditionJSON, len(conditions))
+	for source, condition := range conditions {
+		wire[source] = sourceConditionJSON{
+			Header:       condition.Header,
+			HeaderValues: nonNilStrings(condition.HeaderValues),
+			LocalPort:    condition.LocalPort,
+			PathPrefix:   condition.PathPrefix,
+		}
+	}
+	return wire
+}
+
+type sourceConditionJSON struct {
+	Header       string   `json:"header"`
+	HeaderValues []string `json:"header_values"`
+	LocalPort    uint16   `json:"local_port"`
+	PathPrefix   string   `json:"path_prefix"`
+}
@@ -0,0 +1,170 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSourceConditionMatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition SourceCondition
+		headers   map[string]string
+		path      string
+		localAddr string
+		want      bool
+	}{
+		{name: "header present", condition: SourceCondition{Header: "x-forwarded-proto"}, headers: map[string]string{"X-Forwarded-Proto": "http"}, want: true},
+		{name: "header absent", condition: SourceCondition{Header: "X-Forwarded-Proto"}, want: false},
+		{name: "header value case-insensitive", condition: SourceCondition{Header: "X-Forwarded-Proto", HeaderValues: []string{"HTTPS"}}, headers: map[string]string{"X-Forwarded-Proto": "https"}, want: true},
+		{name: "header value mismatch", condition: SourceCondition{Header: "X-Forwarded-Proto", HeaderValues: []string{"https"}}, headers: map[string]string{"X-Forwarded-Proto": "http"}, want: false},
+		{name: "via token", condition: SourceCondition{Header: "Via", HeaderValues: []string{"edge-lb"}}, headers: map[string]string{"Via": "1.0 cdn, 1.1 edge-lb (proxy)"}, want: true},
+		{name: "via token is not a substring match", condition: SourceCondition{Header: "Via", HeaderValues: []string{"edge"}}, headers: map[string]string{"Via": "1.1 edge-lb"}, want: false},
+		{name: "local port", condition: SourceCondition{LocalPort: 8443}, localAddr: "10.0.0.5:8443", want: true},
+		{name: "local port mismatch", condition: SourceCondition{LocalPort: 8443}, localAddr: "10.0.0.5:8080", want: false},
+		{name: "local port without local address", condition: SourceCondition{LocalPort: 8443}, want: false},
+		{name: "path prefix", condition: SourceCondition{PathPrefix: "/api/"}, path: "/api/users", want: true},
+		{name: "path prefix mismatch", condition: SourceCondition{PathPrefix: "/api/"}, path: "/healthz", want: false},
+		{name: "all fields must match", condition: SourceCondition{Header: "X-Forwarded-Proto", LocalPort: 8443, PathPrefix: "/api/"}, headers: map[string]string{"X-Forwarded-Proto": "https"}, path: "/api/users", localAddr: "10.0.0.5:8080", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions, err := normalizeSourceConditions(map[Source]SourceCondition{SourceXForwardedFor: tt.condition})
+			if err != nil {
+				t.Fatalf("normalizeSourceConditions() error = %v", err)
+			}
+			condition := conditions[SourceXForwardedFor]
+
+			req := newTestRequest("10.0.0.1:443", tt.path)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if tt.localAddr != "" {
+				local := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(tt.localAddr))
+				req = req.WithContext(context.WithValue(context.Background(), http.LocalAddrContextKey, local))
+			}
+
+			if got := condition.matches(requestViewFromRequest(req)); got != tt.want {
+				t.Fatalf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if !(*sourceCondition)(nil).matches(requestView{}) {
+		t.Fatal("nil condition matches() = false, want true")
+	}
+}
+
+func TestExtract_SourceCondition(t *testing.T) {
+	tests := []struct {
+		name       string
+		proto      string
+		remoteAddr string
+		wantIP     string
+		wantSource Source
+	}{
+		{name: "marker present uses header", proto: "https", remoteAddr: "10.0.0.1:443", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "marker mismatch falls through", proto: "http", remoteAddr: "10.0.0.1:443", wantIP: "10.0.0.1", wantSource: SourceRemoteAddr},
+		{name: "marker absent skips peer check", remoteAddr: "1.1.1.1:443", wantIP: "1.1.1.1", wantSource: SourceRemoteAddr},
+		{name: "marker present still checks peer", proto: "https", remoteAddr: "1.1.1.1:443", wantSource: SourceXForwardedFor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.AllowPrivateIPs = true
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{SourceXForwardedFor, SourceRemoteAddr}
+			WithSourceCondition(SourceXForwardedFor, SourceCondition{Header: "X-Forwarded-Proto", HeaderValues: []string{"https"}}).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest(tt.remoteAddr, "/")
+			req.Header.Set("X-Forwarded-For", "8.8.8.8")
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+
+			result, err := extractor.Extract(req)
+			if tt.wantIP == "" {
+				if !errors.Is(err, ErrUntrustedProxy) {
+					t.Fatalf("Extract() error = %v, want %v", err, ErrUntrustedProxy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Extract() error = %v", err)
+			}
+			if result.IP != netip.MustParseAddr(tt.wantIP) || result.Source != tt.wantSource {
+				t.Fatalf("Extract() = %v from %s, want %s from %s", result.IP, result.Source, tt.wantIP, tt.wantSource)
+			}
+			if entries := logger.snapshot(); len(entries) != 0 {
+				t.Fatalf("logged %d events, want 0", len(entries))
+			}
+		})
+	}
+}
+
+func TestExtract_SourceConditionLastSourceUnavailable(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{SourceXRealIP}
+	WithSourceCondition(SourceXRealIP, SourceCondition{PathPrefix: "/api/"}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("10.0.0.1:443", "/healthz")
+	req.Header.Set("X-Real-IP", "8.8.8.8")
+	if _, err := extractor.Extract(req); !errors.Is(err, ErrSourceUnavailable) {
+		t.Fatalf("Extract() error = %v, want %v", err, ErrSourceUnavailable)
+	}
+
+	req.URL.Path = "/api/users"
+	result, err := extractor.Extract(req)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.IP != netip.MustParseAddr("8.8.8.8") {
+		t.Fatalf("IP = %v, want 8.8.8.8", result.IP)
+	}
+}
+
+func TestNew_SourceConditionValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	invalid := []struct {
+		name      string
+		sources   []Source
+		source    Source
+		condition SourceCondition
+	}{
+		{name: "empty condition", sources: []Source{SourceXForwardedFor}, source: SourceXForwardedFor},
+		{name: "values without header", sources: []Source{SourceXForwardedFor}, source: SourceXForwardedFor, condition: SourceCondition{HeaderValues: []string{"https"}}},
+		{name: "empty value", sources: []Source{SourceXForwardedFor}, source: SourceXForwardedFor, condition: SourceCondition{Header: "Via", HeaderValues: []string{" "}}},
+		{name: "source not configured", sources: []Source{SourceXForwardedFor}, source: SourceXRealIP, condition: SourceCondition{Header: "Via"}},
+		{name: "remote addr", sources: []Source{SourceXForwardedFor, SourceRemoteAddr}, source: SourceRemoteAddr, condition: SourceCondition{LocalPort: 80}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(trusted, WithSources(tt.sources...), WithSourceCondition(tt.source, tt.condition)); err == nil {
+				t.Fatal("New() error = nil, want rejection")
+			}
+		})
+	}
+
+	resolver, err := New(trusted, WithSources(SourceXForwardedFor), WithSourceCondition(SourceXForwardedFor, SourceCondition{Header: "via", HeaderValues: []string{" edge-lb "}, LocalPort: 8443}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	want := map[Source]SourceCondition{SourceXForwardedFor: {Header: "Via", HeaderValues: []string{"edge-lb"}, LocalPort: 8443}}
+	if diff := cmp.Diff(want, resolver.Describe().SourceConditions); diff != "" {
+		t.Fatalf("Describe().SourceConditions mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,216 @@
+package clientip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ConsistencyMode controls what happens when sources in a ConsistencyGroup
+// disagree.
+type ConsistencyMode uint8
+
+const (
+	// ConsistencyReject fails resolution with a ConsistencyError. This is the
+	// default and the fail-closed choice.
+	ConsistencyReject ConsistencyMode = iota
+	// ConsistencyWarn keeps the resolved IP, emits the inconsistent_sources
+	// security event, and records the ConsistencyError in
+	// Result.ConsistencyErr.
+	ConsistencyWarn
+)
+
+// String returns the stable label for m.
+func (m ConsistencyMode) String() string {
+	switch m {
+	case ConsistencyReject:
+		return "reject"
+	case ConsistencyWarn:
+		return "warn"
+	default:
+		return "unknown"
+	}
+}
+
+func (m ConsistencyMode) valid() bool {
+	return m == ConsistencyReject || m == ConsistencyWarn
+}
+
+// ConsistencyGroup declares sources that must agree on the client IP.
+type ConsistencyGroup struct {
+	// Name identifies the group in errors and logs. Leave empty to name the
+	// group after its sources, joined with "+".
+	Name string
+	// Sources are the group members. At least two distinct sources are
+	// required, and each must be listed in WithSources.
+	Sources []Source
+	// Mode selects reject or warn behavior on disagreement.
+	Mode ConsistencyMode
+}
+
+// WithConsistencyGroup requires the sources in group to agree on the client IP.
+//
+// Normally only the first available source in priority order is read. When
+// the resolved source belongs to a group, the other members are also
+// extracted from the same request and compared with the resolved IP. Members
+// that are absent or fail their own validation are not compared. A mismatch,
+// such as an X-Forwarded-For client that differs from X-Real-IP set by the
+// same proxy, is a strong sign of header injection: it emits the
+// inconsistent_sources security event and, in ConsistencyReject mode, fails
+// with a ConsistencyError. Calling it again adds another group.
+func WithConsistencyGroup(group ConsistencyGroup) Option {
+	group.Sources = slices.Clone(group.Sources)
+	return optionFunc(func(c *options) { c.ConsistencyGroups = append(c.ConsistencyGroups, group) })
+}
+
+// consistencyGroup is a normalized ConsistencyGroup with canonical sources.
+type consistencyGroup struct {
+	name    string
+	sources []Source
+	mode    ConsistencyMode
+}
+
+// consistencyCheck is one group membership of a configured source, resolved to
+// the other members' positions in the extractor source list.
+type consistencyCheck struct {
+	group *consistencyGroup
+	peers []int
+}
+
+func normalizeConsistencyGroups(groups []ConsistencyGroup) []consistencyGroup {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	normalized := make([]consistencyGroup, len(groups))
+	for i, group := range groups {
+		sources := canonicalizeSources(group.Sources)
+		name := group.Name
+		if name == "" {
+			names := make([]string, len(sources))
+			for j, source := range sources {
+				names[j] = source.String()
+			}
+			name = strings.Join(names, "+")
+		}
+		normalized[i] = consistencyGroup{name: name, sources: sources, mode: group.Mode}
+	}
+	return normalized
+}
+
+func (c *config) validateConsistencyGroups() error {
+	for _, group := range c.consistencyGroups {
+		if !group.mode.valid() {
+			return fmt.Errorf("invalid consistency mode %d for group %q", group.mode, group.name)
+		}
+		if len(group.sources) < 2 {
+			return fmt.Errorf("consistency group %q requires at least two sources", group.name)
+		}
+		for i, source := range group.sources {
+			if err := c.validatePerSourceSetting("consistency group", source, false); err != nil {
+				return err
+			}
+			if slices.Contains(group.sources[:i], source) {
+				return fmt.Errorf("duplicate source %q in consistency group %q", source, group.name)
+			}
+		}
+	}
+	return nil
+}
+
+// buildConsistencyChecks attaches each group to its configured members.
+func (e *extractor) buildConsistencyChecks() {
+	for g := range e.config.consistencyGroups {
+		group := &e.config.consistencyGroups[g]
+		for i := range e.sources {
+			if !slices.Contains(group.sources, e.sources[i].source) {
+				continue
+			}
+
+			check := consistencyCheck{group: group}
+			for j := range e.sources {
+				if j != i && slices.Contains(group.sources, e.sources[j].source) {
+					check.peers = append(check.peers, j)
+				}
+			}
+			e.sources[i].consistency = append(e.sources[i].consistency, check)
+		}
+	}
+}
+
+// checkConsistency compares result with the other members of each group the
+// resolved source belongs to. In warn mode mismatches are joined into
+// result.ConsistencyErr; in reject mode the first mismatch is returned.
+// Anonymous results carry no IP to compare and are returned unchanged.
+func (e *extractor) checkConsistency(r requestView, source *configuredSource, result Extraction) (Extraction, error) {
+	if result.AnonymousNode != "" {
+		return result, nil
+	}
+
+	var warnings []error
+	for _, check := range source.consistency {
+		for _, peer := range check.peers {
+			other := &e.sources[peer]
+			ip, ok := other.peek(r)
+			if !ok || ip == result.IP {
+				continue
+			}
+
+			err := &ConsistencyError{
+				ExtractionError:   ExtractionError{Err: ErrInconsistentSources, Source: source.source},
+				Group:             check.group.name,
+				IP:                result.IP,
+				ConflictingSource: other.source,
+				ConflictingIP:     ip,
+			}
+			e.logSecurityWarning(
+				r, source.source, SecurityEventInconsistentSources, "client IP sources disagree",
+				"group", check.group.name,
+				"mode", check.group.mode.String(),
+				"ip", result.IP.String(),
+				"conflicting_source", other.source.String(),
+				"conflicting_ip", ip.String(),
+			)
+			if check.group.mode == ConsistencyReject {
+				return Extraction{Source: source.source}, err
+			}
+			warnings = append(warnings, err)
+			break
+		}
+	}
+
+	result.ConsistencyErr = errors.Join(warnings...)
+	return result, nil
+}
+
+// peek extracts the client IP from s without logging or error adaptation. It
+// reports false when the source is absent, fails, or resolves an anonymous
+// client.
+func (s *configuredSource) peek(r requestView) (netip.Addr, bool) {
+	var (
+		result  Extraction
+		failure *extractionFailure
+		err     error
+	)
+
+	if !s.condition.matches(r) {
+		return netip.Addr{}, false
+	}
+
+	switch s.source.kind {
+	case sourceForwarded, sourceXForwardedFor, sourceChainHeader:
+		result, failure, err = s.chain.extract(r, s.source)
+	case sourceRemoteAddr:
+		result, failure = s.remote.extract(r.context(), r.remoteAddr(), s.source)
+	case sourceCustom:
+		result, failure, err = s.custom.extract(r, s.source, true)
+	default:
+		result, failure = s.single.extract(r, s.source)
+	}
+	if err != nil || failure != nil || !result.IP.IsValid() {
+		return netip.Addr{}, false
+	}
+	return result.IP, true
+}
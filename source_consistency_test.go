@@ -0,0 +1,132 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestExtract_ConsistencyGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      ConsistencyMode
+		xff       string
+		realIP    string
+		wantIP    string
+		wantErr   error
+		wantWarn  bool
+		wantEvent bool
+	}{
+		{name: "agree", xff: "8.8.8.8", realIP: "8.8.8.8", wantIP: "8.8.8.8"},
+		{name: "member absent", xff: "8.8.8.8", wantIP: "8.8.8.8"},
+		{name: "member invalid is not compared", xff: "8.8.8.8", realIP: "10.0.0.5", wantIP: "8.8.8.8"},
+		{name: "reject mismatch", xff: "8.8.8.8", realIP: "1.1.1.1", wantErr: ErrInconsistentSources, wantEvent: true},
+		{name: "warn mismatch", mode: ConsistencyWarn, xff: "8.8.8.8", realIP: "1.1.1.1", wantIP: "8.8.8.8", wantWarn: true, wantEvent: true},
+		{name: "lower priority member resolved", realIP: "1.1.1.1", wantIP: "1.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+			cfg.Sources = []Source{SourceXForwardedFor, SourceXRealIP, SourceRemoteAddr}
+			WithConsistencyGroup(ConsistencyGroup{Sources: []Source{SourceXForwardedFor, SourceXRealIP}, Mode: tt.mode}).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("127.0.0.1:8080", "/login")
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+			if got := result.ConsistencyErr != nil; got != tt.wantWarn {
+				t.Fatalf("ConsistencyErr = %v, want set %v", result.ConsistencyErr, tt.wantWarn)
+			}
+
+			if tt.wantErr != nil || tt.wantWarn {
+				consistencyErr := err
+				if tt.wantWarn {
+					consistencyErr = result.ConsistencyErr
+				}
+				var typed *ConsistencyError
+				if !errors.As(consistencyErr, &typed) {
+					t.Fatalf("error = %T, want *ConsistencyError", consistencyErr)
+				}
+				want := ConsistencyError{
+					ExtractionError:   ExtractionError{Err: ErrInconsistentSources, Source: SourceXForwardedFor},
+					Group:             "x_forwarded_for+x_real_ip",
+					IP:                netip.MustParseAddr("8.8.8.8"),
+					ConflictingSource: SourceXRealIP,
+					ConflictingIP:     netip.MustParseAddr("1.1.1.1"),
+				}
+				if *typed != want {
+					t.Fatalf("ConsistencyError = %+v, want %+v", *typed, want)
+				}
+			}
+			if tt.wantErr != nil && ClassifyError(err) != ResultMalformed {
+				t.Fatalf("ClassifyError() = %v, want %v", ClassifyError(err), ResultMalformed)
+			}
+
+			entries := logger.snapshot()
+			if got := len(entries) == 1; got != tt.wantEvent {
+				t.Fatalf("logged %d events, want event %v", len(entries), tt.wantEvent)
+			}
+			if tt.wantEvent {
+				attrs := entries[0].attrs
+				assertCommonSecurityWarningAttrs(t, attrs, SecurityEventInconsistentSources, SourceXForwardedFor, "/login", "127.0.0.1:8080")
+				assertAttr(t, attrs, "mode", tt.mode.String())
+				assertAttr(t, attrs, "conflicting_source", SourceXRealIP.String())
+				assertAttr(t, attrs, "conflicting_ip", "1.1.1.1")
+			}
+		})
+	}
+}
+
+func TestNew_ConsistencyGroupValidation(t *testing.T) {
+	base := []Option{
+		WithTrustedProxies(LoopbackProxyPrefixes()...),
+		WithSources(SourceXForwardedFor, SourceXRealIP),
+	}
+
+	tests := []struct {
+		name  string
+		group ConsistencyGroup
+	}{
+		{name: "single source", group: ConsistencyGroup{Sources: []Source{SourceXForwardedFor}}},
+		{name: "source not configured", group: ConsistencyGroup{Sources: []Source{SourceXForwardedFor, SourceRemoteAddr}}},
+		{name: "duplicate source", group: ConsistencyGroup{Sources: []Source{SourceXRealIP, HeaderSource("X-Real-IP")}}},
+		{name: "invalid mode", group: ConsistencyGroup{Sources: []Source{SourceXForwardedFor, SourceXRealIP}, Mode: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(append(base, WithConsistencyGroup(tt.group))...); err == nil {
+				t.Fatal("New() error = nil, want validation error")
+			}
+		})
+	}
+
+	resolver, err := New(append(base, WithConsistencyGroup(ConsistencyGroup{
+		Name:    "edge",
+		Sources: []Source{HeaderSource("X-Real-IP"), SourceXForwardedFor},
+		Mode:    ConsistencyWarn,
+	}))...)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	groups := resolver.Describe().ConsistencyGroups
+	if len(groups) != 1 || groups[0].Name != "edge" || groups[0].Mode != ConsistencyWarn || groups[0].Sources[0] != SourceXRealIP {
+		t.Fatalf("Describe().ConsistencyGroups = %+v", groups)
+	}
+}
@@ -0,0 +1,237 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/textproto"
+	"strings"
+)
+
+// Extractor reads a client IP from a location the built-in sources do not
+// cover, such as a claim set by an edge gateway, gRPC metadata, or a client
+// certificate.
+//
+// Return ErrSourceUnavailable (or an error wrapping it) when the value is not
+// present so the next configured source can run. Other errors are terminal
+// and are reported as an ExtractionError for the source; wrap a clientip
+// sentinel such as ErrInvalidIP to control Result.Classify. Extractors must be
+// safe for concurrent use.
+//
+// ExtractClientIP may also run as a peek, reported by SourceRequest.Peek,
+// whose result is discarded: when a consistency group compares sources, and,
+// for peer-checked sources that do not implement PresenceReporter, to detect
+// whether a request from an untrusted peer carries the value at all. Peeks can
+// therefore reach extractors for untrusted peers; extractors with side effects
+// or expensive verification should skip that work for peeks or implement
+// PresenceReporter.
+type Extractor interface {
+	ExtractClientIP(req SourceRequest) (netip.Addr, error)
+}
+
+// PresenceReporter is an optional interface for Extractors that can report
+// whether their input is present without extracting or verifying it. When a
+// peer-checked source's peer is rejected, Present is used instead of a
+// peeking ExtractClientIP call, so no extraction work runs for untrusted
+// peers. Present must be safe for concurrent use.
+type PresenceReporter interface {
+	Present(req SourceRequest) bool
+}
+
+// validatingExtractor is implemented by built-in Extractors whose
+// configuration New must check.
+type validatingExtractor interface {
+	validate() error
+}
+
+// ExtractorFunc adapts a function to the Extractor interface.
+type ExtractorFunc func(req SourceRequest) (netip.Addr, error)
+
+// ExtractClientIP implements Extractor.
+func (f ExtractorFunc) ExtractClientIP(req SourceRequest) (netip.Addr, error) {
+	return f(req)
+}
+
+// SourceRequest is the read-only request view passed to an Extractor.
+type SourceRequest struct {
+	view requestView
+	// peek is set when a consistency group re-runs the source to compare
+	// results; built-in extractors must not record state for it.
+	peek bool
+}
+
+// Peek reports whether the call only probes the source and its result is
+// discarded. Extractors must not record state, such as replay claims, for
+// peeks.
+func (r SourceRequest) Peek() bool {
+	return r.peek
+}
+
+// Context returns the request context.
+func (r SourceRequest) Context() context.Context {
+	return r.view.context()
+}
+
+// RemoteAddr returns the immediate peer address string.
+func (r SourceRequest) RemoteAddr() string {
+	return r.view.remoteAddr()
+}
+
+// Path returns the request URL path, or "" for Input resolution.
+func (r SourceRequest) Path() string {
+	return r.view.path()
+}
+
+// Header returns all values of the named header. name is canonicalized.
+func (r SourceRequest) Header(name string) []string {
+	return r.view.valuesCanonical(textproto.CanonicalMIMEHeaderKey(name))
+}
+
+// HTTPRequest returns the underlying *http.Request, or nil for Input
+// resolution. Extractors must not modify it.
+func (r SourceRequest) HTTPRequest() *http.Request {
+	return r.view.request
+}
+
+// CustomSourceOption configures a source created by CustomSource.
+type CustomSourceOption interface {
+	applyCustomSourceOption(*customSource)
+}
+
+type customSourceOptionFunc func(*customSource)
+
+func (f customSourceOptionFunc) applyCustomSourceOption(c *customSource) { f(c) }
+
+// AllowAnyPeer lets a custom source run regardless of whether the immediate
+// peer is a trusted proxy.
+//
+// Use it only when the extractor authenticates its input itself, for example
+// by reading a verified client certificate. Sources using it do not require
+// WithTrustedProxies.
+func AllowAnyPeer() CustomSourceOption {
+	return customSourceOptionFunc(func(c *customSource) { c.anyPeer = true })
+}
+
+// customSource is shared by pointer so Source stays comparable and each
+// CustomSource call yields a distinct source identity.
+type customSource struct {
+	name      string
+	extractor Extractor
+	anyPeer   bool
+}
+
+// CustomSource returns a source backed by extractor, for use with WithSources.
+//
+// By default the source participates in the trusted-peer check like header
+// sources: when the immediate peer is not a trusted proxy, resolution fails
+// with ErrUntrustedProxy (or follows WithUntrustedPeerPolicy) if the source
+// has a value. The peer is checked first; extractor then runs only to learn
+// whether the value is present and its result is discarded. Once the peer is
+// accepted, the extracted address goes through
+// the client-IP policy, embedded-IPv4 unwrapping, and validator like any other
+// source.
+//
+// name identifies the source in Result.Source, errors, and logs. It is
+// normalized like header names and must not collide with another configured
+// source. Each call returns a distinct Source; keep the returned value to use
+// with per-source options and comparisons. Custom sources serialize by name
+// only, so Source.UnmarshalText cannot reconstruct them.
+func CustomSource(name string, extractor Extractor, opts ...CustomSourceOption) Source {
+	custom := &customSource{name: normalizeSourceName(strings.TrimSpace(name)), extractor: extractor}
+	for _, opt := range opts {
+		if opt != nil {
+			opt.applyCustomSourceOption(custom)
+		}
+	}
+	return Source{kind: sourceCustom, custom: custom}
+}
+
+type customExtractor struct {
+	clientIP     clientIPPolicy
+	trustedProxy proxyPolicy
+}
+
+// extract runs a custom source. Extractor errors other than unavailability are
+// returned unchanged for adaptCustomSourceError; policy failures use the
+// single-header failure shapes. peek marks a consistency-group comparison.
+func (e customExtractor) extract(req requestView, source Source, peek bool) (Extraction, *extractionFailure, error) {
+	if !source.custom.anyPeer {
+		if failure := e.checkPeer(req, source); failure != nil {
+			if !e.present(req, source) {
+				return Extraction{}, errSourceUnavailable, nil
+			}
+			return Extraction{}, failure, nil
+		}
+	}
+
+	ip, err := source.custom.extractor.ExtractClientIP(SourceRequest{view: req, peek: peek})
+	if errors.Is(err, ErrSourceUnavailable) {
+		return Extraction{}, errSourceUnavailable, nil
+	}
+	if err != nil {
+		return Extraction{}, nil, err
+	}
+
+	ip, wrapper := e.clientIP.embedded.unwrap(ip)
+	disposition := evaluateClientIP(ip, e.clientIP)
+	if disposition != clientIPValid {
+		return Extraction{}, &extractionFailure{
+			kind:                failureInvalidClientIP,
+			source:              source,
+			extractedIP:         addrString(ip),
+			clientIPDisposition: disposition,
+			clientIPPolicy:      e.clientIP.rejectionName(ip),
+		}, nil
+	}
+
+	ip = normalizeIP(ip)
+	if err := e.clientIP.validate(req.context(), ip, source); err != nil {
+		return Extraction{}, &extractionFailure{
+			kind:           failureClientIPRejected,
+			source:         source,
+			extractedIP:    ip.String(),
+			rejection:      err,
+			clientIPPolicy: e.clientIP.rejectionName(ip),
+		}, nil
+	}
+
+	return Extraction{
+		IP:        ip,
+		Source:    source,
+		WrapperIP: wrapper,
+	}, nil, nil
+}
+
+// checkPeer applies the trusted-peer and origin-secret checks that gate
+// peer-checked sources.
+func (e customExtractor) checkPeer(req requestView, source Source) *extractionFailure {
+	if e.trustedProxy.checksPeer() && !e.trustedProxy.trustsPeer(req) {
+		return &extractionFailure{
+			kind:              failureUntrustedProxy,
+			source:            source,
+			minTrustedProxies: e.trustedProxy.MinTrustedProxies,
+			maxTrustedProxies: e.trustedProxy.MaxTrustedProxies,
+		}
+	}
+	return e.trustedProxy.OriginSecret.check(req, source)
+}
+
+// present reports whether source has a value, so a rejected peer without one
+// falls through as unavailable. Extractors that do not implement
+// PresenceReporter run once as a peek with their result discarded.
+func (e customExtractor) present(req requestView, source Source) bool {
+	probe := SourceRequest{view: req, peek: true}
+	if reporter, ok := source.custom.extractor.(PresenceReporter); ok {
+		return reporter.Present(probe)
+	}
+	_, err := source.custom.extractor.ExtractClientIP(probe)
+	return !errors.Is(err, ErrSourceUnavailable)
+}
+
+func addrString(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,209 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func claimExtractor(header string) Extractor {
+	return ExtractorFunc(func(req SourceRequest) (netip.Addr, error) {
+		values := req.Header(header)
+		if len(values) == 0 {
+			return netip.Addr{}, ErrSourceUnavailable
+		}
+		ip, err := netip.ParseAddr(values[0])
+		if err != nil {
+			return netip.Addr{}, errors.Join(ErrInvalidIP, err)
+		}
+		return ip, nil
+	})
+}
+
+func TestExtract_CustomSource(t *testing.T) {
+	claim := CustomSource("Edge-Claim", claimExtractor("x-edge-claim"))
+
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{claim, SourceRemoteAddr}
+	extractor := mustNewExtractor(t, cfg)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		claim      string
+		want       extractionState
+		wantErr    error
+	}{
+		{name: "trusted peer", remoteAddr: "127.0.0.1:8080", claim: "8.8.8.8", want: extractionState{HasIP: true, IP: "8.8.8.8", Source: claim}},
+		{name: "unavailable falls through", remoteAddr: "1.1.1.1:443", want: extractionState{HasIP: true, IP: "1.1.1.1", Source: SourceRemoteAddr}},
+		{name: "untrusted peer", remoteAddr: "1.1.1.1:443", claim: "8.8.8.8", want: extractionState{Source: claim}, wantErr: ErrUntrustedProxy},
+		{name: "client ip policy", remoteAddr: "127.0.0.1:8080", claim: "10.0.0.1", want: extractionState{Source: claim}, wantErr: ErrPrivateIP},
+		{name: "extractor error", remoteAddr: "127.0.0.1:8080", claim: "garbage", want: extractionState{Source: claim}, wantErr: ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := newTestRequest(tt.remoteAddr, "")
+			if tt.claim != "" {
+				req.Header.Set("X-Edge-Claim", tt.claim)
+			}
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := extractionStateOf(result); got != tt.want {
+				t.Fatalf("extraction = %+v, want %+v", got, tt.want)
+			}
+			if err != nil {
+				var sourceErr interface{ SourceValue() Source }
+				if !errors.As(err, &sourceErr) || sourceErr.SourceValue() != claim {
+					t.Fatalf("error = %v, want typed error for %v", err, claim)
+				}
+			}
+		})
+	}
+
+	if got := claim.String(); got != "edge_claim" {
+		t.Fatalf("String() = %q, want edge_claim", got)
+	}
+}
+
+func TestExtract_CustomSourceAnyPeerAndRequestAccess(t *testing.T) {
+	var gotRequest *http.Request
+	source := CustomSource("cert", ExtractorFunc(func(req SourceRequest) (netip.Addr, error) {
+		gotRequest = req.HTTPRequest()
+		if req.Path() != "/cert" || req.RemoteAddr() != "9.9.9.9:443" {
+			return netip.Addr{}, errors.New("unexpected request view")
+		}
+		return netip.MustParseAddr("8.8.4.4"), nil
+	}), AllowAnyPeer())
+
+	resolver, err := New(WithSources(source))
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil without trusted proxies", err)
+	}
+
+	req := newTestRequest("9.9.9.9:443", "/cert")
+	result := resolver.Resolve(req)
+	if result.Err != nil || result.IP != netip.MustParseAddr("8.8.4.4") || result.Source != source {
+		t.Fatalf("Resolve() = %+v, want 8.8.4.4 from custom source", result)
+	}
+	if gotRequest != req {
+		t.Fatal("HTTPRequest() did not return the resolved request")
+	}
+
+	result = resolver.ResolveInput(Input{RemoteAddr: "9.9.9.9:443"})
+	if result.Err == nil {
+		t.Fatal("ResolveInput() error = nil, want error for missing path")
+	}
+	if gotRequest != nil {
+		t.Fatal("HTTPRequest() = non-nil for Input resolution")
+	}
+}
+
+type presenceClaimExtractor struct {
+	Extractor
+	calls int
+}
+
+func (e *presenceClaimExtractor) ExtractClientIP(req SourceRequest) (netip.Addr, error) {
+	e.calls++
+	return e.Extractor.ExtractClientIP(req)
+}
+
+func (e *presenceClaimExtractor) Present(req SourceRequest) bool {
+	return len(req.Header("x-edge-claim")) > 0
+}
+
+func TestExtract_CustomSourceUntrustedPeerPresence(t *testing.T) {
+	var peeks []bool
+	plain := CustomSource("plain", ExtractorFunc(func(req SourceRequest) (netip.Addr, error) {
+		peeks = append(peeks, req.Peek())
+		return claimExtractor("x-edge-claim").ExtractClientIP(req)
+	}))
+	reporter := &presenceClaimExtractor{Extractor: claimExtractor("x-edge-claim")}
+	reporting := CustomSource("reporting", reporter)
+
+	for _, source := range []Source{plain, reporting} {
+		cfg := defaultOptions()
+		cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+		cfg.Sources = []Source{source, SourceRemoteAddr}
+		extractor := mustNewExtractor(t, cfg)
+
+		req := newTestRequest("1.1.1.1:443", "")
+		req.Header.Set("X-Edge-Claim", "8.8.8.8")
+		if _, err := extractor.Extract(req); !errors.Is(err, ErrUntrustedProxy) {
+			t.Fatalf("%v: error = %v, want %v", source, err, ErrUntrustedProxy)
+		}
+	}
+
+	if len(peeks) != 1 || !peeks[0] {
+		t.Fatalf("plain extractor peeks = %v, want one peeking call", peeks)
+	}
+	if reporter.calls != 0 {
+		t.Fatalf("PresenceReporter extractor ran %d times for an untrusted peer, want 0", reporter.calls)
+	}
+}
+
+func TestExtract_CustomSourceContextErrorIsBare(t *testing.T) {
+	source := CustomSource("slow", ExtractorFunc(func(req SourceRequest) (netip.Addr, error) {
+		return netip.Addr{}, req.Context().Err()
+	}))
+
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = LoopbackProxyPrefixes()
+	cfg.Sources = []Source{source, SourceRemoteAddr}
+	extractor := mustNewExtractor(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := extractor.ExtractInput(Input{Context: ctx, RemoteAddr: "127.0.0.1:80"})
+	if !errors.Is(err, context.Canceled) || ClassifyError(err) != ResultCanceled {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+}
+
+func TestNew_CustomSourceValidation(t *testing.T) {
+	extractor := claimExtractor("X-Claim")
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{name: "requires trusted proxies", opts: []Option{WithSources(CustomSource("claim", extractor))}, wantErr: true},
+		{name: "nil extractor", opts: []Option{WithSources(CustomSource("claim", nil, AllowAnyPeer()))}, wantErr: true},
+		{name: "empty name", opts: []Option{WithSources(CustomSource(" ", extractor, AllowAnyPeer()))}, wantErr: true},
+		{name: "name collides with built-in", opts: []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(CustomSource("x-real-ip", extractor), SourceXRealIP)}, wantErr: true},
+		{name: "untrusted peer policy", opts: []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), withCustomSourcePolicy(extractor)}},
+		{name: "any-peer source rejects untrusted peer policy", opts: []Option{withAnyPeerUntrustedPolicy(extractor)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func withCustomSourcePolicy(extractor Extractor) Option {
+	source := CustomSource("claim", extractor)
+	return optionFunc(func(c *options) {
+		WithSources(source, SourceRemoteAddr).applyOption(c)
+		WithUntrustedPeerPolicy(source, UntrustedPeerIgnore).applyOption(c)
+	})
+}
+
+func withAnyPeerUntrustedPolicy(extractor Extractor) Option {
+	source := CustomSource("claim", extractor, AllowAnyPeer())
+	return optionFunc(func(c *options) {
+		WithSources(source).applyOption(c)
+		WithUntrustedPeerPolicy(source, UntrustedPeerIgnore).applyOption(c)
+	})
+}
@@ -1,6 +1,7 @@
 package clientip
 
 import (
+	"context"
 	"errors"
 	"fmt"
 )
@@ -27,10 +28,29 @@ func (e *extractor) extractChainSource(
 		}
 		return Extraction{}, e.adaptChainFailure(r, source.source, failure, untrustedProxyMessage)
 	}
+	if result.ParseDefectErr != nil {
+		e.logParseDefects(r, source.source, result.ParseDefectErr)
+	}
 
 	return result, nil
 }
 
+// logParseDefects emits one event per defect joined in
+// Extraction.ParseDefectErr.
+func (e *extractor) logParseDefects(r requestView, source Source, err error) {
+	if e.config.loggerNoop {
+		return
+	}
+
+	defects := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		defects = joined.Unwrap()
+	}
+	for _, defect := range defects {
+		e.logSecurityWarning(r, source, SecurityEventForwardedDefect, "malformed Forwarded parameter tolerated", "parse_error", defect.Error())
+	}
+}
+
 func (e *extractor) extractSingleHeaderSource(r requestView, source *configuredSource) (Extraction, error) {
 	result, failure := source.single.extract(r, source.source)
 	if failure != nil {
@@ -44,17 +64,69 @@ func (e *extractor) extractSingleHeaderSource(r requestView, source *configuredS
 }
 
 func (e *extractor) extractRemoteAddrSource(r requestView, source *configuredSource) (Extraction, error) {
-	result, failure := source.remote.extract(r.remoteAddr(), source.source)
+	result, failure := source.remote.extract(r.context(), r.remoteAddr(), source.source)
 	if failure != nil {
 		if failure.kind == failureSourceUnavailable {
 			return Extraction{}, source.unavailableErr
 		}
-		return Extraction{}, adaptRemoteAddrFailure(failure, source.source)
+		return Extraction{}, e.adaptRemoteAddrFailure(r, source.source, failure)
+	}
+
+	return result, nil
+}
+
+func (e *extractor) extractCustomSource(r requestView, source *configuredSource) (Extraction, error) {
+	result, failure, err := source.custom.extract(r, source.source, false)
+	if err != nil {
+		var signatureErr *SignatureError
+		if errors.As(err, &signatureErr) {
+			return Extraction{}, e.adaptSignatureError(r, source.source, signatureErr)
+		}
+		return Extraction{}, adaptCustomSourceError(err, source.source)
+	}
+	if failure != nil {
+		switch failure.kind {
+		case failureSourceUnavailable:
+			return Extraction{}, source.unavailableErr
+		case failureUntrustedProxy:
+			e.logSecurityWarning(r, source.source, SecurityEventUntrustedProxy, "request received from untrusted proxy while custom source is present")
+			return Extraction{}, &ProxyValidationError{
+				ExtractionError:   ExtractionError{Err: ErrUntrustedProxy, Source: source.source},
+				MinTrustedProxies: failure.minTrustedProxies,
+				MaxTrustedProxies: failure.maxTrustedProxies,
+			}
+		}
+		return Extraction{}, e.adaptSingleHeaderFailure(r, source.source, failure)
 	}
 
 	return result, nil
 }
 
+// adaptSignatureError logs a SignedHeaderSource verification failure and
+// attaches the source. The signature itself is not logged.
+func (e *extractor) adaptSignatureError(r requestView, source Source, err *SignatureError) error {
+	e.logSecurityWarning(
+		r, source, SecurityEventInvalidSignature, "signed client IP header failed verification",
+		"header", err.HeaderName,
+		"reason", err.Reason,
+		"request_id", err.RequestID,
+		"timestamp", err.Timestamp,
+	)
+	adapted := *err
+	adapted.Source = source
+	return &adapted
+}
+
+// adaptCustomSourceError attaches the source to Extractor errors. Context
+// errors stay bare so cancellation is reported the same way as for built-in
+// sources.
+func adaptCustomSourceError(err error, source Source) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return &ExtractionError{Err: err, Source: source}
+}
+
 // logSecurityWarning emits stable base attributes with the request context so
 // caller-provided loggers can attach trace/span metadata.
 func (e *extractor) logSecurityWarning(r requestView, source Source, event, msg string, attrs ...any) {
@@ -69,10 +141,47 @@ func (e *extractor) logSecurityWarning(r requestView, source Source, event, msg
 		"remote_addr", r.remoteAddr(),
 	}
 
+	if e.config.reportOnly {
+		baseAttrs = append(baseAttrs, "report_only", true)
+	}
+
 	baseAttrs = append(baseAttrs, attrs...)
 	e.config.logger.WarnContext(r.context(), msg, baseAttrs...)
 }
 
+// logClientIPRejected records a ClientIPValidator rejection. The policy
+// attribute is present only when a per-source client IP policy applied.
+func (e *extractor) logClientIPRejected(r requestView, source Source, failure *extractionFailure) {
+	attrs := []any{"ip", failure.extractedIP}
+	if failure.clientIPPolicy != "" {
+		attrs = append(attrs, "policy", failure.clientIPPolicy)
+	}
+	attrs = append(attrs, "error", failure.rejection.Error())
+	e.logSecurityWarning(r, source, SecurityEventClientIPRejected, "client IP rejected by validator", attrs...)
+}
+
+// clientIPDispositionError returns the sentinel describing why
+// evaluateClientIP rejected an address.
+func clientIPDispositionError(disposition clientIPDisposition) error {
+	switch disposition {
+	case clientIPPrivate:
+		return ErrPrivateIP
+	case clientIPReserved:
+		return ErrReservedIP
+	case clientIPOpaque:
+		return ErrOpaqueNode
+	default:
+		return ErrInvalidIP
+	}
+}
+
+// clientIPRejectedError keeps ErrInvalidIP classification for validator
+// rejections while leaving the validator error reachable through errors.Is and
+// errors.As.
+func clientIPRejectedError(err error) error {
+	return fmt.Errorf("%w: %w", ErrInvalidIP, err)
+}
+
 func proxyValidationWarningDetails(err error) (event, msg string, ok bool) {
 	switch {
 	case errors.Is(err, ErrNoTrustedProxies):
@@ -135,6 +244,17 @@ func (e *extractor) handleChainError(
 	}
 }
 
+// logMalformedXFF returns the parse-error hook for XFF-format sources. Only
+// XForwardedForStrict produces ErrInvalidXForwardedForHeader.
+func (e *extractor) logMalformedXFF(r requestView, source Source, msg string) func(error) {
+	return func(err error) {
+		if !errors.Is(err, ErrInvalidXForwardedForHeader) {
+			return
+		}
+		e.logSecurityWarning(r, source, SecurityEventMalformedXFF, msg, "parse_error", err.Error())
+	}
+}
+
 // adaptChainFailure converts chain-source policy failures into public errors.
 // Keep new chain failure kinds here so logging and typed errors stay centralized.
 func (e *extractor) adaptChainFailure(r requestView, source Source, failure *extractionFailure, untrustedProxyMessage string) error {
@@ -171,17 +291,81 @@ func (e *extractor) adaptChainFailure(r requestView, source Source, failure *ext
 		return &ExtractionError{Err: ErrInvalidIP, Source: source}
 	case failureInvalidClientIP:
 		return &InvalidIPError{
-			ExtractionError: ExtractionError{Err: ErrInvalidIP, Source: source},
+			ExtractionError: ExtractionError{Err: clientIPDispositionError(failure.clientIPDisposition), Source: source},
 			Chain:           failure.chain,
 			ExtractedIP:     failure.extractedIP,
 			Index:           failure.index,
 			TrustedProxies:  failure.trustedProxyCount,
+			Policy:          failure.clientIPPolicy,
+		}
+	case failureClientIPRejected:
+		e.logClientIPRejected(r, source, failure)
+		return &InvalidIPError{
+			ExtractionError: ExtractionError{Err: clientIPRejectedError(failure.rejection), Source: source},
+			Chain:           failure.chain,
+			ExtractedIP:     failure.extractedIP,
+			Index:           failure.index,
+			TrustedProxies:  failure.trustedProxyCount,
+			Policy:          failure.clientIPPolicy,
+		}
+	case failureHeaderHygiene:
+		return e.adaptHeaderHygieneFailure(r, source, failure)
+	case failureOriginSecret:
+		return e.adaptOriginSecretFailure(r, source, failure)
+	case failureForwardedBy:
+		e.logSecurityWarning(
+			r, source, SecurityEventForwardedByMismatch, "Forwarded by= does not match the receiving proxy",
+			"index", failure.index,
+			"by", failure.extractedIP,
+			"expected", failure.expectedBy,
+		)
+		return &ForwardedByError{
+			ExtractionError: ExtractionError{Err: ErrForwardedByMismatch, Source: source},
+			Chain:           failure.chain,
+			Index:           failure.index,
+			By:              failure.extractedIP,
+			Expected:        failure.expectedBy,
 		}
 	default:
 		return &ExtractionError{Err: ErrInvalidIP, Source: source}
 	}
 }
 
+// adaptHeaderHygieneFailure logs and converts a WithHeaderHygiene rejection.
+// The raw value is not logged because it is the suspicious payload.
+func (e *extractor) adaptHeaderHygieneFailure(r requestView, source Source, failure *extractionFailure) error {
+	e.logSecurityWarning(
+		r, source, SecurityEventInvalidHeaderValue, "header value failed hygiene validation",
+		"header", failure.headerName,
+		"size", failure.headerSize,
+		"max_bytes", failure.maxHeaderBytes,
+		"offset", failure.index,
+	)
+	return &HeaderHygieneError{
+		ExtractionError: ExtractionError{Err: ErrInvalidHeaderValue, Source: source},
+		HeaderName:      failure.headerName,
+		Size:            failure.headerSize,
+		MaxBytes:        failure.maxHeaderBytes,
+		Offset:          failure.index,
+	}
+}
+
+// adaptOriginSecretFailure logs and converts a WithOriginSecret rejection. The
+// header value is not logged because it may be a near-miss of the secret.
+func (e *extractor) adaptOriginSecretFailure(r requestView, source Source, failure *extractionFailure) error {
+	e.logSecurityWarning(
+		r, source, SecurityEventOriginSecretMismatch, "origin secret header did not match a configured secret",
+		"header", failure.headerName,
+		"header_count", failure.headerCount,
+		"reason", failure.originReason,
+	)
+	return &OriginSecretError{
+		ExtractionError: ExtractionError{Err: ErrUntrustedProxy, Source: source},
+		HeaderName:      failure.headerName,
+		Reason:          failure.originReason,
+	}
+}
+
 // adaptSingleHeaderFailure converts single-header policy failures into public
 // errors and emits the spoofing-related warnings for duplicate/untrusted input.
 func (e *extractor) adaptSingleHeaderFailure(r requestView, sourceName Source, failure *extractionFailure) error {
@@ -218,9 +402,21 @@ func (e *extractor) adaptSingleHeaderFailure(r requestView, sourceName Source, f
 		}
 	case failureInvalidClientIP:
 		return &InvalidIPError{
-			ExtractionError: ExtractionError{Err: ErrInvalidIP, Source: sourceName},
+			ExtractionError: ExtractionError{Err: clientIPDispositionError(failure.clientIPDisposition), Source: sourceName},
 			ExtractedIP:     failure.extractedIP,
+			Policy:          failure.clientIPPolicy,
 		}
+	case failureClientIPRejected:
+		e.logClientIPRejected(r, sourceName, failure)
+		return &InvalidIPError{
+			ExtractionError: ExtractionError{Err: clientIPRejectedError(failure.rejection), Source: sourceName},
+			ExtractedIP:     failure.extractedIP,
+			Policy:          failure.clientIPPolicy,
+		}
+	case failureHeaderHygiene:
+		return e.adaptHeaderHygieneFailure(r, sourceName, failure)
+	case failureOriginSecret:
+		return e.adaptOriginSecretFailure(r, sourceName, failure)
 	default:
 		return &ExtractionError{Err: ErrInvalidIP, Source: sourceName}
 	}
@@ -228,7 +424,7 @@ func (e *extractor) adaptSingleHeaderFailure(r requestView, sourceName Source, f
 
 // adaptRemoteAddrFailure converts RemoteAddr parsing/policy failures into the
 // public RemoteAddrError shape.
-func adaptRemoteAddrFailure(failure *extractionFailure, sourceName Source) error {
+func (e *extractor) adaptRemoteAddrFailure(r requestView, sourceName Source, failure *extractionFailure) error {
 	if failure == nil {
 		return &ExtractionError{Err: ErrInvalidIP, Source: sourceName}
 	}
@@ -238,8 +434,16 @@ func adaptRemoteAddrFailure(failure *extractionFailure, sourceName Source) error
 		return &ExtractionError{Err: ErrSourceUnavailable, Source: sourceName}
 	case failureInvalidClientIP:
 		return &RemoteAddrError{
-			ExtractionError: ExtractionError{Err: ErrInvalidIP, Source: sourceName},
+			ExtractionError: ExtractionError{Err: clientIPDispositionError(failure.clientIPDisposition), Source: sourceName},
+			RemoteAddr:      failure.remoteAddr,
+			Policy:          failure.clientIPPolicy,
+		}
+	case failureClientIPRejected:
+		e.logClientIPRejected(r, sourceName, failure)
+		return &RemoteAddrError{
+			ExtractionError: ExtractionError{Err: clientIPRejectedError(failure.rejection), Source: sourceName},
 			RemoteAddr:      failure.remoteAddr,
+			Policy:          failure.clientIPPolicy,
 		}
 	default:
 		return &ExtractionError{Err: ErrInvalidIP, Source: sourceName}
@@ -259,14 +463,17 @@ func adaptForwardedParseError(err error, source Source, extractor *extractor) er
 	}
 }
 
-// adaptXFFParseError currently only maps XFF parser errors that are chain-limit
-// failures; other XFF parsing is intentionally permissive.
+// adaptXFFParseError maps XFF chain-limit failures and the syntax errors that
+// only XForwardedForStrict reports.
 func adaptXFFParseError(err error, source Source, extractor *extractor) error {
 	if chainErr := adaptChainLengthError(err, source, extractor); chainErr != nil {
 		return chainErr
 	}
 
-	return err
+	return &ExtractionError{
+		Err:    fmt.Errorf("%w: %w", ErrInvalidXForwardedForHeader, err),
+		Source: source,
+	}
 }
 
 func adaptChainLengthError(err error, source Source, _ *extractor) error {
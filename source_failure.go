@@ -10,6 +10,10 @@ const (
 	failureProxyValidation
 	failureEmptyChain
 	failureInvalidClientIP
+	failureClientIPRejected
+	failureForwardedBy
+	failureHeaderHygiene
+	failureOriginSecret
 )
 
 // errSourceUnavailable is a pre-allocated sentinel returned by extractors when
@@ -24,12 +28,18 @@ type extractionFailure struct {
 	source              Source
 	headerName          string
 	headerCount         int
+	headerSize          int
+	maxHeaderBytes      int
 	remoteAddr          string
 	chain               string
 	index               int
 	extractedIP         string
+	expectedBy          string
+	originReason        string
 	trustedProxyCount   int
 	minTrustedProxies   int
 	maxTrustedProxies   int
 	clientIPDisposition clientIPDisposition
+	clientIPPolicy      string
+	rejection           error
 }
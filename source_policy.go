@@ -0,0 +1,273 @@
+package clientip
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// UntrustedPeerPolicy controls what a header source does when its header is
+// present on a request whose immediate peer is not a trusted proxy.
+type UntrustedPeerPolicy uint8
+
+const (
+	// UntrustedPeerReject fails resolution with ErrUntrustedProxy. This is the
+	// default and the fail-closed choice.
+	UntrustedPeerReject UntrustedPeerPolicy = iota
+	// UntrustedPeerIgnore treats the header as unavailable so the next source,
+	// such as SourceRemoteAddr, can run. The untrusted_proxy security event is
+	// still emitted and Result.SpoofAttemptIgnored is set. WithOriginSecret
+	// failures from a trusted peer are not ignored.
+	UntrustedPeerIgnore
+)
+
+// String returns the stable label for p.
+func (p UntrustedPeerPolicy) String() string {
+	switch p {
+	case UntrustedPeerReject:
+		return "reject"
+	case UntrustedPeerIgnore:
+		return "ignore"
+	default:
+		return "unknown"
+	}
+}
+
+func (p UntrustedPeerPolicy) valid() bool {
+	return p == UntrustedPeerReject || p == UntrustedPeerIgnore
+}
+
+// WithUntrustedPeerPolicy sets how source handles a header received from an
+// untrusted immediate peer.
+//
+// UntrustedPeerIgnore is useful when clients commonly send forwarding headers
+// directly and the app should fall through to SourceRemoteAddr instead of
+// failing. It never makes the header trusted: the spoofed value is discarded.
+// source must be a header source, or a CustomSource without AllowAnyPeer,
+// listed in WithSources.
+func WithUntrustedPeerPolicy(source Source, policy UntrustedPeerPolicy) Option {
+	return optionFunc(func(c *options) {
+		if c.UntrustedPeerPolicies == nil {
+			c.UntrustedPeerPolicies = make(map[Source]UntrustedPeerPolicy)
+		}
+		c.UntrustedPeerPolicies[source] = policy
+	})
+}
+
+// WithSourceFailurePolicy declares which failure kinds of source are
+// skippable.
+//
+// By default only ErrSourceUnavailable lets the next source run. A skippable
+// failure is treated the same way: its security event is still logged, the
+// typed error is joined into Result.SkippedErr, and resolution continues
+// with the next source. Allowed kinds are ResultInvalid, ResultMalformed, and
+// ResultUntrusted; context cancellation is always terminal.
+//
+// Use this for optional, best-effort sources such as a sidecar header while
+// keeping primary sources like X-Forwarded-For fail-closed. source must be
+// listed in WithSources. Calling it again for the same source replaces the
+// previous kinds.
+func WithSourceFailurePolicy(source Source, skippable ...ResultKind) Option {
+	kinds := slices.Clone(skippable)
+	return optionFunc(func(c *options) {
+		if c.SourceFailurePolicies == nil {
+			c.SourceFailurePolicies = make(map[Source][]ResultKind)
+		}
+		c.SourceFailurePolicies[source] = kinds
+	})
+}
+
+// WithSourceClientIPPolicy replaces the resolver-wide client-IP plausibility
+// policy for one source.
+//
+// Use it when one trusted path legitimately carries addresses that must be
+// rejected elsewhere, such as an internal service header with RFC1918 clients
+// next to a public X-Forwarded-For path. The resolver-wide WithAllowPrivateIPs
+// and WithAllowedReservedClientPrefixes settings do not apply to source. When
+// this policy rejects an address, its name is reported in
+// InvalidIPError.Policy and RemoteAddrError.Policy. source must be listed in
+// WithSources.
+func WithSourceClientIPPolicy(source Source, policy ClientIPPolicy) Option {
+	policy.AllowedReservedClientPrefixes = clonePrefixes(policy.AllowedReservedClientPrefixes)
+	return optionFunc(func(c *options) {
+		if c.SourceClientIPPolicies == nil {
+			c.SourceClientIPPolicies = make(map[Source]ClientIPPolicy)
+		}
+		c.SourceClientIPPolicies[source] = policy
+	})
+}
+
+// resultKindSet is a compact set of ResultKind values for hot-path lookups.
+type resultKindSet uint16
+
+func newResultKindSet(kinds []ResultKind) resultKindSet {
+	var set resultKindSet
+	for _, kind := range kinds {
+		set |= 1 << kind
+	}
+	return set
+}
+
+func (s resultKindSet) contains(kind ResultKind) bool {
+	return s&(1<<kind) != 0
+}
+
+func (s resultKindSet) kinds() []ResultKind {
+	var kinds []ResultKind
+	for kind := ResultUnknown; kind <= ResultAnonymous; kind++ {
+		if s.contains(kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+func skippableFailureKind(kind ResultKind) bool {
+	return kind == ResultInvalid || kind == ResultMalformed || kind == ResultUntrusted
+}
+
+// canonicalSourceMap re-keys per-source settings by canonical Source so that
+// aliases such as HeaderSource("X-Forwarded-For") and SourceXForwardedFor
+// address the same configured source.
+func canonicalSourceMap[V any](values map[Source]V) map[Source]V {
+	if len(values) == 0 {
+		return nil
+	}
+
+	canonical := make(map[Source]V, len(values))
+	for source, value := range values {
+		canonical[canonicalSource(source)] = value
+	}
+	return canonical
+}
+
+// validatePerSourceSetting rejects per-source settings for sources that are
+// invalid or not part of the configured priority list.
+func (c *config) validatePerSourceSetting(setting string, source Source, headerOnly bool) error {
+	if !source.valid() {
+		return fmt.Errorf("%s: source names cannot be empty", setting)
+	}
+	if !slices.Contains(c.sourcePriority, source) {
+		return fmt.Errorf("%s configured for source %q that is not in the priority list", setting, source)
+	}
+	if headerOnly && !source.peerChecked() {
+		return fmt.Errorf("%s requires a header source, got %q", setting, source)
+	}
+	return nil
+}
+
+func (c *config) validateUntrustedPeerPolicies() error {
+	for source, policy := range c.untrustedPeerPolicies {
+		if !policy.valid() {
+			return fmt.Errorf("invalid untrusted peer policy %d for source %q", policy, source)
+		}
+		if err := c.validatePerSourceSetting("untrusted peer policy", source, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *config) validateSourceFailurePolicies() error {
+	for source, kinds := range c.sourceFailurePolicies {
+		if err := c.validatePerSourceSetting("source failure policy", source, false); err != nil {
+			return err
+		}
+		for _, kind := range kinds {
+			if !skippableFailureKind(kind) {
+				return fmt.Errorf("source failure policy for %q cannot skip %q failures; allowed kinds are %q, %q, and %q",
+					source, kind, ResultInvalid, ResultMalformed, ResultUntrusted)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeSourceClientIPPolicies validates reserved prefixes and builds the
+// internal per-source policies, naming unnamed policies after their source.
+func normalizeSourceClientIPPolicies(policies map[Source]ClientIPPolicy) (map[Source]clientIPPolicy, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	normalized := make(map[Source]clientIPPolicy, len(policies))
+	for source, policy := range canonicalSourceMap(policies) {
+		var allowed []netip.Prefix
+		if policy.AllowedReservedClientPrefixes != nil {
+			prefixes, err := normalizeReservedClientPrefixes(policy.AllowedReservedClientPrefixes)
+			if err != nil {
+				return nil, fmt.Errorf("client IP policy for %q: %w", source, err)
+			}
+			allowed = mergeUniquePrefixes(nil, prefixes...)
+		}
+
+		name := policy.Name
+		if name == "" {
+			name = "source:" + source.String()
+		}
+
+		normalized[source] = clientIPPolicy{
+			Name:                        name,
+			AllowPrivateIPs:             policy.AllowPrivateIPs,
+			AllowReservedClientPrefixes: allowed,
+			perSource:                   true,
+		}
+	}
+	return normalized, nil
+}
+
+func (c *config) validateSourceClientIPPolicies() error {
+	for source := range c.sourceClientIPPolicies {
+		if err := c.validatePerSourceSetting("client IP policy", source, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientIPPolicyFor returns the per-source client-IP policy for source, or the
+// resolver-wide policy when none is configured. Per-source policies share the
+// resolver's validator, reserved-range table, and embedded-IPv4 unwrapping.
+func (c *config) clientIPPolicyFor(source Source) clientIPPolicy {
+	if policy, ok := c.sourceClientIPPolicies[source]; ok {
+		policy.Validator = c.clientIP.Validator
+		policy.reserved = c.clientIP.reserved
+		policy.embedded = c.clientIP.embedded
+		return policy
+	}
+	return c.clientIP
+}
+
+// skipFailure reports whether err from source may fall through to the next
+// configured source, and whether it was an ignored untrusted-peer header.
+func (s *configuredSource) skipFailure(err error) (skip, spoofIgnored bool) {
+	if s.ignoreUntrustedPeer && isUntrustedPeerError(err) {
+		return true, true
+	}
+	if s.skippableFailures != 0 && s.skippableFailures.contains(ClassifyError(err)) {
+		return true, false
+	}
+	return false, false
+}
+
+// isUntrustedPeerError reports whether err is the ProxyValidationError a
+// header source returns for an untrusted immediate peer. OriginSecretError
+// also wraps ErrUntrustedProxy but must not be ignored, so the sentinel alone
+// is not enough.
+func isUntrustedPeerError(err error) bool {
+	var proxyErr *ProxyValidationError
+	return errors.As(err, &proxyErr) && errors.Is(proxyErr.Err, ErrUntrustedProxy)
+}
+
+// ignoredUntrustedPeerSources lists sources using UntrustedPeerIgnore in
+// priority order.
+func (c *config) ignoredUntrustedPeerSources() []Source {
+	var sources []Source
+	for _, source := range c.sourcePriority {
+		if c.untrustedPeerPolicies[source] == UntrustedPeerIgnore {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
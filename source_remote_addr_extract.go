@@ -1,17 +1,19 @@
 package clientip
 
+import "context"
+
 type remoteAddrExtractor struct {
 	clientIPPolicy clientIPPolicy
 }
 
 // extract resolves the immediate connecting peer. This is the only source that
 // does not depend on trusted proxy configuration.
-func (e remoteAddrExtractor) extract(remoteAddr string, source Source) (Extraction, *extractionFailure) {
+func (e remoteAddrExtractor) extract(ctx context.Context, remoteAddr string, source Source) (Extraction, *extractionFailure) {
 	if remoteAddr == "" {
 		return Extraction{}, errSourceUnavailable
 	}
 
-	ip := parseRemoteAddr(remoteAddr)
+	ip, wrapper := e.clientIPPolicy.embedded.unwrap(parseRemoteAddr(remoteAddr))
 	disposition := evaluateClientIP(ip, e.clientIPPolicy)
 	if disposition != clientIPValid {
 		return Extraction{}, &extractionFailure{
@@ -19,11 +21,25 @@ func (e remoteAddrExtractor) extract(remoteAddr string, source Source) (Extracti
 			source:              source,
 			remoteAddr:          remoteAddr,
 			clientIPDisposition: disposition,
+			clientIPPolicy:      e.clientIPPolicy.rejectionName(ip),
+		}
+	}
+
+	ip = normalizeIP(ip)
+	if err := e.clientIPPolicy.validate(ctx, ip, source); err != nil {
+		return Extraction{}, &extractionFailure{
+			kind:           failureClientIPRejected,
+			source:         source,
+			remoteAddr:     remoteAddr,
+			extractedIP:    ip.String(),
+			rejection:      err,
+			clientIPPolicy: e.clientIPPolicy.rejectionName(ip),
 		}
 	}
 
 	return Extraction{
-		IP:     normalizeIP(ip),
-		Source: source,
+		IP:        ip,
+		Source:    source,
+		WrapperIP: wrapper,
 	}, nil
 }
@@ -1,6 +1,8 @@
 package clientip
 
 import (
+	"context"
+	"errors"
 	"net/netip"
 	"testing"
 )
@@ -9,7 +11,7 @@ func TestRemoteAddrExtractor_ValidAddr(t *testing.T) {
 	ext := remoteAddrExtractor{}
 	source := SourceRemoteAddr
 
-	result, failure := ext.extract("8.8.8.8:8080", source)
+	result, failure := ext.extract(context.Background(), "8.8.8.8:8080", source)
 	if failure != nil {
 		t.Fatalf("unexpected failure: %+v", failure)
 	}
@@ -26,7 +28,7 @@ func TestRemoteAddrExtractor_ValidAddrWithoutPort(t *testing.T) {
 	ext := remoteAddrExtractor{}
 	source := SourceRemoteAddr
 
-	result, failure := ext.extract("8.8.8.8", source)
+	result, failure := ext.extract(context.Background(), "8.8.8.8", source)
 	if failure != nil {
 		t.Fatalf("unexpected failure: %+v", failure)
 	}
@@ -40,7 +42,7 @@ func TestRemoteAddrExtractor_IPv6(t *testing.T) {
 	ext := remoteAddrExtractor{}
 	source := SourceRemoteAddr
 
-	result, failure := ext.extract("[2606:4700::1]:443", source)
+	result, failure := ext.extract(context.Background(), "[2606:4700::1]:443", source)
 	if failure != nil {
 		t.Fatalf("unexpected failure: %+v", failure)
 	}
@@ -53,7 +55,7 @@ func TestRemoteAddrExtractor_IPv6(t *testing.T) {
 func TestRemoteAddrExtractor_EmptyAddr(t *testing.T) {
 	ext := remoteAddrExtractor{}
 
-	_, failure := ext.extract("", SourceRemoteAddr)
+	_, failure := ext.extract(context.Background(), "", SourceRemoteAddr)
 	if failure == nil {
 		t.Fatal("expected failure, got nil")
 	}
@@ -65,7 +67,7 @@ func TestRemoteAddrExtractor_EmptyAddr(t *testing.T) {
 func TestRemoteAddrExtractor_InvalidIP(t *testing.T) {
 	ext := remoteAddrExtractor{}
 
-	_, failure := ext.extract("not-an-ip", SourceRemoteAddr)
+	_, failure := ext.extract(context.Background(), "not-an-ip", SourceRemoteAddr)
 	if failure == nil {
 		t.Fatal("expected failure, got nil")
 	}
@@ -77,7 +79,7 @@ func TestRemoteAddrExtractor_InvalidIP(t *testing.T) {
 func TestRemoteAddrExtractor_LoopbackIP(t *testing.T) {
 	ext := remoteAddrExtractor{}
 
-	_, failure := ext.extract("127.0.0.1:8080", SourceRemoteAddr)
+	_, failure := ext.extract(context.Background(), "127.0.0.1:8080", SourceRemoteAddr)
 	if failure == nil {
 		t.Fatal("expected failure for loopback, got nil")
 	}
@@ -89,7 +91,7 @@ func TestRemoteAddrExtractor_LoopbackIP(t *testing.T) {
 func TestRemoteAddrExtractor_UnspecifiedIP(t *testing.T) {
 	ext := remoteAddrExtractor{}
 
-	_, failure := ext.extract("0.0.0.0:80", SourceRemoteAddr)
+	_, failure := ext.extract(context.Background(), "0.0.0.0:80", SourceRemoteAddr)
 	if failure == nil {
 		t.Fatal("expected failure for unspecified IP, got nil")
 	}
@@ -101,7 +103,7 @@ func TestRemoteAddrExtractor_UnspecifiedIP(t *testing.T) {
 func TestRemoteAddrExtractor_PrivateIPRejectedByDefault(t *testing.T) {
 	ext := remoteAddrExtractor{}
 
-	_, failure := ext.extract("192.168.1.1:80", SourceRemoteAddr)
+	_, failure := ext.extract(context.Background(), "192.168.1.1:80", SourceRemoteAddr)
 	if failure == nil {
 		t.Fatal("expected failure for private IP with default policy, got nil")
 	}
@@ -115,7 +117,7 @@ func TestRemoteAddrExtractor_PrivateIPAllowed(t *testing.T) {
 		clientIPPolicy: clientIPPolicy{AllowPrivateIPs: true},
 	}
 
-	result, failure := ext.extract("192.168.1.1:80", SourceRemoteAddr)
+	result, failure := ext.extract(context.Background(), "192.168.1.1:80", SourceRemoteAddr)
 	if failure != nil {
 		t.Fatalf("unexpected failure: %+v", failure)
 	}
@@ -129,7 +131,7 @@ func TestRemoteAddrExtractor_SourcePreserved(t *testing.T) {
 	ext := remoteAddrExtractor{}
 	source := SourceRemoteAddr
 
-	_, failure := ext.extract("not-valid", source)
+	_, failure := ext.extract(context.Background(), "not-valid", source)
 	if failure == nil {
 		t.Fatal("expected failure")
 	}
@@ -137,3 +139,28 @@ func TestRemoteAddrExtractor_SourcePreserved(t *testing.T) {
 		t.Errorf("failure.source = %v, want %v", failure.source, source)
 	}
 }
+
+func TestRemoteAddrExtractor_ValidatorRejects(t *testing.T) {
+	rejection := errors.New("egress NAT address")
+	var gotIP netip.Addr
+	ext := remoteAddrExtractor{
+		clientIPPolicy: clientIPPolicy{
+			Name: "default",
+			Validator: func(_ context.Context, ip netip.Addr, _ Source) error {
+				gotIP = ip
+				return rejection
+			},
+		},
+	}
+
+	_, failure := ext.extract(context.Background(), "[::ffff:8.8.8.8]:80", SourceRemoteAddr)
+	if failure == nil {
+		t.Fatal("expected failure")
+	}
+	if failure.kind != failureClientIPRejected || failure.rejection != rejection || failure.clientIPPolicy != "" {
+		t.Errorf("failure = %+v, want validator rejection", failure)
+	}
+	if want := netip.MustParseAddr("8.8.8.8"); gotIP != want {
+		t.Errorf("validator IP = %v, want normalized %v", gotIP, want)
+	}
+}
@@ -17,6 +17,7 @@ type requestView struct {
 	pathValue       string
 	headerMap       map[string][]string
 	headerFunc      headerValuesFunc
+	request         *http.Request
 }
 
 func (r requestView) context() context.Context {
@@ -60,6 +61,7 @@ func requestViewFromRequest(r *http.Request) requestView {
 		ctx:             r.Context(),
 		remoteAddrValue: r.RemoteAddr,
 		headerMap:       map[string][]string(r.Header),
+		request:         r,
 	}
 	if r.URL != nil {
 		view.pathValue = r.URL.Path
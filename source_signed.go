@@ -0,0 +1,295 @@
+package clientip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Signature failure reasons reported in SignatureError.Reason and the
+// invalid_signature security event.
+const (
+	SignatureMissing   = "missing"
+	SignatureMalformed = "malformed"
+	SignatureMismatch  = "mismatch"
+	SignatureExpired   = "expired"
+	SignatureFuture    = "future"
+	SignatureReplayed  = "replayed"
+)
+
+const (
+	defaultSignatureMaxClockSkew = 5 * time.Second
+	defaultSignatureReplayWindow = 30 * time.Second
+	minSignatureKeyBytes         = 16
+)
+
+// SignedHeaderConfig configures SignedHeaderSource.
+type SignedHeaderConfig struct {
+	// Header carries the client IP, for example X-Edge-Client-IP.
+	Header string
+	// SignatureHeader carries the hex-encoded HMAC-SHA256 signature.
+	SignatureHeader string
+	// TimestampHeader carries the signing time in Unix seconds.
+	TimestampHeader string
+	// RequestIDHeader carries a per-request ID that is included in the
+	// signature. Each request ID is accepted once within ReplayWindow by the
+	// returned source, so resolvers that evaluate the same request, such as a
+	// ShadowResolver candidate, need their own SignedHeaderSource. It is
+	// required unless AllowReplays is set.
+	RequestIDHeader string
+	// AllowReplays accepts signatures without a request ID when the edge
+	// cannot send one. The source then has only timestamp freshness and no
+	// replay protection: a captured signed header can be replayed from any
+	// accepted peer until its timestamp leaves ReplayWindow. It cannot be
+	// combined with RequestIDHeader.
+	AllowReplays bool
+	// Keys lists the accepted HMAC keys, each at least 16 bytes. List the
+	// current and the previous key during rotation.
+	Keys [][]byte
+	// MaxClockSkew is how far the timestamp may be ahead of the local clock.
+	// Zero uses 5 seconds.
+	MaxClockSkew time.Duration
+	// ReplayWindow is how old the timestamp may be. Zero uses 30 seconds.
+	ReplayWindow time.Duration
+	// AllowAnyPeer accepts validly signed headers regardless of whether the
+	// immediate peer is a trusted proxy, like the AllowAnyPeer
+	// CustomSourceOption.
+	AllowAnyPeer bool
+}
+
+// SignedHeaderSource returns a source that honors a client IP header only when
+// it carries a valid HMAC-SHA256 signature from your own edge.
+//
+// The edge signs the client IP, the timestamp, and the request ID (empty with
+// AllowReplays) joined by newlines:
+//
+//	hex(HMAC-SHA256(key, ip + "\n" + timestamp + "\n" + requestID))
+//
+// Requests without Header leave the source unavailable. Requests with Header
+// but a missing, malformed, mismatched, stale, future, or replayed signature
+// emit the invalid_signature security event and fail with a SignatureError
+// wrapping ErrInvalidSignature, classified as ResultUntrusted. The verified
+// address then goes through the client-IP policy like any other source.
+//
+// The source is a CustomSource named name: by default it is also subject to
+// the trusted-peer check, and with AllowAnyPeer it does not require
+// WithTrustedProxies. Configuration errors are reported by New.
+func SignedHeaderSource(name string, config SignedHeaderConfig) Source {
+	verifier := newSignedHeaderExtractor(config)
+	if config.AllowAnyPeer {
+		return CustomSource(name, verifier, AllowAnyPeer())
+	}
+	return CustomSource(name, verifier)
+}
+
+// signedHeaderExtractor verifies SignedHeaderConfig signatures. It is shared by
+// pointer through the CustomSource, so its replay cache is per source.
+type signedHeaderExtractor struct {
+	header          string
+	signatureHeader string
+	timestampHeader string
+	requestIDHeader string
+	allowReplays    bool
+	keys            [][]byte
+	maxClockSkew    time.Duration
+	replayWindow    time.Duration
+	err             error
+
+	now    func() time.Time
+	replay replayCache
+}
+
+func newSignedHeaderExtractor(config SignedHeaderConfig) *signedHeaderExtractor {
+	e := &signedHeaderExtractor{
+		header:          canonicalOptionalHeader(config.Header),
+		signatureHeader: canonicalOptionalHeader(config.SignatureHeader),
+		timestampHeader: canonicalOptionalHeader(config.TimestampHeader),
+		requestIDHeader: canonicalOptionalHeader(config.RequestIDHeader),
+		allowReplays:    config.AllowReplays,
+		maxClockSkew:    config.MaxClockSkew,
+		replayWindow:    config.ReplayWindow,
+		now:             time.Now,
+	}
+	if e.maxClockSkew == 0 {
+		e.maxClockSkew = defaultSignatureMaxClockSkew
+	}
+	if e.replayWindow == 0 {
+		e.replayWindow = defaultSignatureReplayWindow
+	}
+	for _, key := range config.Keys {
+		e.keys = append(e.keys, append([]byte(nil), key...))
+	}
+	e.err = e.validateConfig()
+	return e
+}
+
+func canonicalOptionalHeader(name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return ""
+	}
+	return textproto.CanonicalMIMEHeaderKey(name)
+}
+
+func (e *signedHeaderExtractor) validateConfig() error {
+	if e.header == "" || e.signatureHeader == "" || e.timestampHeader == "" {
+		return errors.New("signed header source requires Header, SignatureHeader, and TimestampHeader")
+	}
+	if (e.requestIDHeader == "") != e.allowReplays {
+		return errors.New("signed header source requires exactly one of RequestIDHeader and AllowReplays")
+	}
+	headers := []string{e.header, e.signatureHeader, e.timestampHeader}
+	if e.requestIDHeader != "" {
+		headers = append(headers, e.requestIDHeader)
+	}
+	for i := range headers {
+		for j := i + 1; j < len(headers); j++ {
+			if headers[i] == headers[j] {
+				return fmt.Errorf("signed header source uses header %q twice", headers[i])
+			}
+		}
+	}
+	if len(e.keys) == 0 {
+		return errors.New("signed header source requires at least one key")
+	}
+	for i, key := range e.keys {
+		if len(key) < minSignatureKeyBytes {
+			return fmt.Errorf("signed header source key %d must be at least %d bytes", i, minSignatureKeyBytes)
+		}
+	}
+	if e.maxClockSkew < 0 || e.replayWindow < 0 {
+		return errors.New("signed header source clock skew and replay window must be >= 0")
+	}
+	return nil
+}
+
+// validate reports configuration errors to New.
+func (e *signedHeaderExtractor) validate() error {
+	return e.err
+}
+
+// Present implements PresenceReporter.
+func (e *signedHeaderExtractor) Present(req SourceRequest) bool {
+	return len(req.view.valuesCanonical(e.header)) > 0
+}
+
+// ExtractClientIP implements Extractor.
+func (e *signedHeaderExtractor) ExtractClientIP(req SourceRequest) (netip.Addr, error) {
+	values := req.view.valuesCanonical(e.header)
+	if len(values) == 0 {
+		return netip.Addr{}, ErrSourceUnavailable
+	}
+
+	signatures := req.view.valuesCanonical(e.signatureHeader)
+	timestamps := req.view.valuesCanonical(e.timestampHeader)
+	var requestIDs []string
+	if e.requestIDHeader != "" {
+		requestIDs = req.view.valuesCanonical(e.requestIDHeader)
+	}
+	if len(signatures) == 0 || len(timestamps) == 0 || (e.requestIDHeader != "" && len(requestIDs) == 0) {
+		return netip.Addr{}, e.failure(SignatureMissing, "", 0)
+	}
+	if len(values) > 1 || len(signatures) > 1 || len(timestamps) > 1 || len(requestIDs) > 1 {
+		return netip.Addr{}, e.failure(SignatureMalformed, "", 0)
+	}
+
+	value := strings.TrimSpace(values[0])
+	requestID := ""
+	if len(requestIDs) == 1 {
+		requestID = strings.TrimSpace(requestIDs[0])
+	}
+	timestamp := strings.TrimSpace(timestamps[0])
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return netip.Addr{}, e.failure(SignatureMalformed, "", 0)
+	}
+	signature, err := hex.DecodeString(strings.TrimSpace(signatures[0]))
+	if err != nil || len(signature) != sha256.Size {
+		return netip.Addr{}, e.failure(SignatureMalformed, "", signedAt)
+	}
+
+	if !e.verify(signature, value, timestamp, requestID) {
+		return netip.Addr{}, e.failure(SignatureMismatch, "", signedAt)
+	}
+
+	// Check freshness only after the signature so unsigned input cannot
+	// claim request IDs in the replay cache.
+	now := e.now()
+	signedTime := time.Unix(signedAt, 0)
+	if signedTime.After(now.Add(e.maxClockSkew)) {
+		return netip.Addr{}, e.failure(SignatureFuture, requestID, signedAt)
+	}
+	if signedTime.Before(now.Add(-e.replayWindow)) {
+		return netip.Addr{}, e.failure(SignatureExpired, requestID, signedAt)
+	}
+	// A consistency peek re-reads a request that may already have claimed
+	// its ID, so it verifies without claiming.
+	if requestID != "" && !req.peek && !e.replay.claim(requestID, signedTime.Add(e.replayWindow+e.maxClockSkew), now) {
+		return netip.Addr{}, e.failure(SignatureReplayed, requestID, signedAt)
+	}
+
+	return parseIP(value), nil
+}
+
+// verify reports whether signature matches any key.
+func (e *signedHeaderExtractor) verify(signature []byte, value, timestamp, requestID string) bool {
+	message := []byte(value + "\n" + timestamp + "\n" + requestID)
+	valid := false
+	for _, key := range e.keys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(message)
+		if hmac.Equal(signature, mac.Sum(nil)) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+func (e *signedHeaderExtractor) failure(reason, requestID string, signedAt int64) *SignatureError {
+	return &SignatureError{
+		ExtractionError: ExtractionError{Err: ErrInvalidSignature},
+		HeaderName:      e.header,
+		Reason:          reason,
+		RequestID:       requestID,
+		Timestamp:       signedAt,
+	}
+}
+
+// replayCache records request IDs until their signatures expire.
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	nextPrune int
+}
+
+// claim records id and reports whether it was not already recorded. Expired
+// entries are swept when the cache doubles in size since the last sweep.
+func (c *replayCache) claim(id string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if expiry, ok := c.seen[id]; ok && now.Before(expiry) {
+		return false
+	}
+	if len(c.seen) >= c.nextPrune {
+		for seenID, expiry := range c.seen {
+			if !now.Before(expiry) {
+				delete(c.seen, seenID)
+			}
+		}
+		c.nextPrune = max(2*len(c.seen), 1024)
+	}
+	c.seen[id] = expires
+	return true
+}
@@ -0,0 +1,282 @@
+package clientip
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var (
+	testSigningKey     = []byte("current-signing-key-0123456789")
+	testPreviousKey    = []byte("previous-signing-key-012345678")
+	testSignedAt       = time.Unix(1_700_000_000, 0)
+	testSignedAtString = strconv.FormatInt(testSignedAt.Unix(), 10)
+)
+
+func signClientIP(key []byte, ip, timestamp, requestID string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ip + "\n" + timestamp + "\n" + requestID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newTestSignedSource(t *testing.T, config SignedHeaderConfig, now time.Time) Source {
+	t.Helper()
+
+	source := SignedHeaderSource("edge_signed", config)
+	source.custom.extractor.(*signedHeaderExtractor).now = func() time.Time { return now }
+	return source
+}
+
+func testSignedHeaderConfig() SignedHeaderConfig {
+	return SignedHeaderConfig{
+		Header:          "X-Edge-Client-IP",
+		SignatureHeader: "X-Edge-Signature",
+		TimestampHeader: "X-Edge-Timestamp",
+		RequestIDHeader: "X-Request-ID",
+		Keys:            [][]byte{testSigningKey, testPreviousKey},
+	}
+}
+
+func TestExtract_SignedHeaderSource(t *testing.T) {
+	validSignature := signClientIP(testSigningKey, "8.8.8.8", testSignedAtString, "req-1")
+
+	tests := []struct {
+		name       string
+		now        time.Time
+		ip         string
+		timestamp  string
+		requestID  string
+		signature  string
+		wantIP     string
+		wantReason string
+	}{
+		{name: "valid", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantIP: "8.8.8.8"},
+		{name: "previous key", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: signClientIP(testPreviousKey, "8.8.8.8", testSignedAtString, "req-1"), wantIP: "8.8.8.8"},
+		{name: "within clock skew", now: testSignedAt.Add(-4 * time.Second), ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantIP: "8.8.8.8"},
+		{name: "within replay window", now: testSignedAt.Add(30 * time.Second), ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantIP: "8.8.8.8"},
+		{name: "missing signature", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", wantReason: SignatureMissing},
+		{name: "missing request id", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, signature: validSignature, wantReason: SignatureMissing},
+		{name: "malformed timestamp", now: testSignedAt, ip: "8.8.8.8", timestamp: "soon", requestID: "req-1", signature: validSignature, wantReason: SignatureMalformed},
+		{name: "malformed signature", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: "zz", wantReason: SignatureMalformed},
+		{name: "spoofed ip", now: testSignedAt, ip: "9.9.9.9", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantReason: SignatureMismatch},
+		{name: "unknown key", now: testSignedAt, ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: signClientIP([]byte("attacker-key-0123456789"), "8.8.8.8", testSignedAtString, "req-1"), wantReason: SignatureMismatch},
+		{name: "future", now: testSignedAt.Add(-6 * time.Second), ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantReason: SignatureFuture},
+		{name: "expired", now: testSignedAt.Add(31 * time.Second), ip: "8.8.8.8", timestamp: testSignedAtString, requestID: "req-1", signature: validSignature, wantReason: SignatureExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			source := newTestSignedSource(t, testSignedHeaderConfig(), tt.now)
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{source}
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			req.Header.Set("X-Edge-Client-IP", tt.ip)
+			req.Header.Set("X-Edge-Timestamp", tt.timestamp)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			if tt.signature != "" {
+				req.Header.Set("X-Edge-Signature", tt.signature)
+			}
+
+			result, err := extractor.Extract(req)
+			if tt.wantIP != "" {
+				if err != nil {
+					t.Fatalf("Extract() error = %v", err)
+				}
+				if result.IP != netip.MustParseAddr(tt.wantIP) || result.Source != source {
+					t.Fatalf("Extract() = %v from %s, want %s", result.IP, result.Source, tt.wantIP)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidSignature) || ClassifyError(err) != ResultUntrusted {
+				t.Fatalf("Extract() error = %v, want %v", err, ErrInvalidSignature)
+			}
+			var signatureErr *SignatureError
+			if !errors.As(err, &signatureErr) {
+				t.Fatalf("error = %T, want *SignatureError", err)
+			}
+			if signatureErr.Reason != tt.wantReason || signatureErr.Source != source || signatureErr.HeaderName != "X-Edge-Client-Ip" {
+				t.Fatalf("SignatureError = %+v, want reason %q", signatureErr, tt.wantReason)
+			}
+
+			entries := logger.snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d events, want 1", len(entries))
+			}
+			assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventInvalidSignature, source, "/", "10.0.0.1:443")
+			assertAttr(t, entries[0].attrs, "reason", tt.wantReason)
+		})
+	}
+}
+
+func TestExtract_SignedHeaderSourceReplay(t *testing.T) {
+	now := testSignedAt
+	source := newTestSignedSource(t, testSignedHeaderConfig(), now)
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{source}
+	extractor := mustNewExtractor(t, cfg)
+
+	request := func(requestID string) error {
+		req := newTestRequest("10.0.0.1:443", "/")
+		req.Header.Set("X-Edge-Client-IP", "8.8.8.8")
+		req.Header.Set("X-Edge-Timestamp", testSignedAtString)
+		req.Header.Set("X-Request-ID", requestID)
+		req.Header.Set("X-Edge-Signature", signClientIP(testSigningKey, "8.8.8.8", testSignedAtString, requestID))
+		_, err := extractor.Extract(req)
+		return err
+	}
+
+	if err := request("req-1"); err != nil {
+		t.Fatalf("first Extract() error = %v", err)
+	}
+	var signatureErr *SignatureError
+	if err := request("req-1"); !errors.As(err, &signatureErr) || signatureErr.Reason != SignatureReplayed || signatureErr.RequestID != "req-1" {
+		t.Fatalf("replayed Extract() error = %v, want %s", err, SignatureReplayed)
+	}
+	if err := request("req-2"); err != nil {
+		t.Fatalf("fresh Extract() error = %v", err)
+	}
+}
+
+func TestExtract_SignedHeaderSourcePeerTrust(t *testing.T) {
+	config := testSignedHeaderConfig()
+	config.RequestIDHeader = ""
+	config.AllowReplays = true
+
+	newInput := func() Input {
+		return Input{
+			RemoteAddr: "1.1.1.1:443",
+			Headers: HeaderValuesFunc(func(name string) []string {
+				switch name {
+				case "X-Edge-Client-Ip":
+					return []string{"8.8.8.8"}
+				case "X-Edge-Timestamp":
+					return []string{testSignedAtString}
+				case "X-Edge-Signature":
+					return []string{signClientIP(testSigningKey, "8.8.8.8", testSignedAtString, "")}
+				}
+				return nil
+			}),
+		}
+	}
+
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{newTestSignedSource(t, config, testSignedAt)}
+	if _, err := mustNewExtractor(t, cfg).ExtractInput(newInput()); !errors.Is(err, ErrUntrustedProxy) {
+		t.Fatalf("ExtractInput() error = %v, want %v", err, ErrUntrustedProxy)
+	}
+
+	config.AllowAnyPeer = true
+	cfg = defaultOptions()
+	cfg.Sources = []Source{newTestSignedSource(t, config, testSignedAt)}
+	result, err := mustNewExtractor(t, cfg).ExtractInput(newInput())
+	if err != nil {
+		t.Fatalf("ExtractInput() error = %v", err)
+	}
+	if result.IP != netip.MustParseAddr("8.8.8.8") {
+		t.Fatalf("IP = %v, want 8.8.8.8", result.IP)
+	}
+}
+
+func TestExtract_SignedHeaderSourceClaimsOnlyAcceptedRequests(t *testing.T) {
+	source := newTestSignedSource(t, testSignedHeaderConfig(), testSignedAt)
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{SourceXRealIP, source, SourceRemoteAddr}
+	WithConsistencyGroup(ConsistencyGroup{Sources: []Source{SourceXRealIP, source}}).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	request := func(remoteAddr string, realIP bool) (Extraction, error) {
+		req := newTestRequest(remoteAddr, "/")
+		if realIP {
+			req.Header.Set("X-Real-IP", "8.8.8.8")
+		}
+		req.Header.Set("X-Edge-Client-IP", "8.8.8.8")
+		req.Header.Set("X-Edge-Timestamp", testSignedAtString)
+		req.Header.Set("X-Request-ID", "req-1")
+		req.Header.Set("X-Edge-Signature", signClientIP(testSigningKey, "8.8.8.8", testSignedAtString, "req-1"))
+		return extractor.Extract(req)
+	}
+
+	if _, err := request("1.1.1.1:443", false); !errors.Is(err, ErrUntrustedProxy) {
+		t.Fatalf("Extract() from untrusted peer error = %v, want %v", err, ErrUntrustedProxy)
+	}
+	if result, err := request("10.0.0.1:443", true); err != nil || result.Source != SourceXRealIP || result.ConsistencyErr != nil {
+		t.Fatalf("Extract() with consistency peek = %+v, %v, want X-Real-IP without mismatch", result, err)
+	}
+	result, err := request("10.0.0.1:443", false)
+	if err != nil {
+		t.Fatalf("Extract() after rejected and peeked requests error = %v, want request ID still unclaimed", err)
+	}
+	if result.Source != source || result.IP != netip.MustParseAddr("8.8.8.8") {
+		t.Fatalf("result = %+v, want 8.8.8.8 from signed source", result)
+	}
+
+	req := newTestRequest("1.1.1.1:443", "/")
+	if result, err := extractor.Extract(req); err != nil || result.Source != SourceRemoteAddr {
+		t.Fatalf("Extract() from untrusted peer without headers = %+v, %v, want remote address", result, err)
+	}
+}
+
+func TestNew_SignedHeaderSourceValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	tests := []struct {
+		name   string
+		mutate func(*SignedHeaderConfig)
+	}{
+		{name: "missing header", mutate: func(c *SignedHeaderConfig) { c.Header = "" }},
+		{name: "missing signature header", mutate: func(c *SignedHeaderConfig) { c.SignatureHeader = " " }},
+		{name: "duplicate header", mutate: func(c *SignedHeaderConfig) { c.RequestIDHeader = "x-edge-timestamp" }},
+		{name: "missing request ID header", mutate: func(c *SignedHeaderConfig) { c.RequestIDHeader = "" }},
+		{name: "request ID header with replays allowed", mutate: func(c *SignedHeaderConfig) { c.AllowReplays = true }},
+		{name: "no keys", mutate: func(c *SignedHeaderConfig) { c.Keys = nil }},
+		{name: "short key", mutate: func(c *SignedHeaderConfig) { c.Keys = [][]byte{[]byte("short")} }},
+		{name: "negative skew", mutate: func(c *SignedHeaderConfig) { c.MaxClockSkew = -time.Second }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := testSignedHeaderConfig()
+			tt.mutate(&config)
+			if _, err := New(trusted, WithSources(SignedHeaderSource("edge_signed", config))); err == nil {
+				t.Fatal("New() error = nil, want rejection")
+			}
+		})
+	}
+
+	if _, err := New(trusted, WithSources(SignedHeaderSource("edge_signed", testSignedHeaderConfig()), SourceRemoteAddr)); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+}
+
+func TestReplayCacheSweepsExpiredEntries(t *testing.T) {
+	var cache replayCache
+	now := testSignedAt
+
+	for i := 0; i < 1024; i++ {
+		if !cache.claim(strconv.Itoa(i), now.Add(time.Second), now) {
+			t.Fatalf("claim(%d) = false, want true", i)
+		}
+	}
+	later := now.Add(2 * time.Second)
+	if !cache.claim("0", later.Add(time.Second), later) {
+		t.Fatal("claim() of expired id = false, want true")
+	}
+	if len(cache.seen) != 1 {
+		t.Fatalf("cache holds %d entries after sweep, want 1", len(cache.seen))
+	}
+}
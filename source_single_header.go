@@ -4,6 +4,7 @@ type singleHeaderPolicy struct {
 	headerName   string
 	clientIP     clientIPPolicy
 	trustedProxy proxyPolicy
+	hygiene      headerHygiene
 }
 
 type singleHeaderExtractor struct {
@@ -34,11 +35,10 @@ func (e singleHeaderExtractor) extract(req requestView, source Source) (Extracti
 		return Extraction{}, errSourceUnavailable
 	}
 
-	if len(e.policy.trustedProxy.TrustedProxyCIDRs) > 0 {
+	if e.policy.trustedProxy.checksPeer() {
 		// Single-IP headers are only meaningful when the immediate peer is
 		// trusted to set or sanitize them.
-		remoteIP := parseRemoteAddr(req.remoteAddr())
-		if !isTrustedProxy(remoteIP, e.policy.trustedProxy.TrustedProxyMatch, e.policy.trustedProxy.TrustedProxyCIDRs) {
+		if !e.policy.trustedProxy.trustsPeer(req) {
 			return Extraction{}, &extractionFailure{
 				kind:              failureUntrustedProxy,
 				source:            source,
@@ -51,7 +51,15 @@ func (e singleHeaderExtractor) extract(req requestView, source Source) (Extracti
 		}
 	}
 
-	ip := parseIP(headerValue)
+	if failure := e.policy.trustedProxy.OriginSecret.check(req, source); failure != nil {
+		return Extraction{}, failure
+	}
+
+	if failure := e.policy.hygiene.check(source, e.policy.headerName, headerValues); failure != nil {
+		return Extraction{}, failure
+	}
+
+	ip, wrapper := e.policy.clientIP.embedded.unwrap(parseIP(headerValue))
 	disposition := evaluateClientIP(ip, e.policy.clientIP)
 	if disposition != clientIPValid {
 		return Extraction{}, &extractionFailure{
@@ -59,11 +67,24 @@ func (e singleHeaderExtractor) extract(req requestView, source Source) (Extracti
 			source:              source,
 			extractedIP:         headerValue,
 			clientIPDisposition: disposition,
+			clientIPPolicy:      e.policy.clientIP.rejectionName(ip),
+		}
+	}
+
+	ip = normalizeIP(ip)
+	if err := e.policy.clientIP.validate(req.context(), ip, source); err != nil {
+		return Extraction{}, &extractionFailure{
+			kind:           failureClientIPRejected,
+			source:         source,
+			extractedIP:    headerValue,
+			rejection:      err,
+			clientIPPolicy: e.policy.clientIP.rejectionName(ip),
 		}
 	}
 
 	return Extraction{
-		IP:     normalizeIP(ip),
-		Source: source,
+		IP:        ip,
+		Source:    source,
+		WrapperIP: wrapper,
 	}, nil
 }
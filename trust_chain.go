@@ -9,6 +9,42 @@ type proxyPolicy struct {
 	TrustedProxyMatch prefixMatcher
 	MinTrustedProxies int
 	MaxTrustedProxies int
+	OpaqueNodes       OpaqueNodePolicy
+	// OriginSecret, when set, must be present before any peer-checked
+	// source is trusted.
+	OriginSecret *originSecret
+	// PeerIdentities, when set, trusts the immediate peer by its verified
+	// client certificate.
+	PeerIdentities *peerIdentityPolicy
+	// Hosts, when set, adds the addresses of WithTrustedProxyHosts.
+	Hosts *TrustedProxyHosts
+}
+
+// hasTrustedProxies reports whether any trusted proxy address source is
+// configured, static or resolved.
+func (p proxyPolicy) hasTrustedProxies() bool {
+	return len(p.TrustedProxyCIDRs) > 0 || p.Hosts != nil
+}
+
+// trusts reports whether ip is a trusted proxy address.
+func (p proxyPolicy) trusts(ip netip.Addr) bool {
+	if isTrustedProxy(ip, p.TrustedProxyMatch, p.TrustedProxyCIDRs) {
+		return true
+	}
+	return p.Hosts != nil && p.Hosts.contains(ip)
+}
+
+// checksPeer reports whether peer-checked sources require a trusted immediate
+// peer.
+func (p proxyPolicy) checksPeer() bool {
+	return p.hasTrustedProxies() || p.PeerIdentities != nil
+}
+
+// trustsPeer reports whether the immediate peer of req is trusted by address
+// or, with WithTrustedPeerIdentities, by client certificate.
+func (p proxyPolicy) trustsPeer(req requestView) bool {
+	addressTrusted := p.hasTrustedProxies() && p.trusts(parseRemoteAddr(req.remoteAddr()))
+	return p.PeerIdentities.trusts(req, addressTrusted)
 }
 
 // chainAnalysis describes the selected client candidate and trusted suffix.
@@ -43,7 +79,7 @@ func isTrustedProxy(ip netip.Addr, matcher prefixMatcher, cidrs []netip.Prefix)
 // validateProxyCountPolicy validates counts of CIDR-trusted hops only. It does
 // not implement count-only trust and cannot make a header source trustworthy.
 func validateProxyCountPolicy(trustedCount int, policy proxyPolicy) error {
-	if len(policy.TrustedProxyCIDRs) > 0 && policy.MinTrustedProxies > 0 && trustedCount == 0 {
+	if policy.hasTrustedProxies() && policy.MinTrustedProxies > 0 && trustedCount == 0 {
 		return ErrNoTrustedProxies
 	}
 
@@ -62,6 +98,7 @@ func validateProxyCountPolicy(trustedCount int, policy proxyPolicy) error {
 // treats the trailing trusted suffix as proxy infrastructure. The first
 // non-trusted hop before that suffix is the client candidate; if every hop is
 // trusted, the oldest hop is selected and still validated as a client IP.
+// Opaque nodes are walked past under OpaqueNodeSkip.
 func analyzeChainRightmost(parts []string, policy proxyPolicy, collectTrustedIndices bool, parseClientIP func(string) netip.Addr) (chainAnalysis, netip.Addr, error) {
 	trustedCount := 0
 	clientIndex := 0
@@ -74,8 +111,11 @@ func analyzeChainRightmost(parts []string, policy proxyPolicy, collectTrustedInd
 
 	for i := len(parts) - 1; i >= 0; i-- {
 		ip := parseClientIP(parts[i])
+		if skipOpaqueHop(policy, parts[i], ip) {
+			continue
+		}
 
-		if !isTrustedProxy(ip, policy.TrustedProxyMatch, policy.TrustedProxyCIDRs) {
+		if !policy.trusts(ip) {
 			clientIndex = i
 			clientIP = ip
 			break
@@ -85,6 +125,7 @@ func analyzeChainRightmost(parts []string, policy proxyPolicy, collectTrustedInd
 			trustedIndices = append(trustedIndices, i)
 		}
 		trustedCount++
+		clientIndex = i
 		clientIP = ip
 	}
 
@@ -104,9 +145,10 @@ func analyzeChainRightmost(parts []string, policy proxyPolicy, collectTrustedInd
 // analyzeChainLeftmost still validates the trailing trusted suffix, then
 // selects the earliest untrusted hop, or the oldest hop if every hop is
 // trusted. This mode assumes trusted proxies produced or sanitized the full
-// chain; otherwise leftmost values are client-controlled.
+// chain; otherwise leftmost values are client-controlled. Opaque nodes are
+// never candidates under OpaqueNodeSkip.
 func analyzeChainLeftmost(parts []string, policy proxyPolicy, collectTrustedIndices bool, parseClientIP func(string) netip.Addr) (chainAnalysis, netip.Addr, error) {
-	if len(policy.TrustedProxyCIDRs) == 0 {
+	if !policy.hasTrustedProxies() {
 		analysis := chainAnalysis{ClientIndex: 0, TrustedCount: 0}
 		return analysis, parseClientIP(parts[0]), nil
 	}
@@ -129,7 +171,10 @@ func analyzeChainLeftmost(parts []string, policy proxyPolicy, collectTrustedIndi
 
 	for i := len(parts) - 1; i >= 0; i-- {
 		ip := parseClientIP(parts[i])
-		trusted := isTrustedProxy(ip, policy.TrustedProxyMatch, policy.TrustedProxyCIDRs)
+		if skipOpaqueHop(policy, parts[i], ip) {
+			continue
+		}
+		trusted := policy.trusts(ip)
 
 		if stillTrailingTrusted && trusted {
 			if collectTrustedIndices {
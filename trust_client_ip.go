@@ -1,10 +1,75 @@
 package clientip
 
-import "net/netip"
+import (
+	"context"
+	"net/netip"
+	"slices"
+)
+
+// defaultClientIPPolicyName labels the resolver-wide client-IP policy built
+// from WithAllowPrivateIPs and WithAllowedReservedClientPrefixes.
+const defaultClientIPPolicyName = "default"
+
+// ClientIPPolicy describes client-IP plausibility rules that can be attached to
+// a single source with WithSourceClientIPPolicy.
+//
+// Loopback, link-local, multicast, and unspecified addresses are always
+// rejected regardless of policy.
+type ClientIPPolicy struct {
+	// Name labels the policy in InvalidIPError and RemoteAddrError. An empty
+	// name defaults to "source:" followed by the source identifier.
+	Name string
+	// AllowPrivateIPs allows RFC1918 and unique-local client addresses.
+	AllowPrivateIPs bool
+	// AllowedReservedClientPrefixes allows selected reserved or special-use
+	// client ranges that are otherwise rejected.
+	AllowedReservedClientPrefixes []netip.Prefix
+}
+
+// ClientIPValidator applies application-specific rules to a client IP that has
+// already passed the built-in plausibility checks.
+//
+// ip is normalized (IPv4-mapped IPv6 is unmapped) and source is the source that
+// produced it. A non-nil error rejects the address. Validators run on every
+// resolution and must be safe for concurrent use.
+type ClientIPValidator func(ctx context.Context, ip netip.Addr, source Source) error
 
 type clientIPPolicy struct {
+	Name                        string
 	AllowPrivateIPs             bool
 	AllowReservedClientPrefixes []netip.Prefix
+	Validator                   ClientIPValidator
+
+	// perSource marks a policy set with WithSourceClientIPPolicy. Only those
+	// are named in InvalidIPError.Policy and RemoteAddrError.Policy.
+	perSource bool
+
+	// reserved is the resolver's reserved-range table; nil uses
+	// builtinReservedTable.
+	reserved *reservedTable
+	// embedded unwraps transition addresses before evaluation; nil disables
+	// unwrapping.
+	embedded *embeddedIPv4Unwrapper
+}
+
+// validate runs the configured ClientIPValidator, if any, on an address that
+// evaluateClientIP accepted.
+func (p clientIPPolicy) validate(ctx context.Context, ip netip.Addr, source Source) error {
+	if p.Validator == nil {
+		return nil
+	}
+	return p.Validator(ctx, ip, source)
+}
+
+// rejectionName returns the policy name reported for a parsed address that
+// evaluateClientIP rejected. Resolver-wide policies and unparsable values are
+// not named, so errors from resolvers without per-source policies keep their
+// established text.
+func (p clientIPPolicy) rejectionName(ip netip.Addr) string {
+	if !p.perSource || !ip.IsValid() {
+		return ""
+	}
+	return p.Name
 }
 
 type clientIPDisposition int
@@ -14,42 +79,91 @@ const (
 	clientIPValid
 	clientIPReserved
 	clientIPPrivate
+	// clientIPOpaque marks an opaque node selected under OpaqueNodeTerminal.
+	clientIPOpaque
 )
 
-var (
-	reservedClientIPv4Prefixes = []netip.Prefix{
-		mustParsePrefix("0.0.0.0/8"),
-		mustParsePrefix("100.64.0.0/10"),
-		mustParsePrefix("192.0.0.0/24"),
-		mustParsePrefix("192.0.2.0/24"),
-		mustParsePrefix("198.18.0.0/15"),
-		mustParsePrefix("198.51.100.0/24"),
-		mustParsePrefix("203.0.113.0/24"),
-		mustParsePrefix("240.0.0.0/4"),
-	}
-
-	reservedClientIPv6Prefixes = []netip.Prefix{
-		mustParsePrefix("64:ff9b::/96"),
-		mustParsePrefix("64:ff9b:1::/48"),
-		mustParsePrefix("100::/64"),
-		mustParsePrefix("2001:2::/48"),
-		mustParsePrefix("2001:db8::/32"),
-		mustParsePrefix("2001:20::/28"),
+// SpecialPurposeRange is one entry of the built-in IANA special-purpose
+// address table that is rejected as a client IP unless allowlisted.
+type SpecialPurposeRange struct {
+	// Prefix is the registered range.
+	Prefix netip.Prefix
+	// Name is the IANA registry name, such as "Documentation (TEST-NET-1)".
+	Name string
+	// Class is AddrCGNAT for shared address space and AddrReserved otherwise.
+	Class AddrClass
+}
+
+// reservedClientRanges follows the names used by the IANA IPv4 and IPv6
+// Special-Purpose Address Registries.
+var reservedClientRanges = []SpecialPurposeRange{
+	{Prefix: mustParsePrefix("0.0.0.0/8"), Name: "This network", Class: AddrReserved},
+	{Prefix: mustParsePrefix("100.64.0.0/10"), Name: "Shared Address Space", Class: AddrCGNAT},
+	{Prefix: mustParsePrefix("192.0.0.0/24"), Name: "IETF Protocol Assignments", Class: AddrReserved},
+	{Prefix: mustParsePrefix("192.0.2.0/24"), Name: "Documentation (TEST-NET-1)", Class: AddrReserved},
+	{Prefix: mustParsePrefix("198.18.0.0/15"), Name: "Benchmarking", Class: AddrReserved},
+	{Prefix: mustParsePrefix("198.51.100.0/24"), Name: "Documentation (TEST-NET-2)", Class: AddrReserved},
+	{Prefix: mustParsePrefix("203.0.113.0/24"), Name: "Documentation (TEST-NET-3)", Class: AddrReserved},
+	{Prefix: mustParsePrefix("240.0.0.0/4"), Name: "Reserved", Class: AddrReserved},
+	{Prefix: mustParsePrefix("64:ff9b::/96"), Name: "IPv4-IPv6 Translation", Class: AddrReserved},
+	{Prefix: mustParsePrefix("64:ff9b:1::/48"), Name: "IPv4-IPv6 Translation (local use)", Class: AddrReserved},
+	{Prefix: mustParsePrefix("100::/64"), Name: "Discard-Only Address Block", Class: AddrReserved},
+	{Prefix: mustParsePrefix("2001:2::/48"), Name: "Benchmarking", Class: AddrReserved},
+	{Prefix: mustParsePrefix("2001:db8::/32"), Name: "Documentation", Class: AddrReserved},
+	{Prefix: mustParsePrefix("2001:20::/28"), Name: "ORCHIDv2", Class: AddrReserved},
+}
+
+// SpecialPurposeRanges returns a copy of the built-in reserved client ranges.
+//
+// These are the ranges reported as AddrReserved or AddrCGNAT by ClassifyAddr
+// and rejected with ErrReservedIP unless allowed with
+// WithAllowedReservedClientPrefixes. WithRejectedClientPrefixes extends the
+// table per resolver without changing this snapshot.
+func SpecialPurposeRanges() []SpecialPurposeRange {
+	return slices.Clone(reservedClientRanges)
+}
+
+// lookupReservedClientRange returns the built-in reserved range containing ip.
+func lookupReservedClientRange(ip netip.Addr) (SpecialPurposeRange, bool) {
+	for _, r := range reservedClientRanges {
+		if r.Prefix.Contains(ip) {
+			return r, true
+		}
 	}
-)
+	return SpecialPurposeRange{}, false
+}
 
-// ipv4SpecialFirstOctet marks first octets that appear in any special IPv4 range
-// (private, reserved, loopback, link-local, multicast). If the first octet is not
-// marked, the address is guaranteed to be a valid public IPv4 — allowing us to
-// skip all individual checks in evaluateClientIP.
-var ipv4SpecialFirstOctet [256]bool
+// reservedTable is the reserved-range lookup used by evaluateClientIP. Each
+// resolver builds its own when WithRejectedClientPrefixes extends the built-in
+// ranges; otherwise builtinReservedTable is shared.
+type reservedTable struct {
+	ipv4 []netip.Prefix
+	ipv6 []netip.Prefix
 
-func init() {
-	// Every IPv4 prefix that evaluateClientIP may treat as non-public.
+	// ipv4SpecialFirstOctet marks first octets that appear in any special IPv4
+	// range (private, reserved, loopback, link-local, multicast). If the first
+	// octet is not marked, the address is guaranteed to be a valid public
+	// IPv4 — allowing evaluateClientIP to skip all individual checks.
+	ipv4SpecialFirstOctet [256]bool
+}
+
+var builtinReservedTable = newReservedTable(nil)
+
+// newReservedTable builds a reserved-range table from the built-in ranges plus
+// extra, which must already be normalized.
+func newReservedTable(extra []netip.Prefix) *reservedTable {
+	table := &reservedTable{}
+	for _, r := range reservedClientRanges {
+		table.add(r.Prefix)
+	}
+	for _, prefix := range extra {
+		table.add(prefix)
+	}
+
+	// Every other IPv4 prefix that evaluateClientIP may treat as non-public.
 	// This must cover the same ranges as the checks in evaluateClientIP:
-	// IsLoopback, IsLinkLocalUnicast, IsMulticast, IsUnspecified, IsPrivate,
-	// plus all entries in reservedClientIPv4Prefixes.
-	specialRanges := append([]netip.Prefix{
+	// IsLoopback, IsLinkLocalUnicast, IsMulticast, IsUnspecified, IsPrivate.
+	for _, prefix := range []netip.Prefix{
 		mustParsePrefix("0.0.0.0/8"),      // IsUnspecified
 		mustParsePrefix("10.0.0.0/8"),     // IsPrivate
 		mustParsePrefix("127.0.0.0/8"),    // IsLoopback
@@ -57,27 +171,57 @@ func init() {
 		mustParsePrefix("172.16.0.0/12"),  // IsPrivate
 		mustParsePrefix("192.168.0.0/16"), // IsPrivate
 		mustParsePrefix("224.0.0.0/3"),    // IsMulticast + future reserved (224.0.0.0–255.255.255.255)
-	}, reservedClientIPv4Prefixes...)
+	} {
+		table.markIPv4SpecialOctets(prefix)
+	}
+
+	return table
+}
 
-	for _, prefix := range specialRanges {
-		markIPv4SpecialOctets(prefix)
+func (t *reservedTable) add(prefix netip.Prefix) {
+	if prefix.Addr().Is4() {
+		t.ipv4 = append(t.ipv4, prefix)
+		t.markIPv4SpecialOctets(prefix)
+		return
 	}
+	t.ipv6 = append(t.ipv6, prefix)
 }
 
 // markIPv4SpecialOctets marks all first octets covered by prefix in the lookup table.
-func markIPv4SpecialOctets(prefix netip.Prefix) {
+func (t *reservedTable) markIPv4SpecialOctets(prefix netip.Prefix) {
 	first := prefix.Addr().As4()[0]
 	bits := prefix.Bits()
 	if bits >= 8 {
-		ipv4SpecialFirstOctet[first] = true
+		t.ipv4SpecialFirstOctet[first] = true
 		return
 	}
 
 	// Prefix wider than /8 — covers multiple first octets.
 	count := 1 << (8 - bits)
 	for i := 0; i < count; i++ {
-		ipv4SpecialFirstOctet[int(first)+i] = true
+		t.ipv4SpecialFirstOctet[int(first)+i] = true
+	}
+}
+
+func (t *reservedTable) contains(ip netip.Addr) bool {
+	if !ip.IsValid() {
+		return false
+	}
+
+	ip = normalizeIP(ip)
+
+	prefixes := t.ipv6
+	if ip.Is4() {
+		prefixes = t.ipv4
+	}
+
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
 	}
+
+	return false
 }
 
 func evaluateClientIP(ip netip.Addr, policy clientIPPolicy) clientIPDisposition {
@@ -85,10 +229,15 @@ func evaluateClientIP(ip netip.Addr, policy clientIPPolicy) clientIPDisposition
 		return clientIPInvalid
 	}
 
+	reserved := policy.reserved
+	if reserved == nil {
+		reserved = builtinReservedTable
+	}
+
 	// Fast path: IPv4 with first octet not in any special range is always
 	// a valid public address. This avoids 6+ sequential method calls for the
 	// common case.
-	if ip.Is4() && !ipv4SpecialFirstOctet[ip.As4()[0]] {
+	if ip.Is4() && !reserved.ipv4SpecialFirstOctet[ip.As4()[0]] {
 		return clientIPValid
 	}
 
@@ -96,7 +245,7 @@ func evaluateClientIP(ip netip.Addr, policy clientIPPolicy) clientIPDisposition
 		return clientIPInvalid
 	}
 
-	if isReservedIP(ip) && !isAllowlistedReservedClientIP(ip, policy.AllowReservedClientPrefixes) {
+	if reserved.contains(ip) && !isAllowlistedReservedClientIP(ip, policy.AllowReservedClientPrefixes) {
 		return clientIPReserved
 	}
 
@@ -107,27 +256,6 @@ func evaluateClientIP(ip netip.Addr, policy clientIPPolicy) clientIPDisposition
 	return clientIPValid
 }
 
-func isReservedIP(ip netip.Addr) bool {
-	if !ip.IsValid() {
-		return false
-	}
-
-	ip = normalizeIP(ip)
-
-	prefixes := reservedClientIPv6Prefixes
-	if ip.Is4() {
-		prefixes = reservedClientIPv4Prefixes
-	}
-
-	for _, prefix := range prefixes {
-		if prefix.Contains(ip) {
-			return true
-		}
-	}
-
-	return false
-}
-
 func isAllowlistedReservedClientIP(ip netip.Addr, allowlist []netip.Prefix) bool {
 	if len(allowlist) == 0 || !ip.IsValid() {
 		return false
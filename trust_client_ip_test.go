@@ -43,7 +43,7 @@ func TestEvaluateClientIP(t *testing.T) {
 	}
 }
 
-func TestIsReservedIP(t *testing.T) {
+func TestReservedTableContains(t *testing.T) {
 	tests := []struct {
 		name     string
 		ip       string
@@ -77,9 +77,9 @@ func TestIsReservedIP(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isReservedIP(netip.MustParseAddr(tt.ip))
+			got := builtinReservedTable.contains(netip.MustParseAddr(tt.ip))
 			if got != tt.reserved {
-				t.Errorf("isReservedIP(%s) = %v, want %v", tt.ip, got, tt.reserved)
+				t.Errorf("builtinReservedTable.contains(%s) = %v, want %v", tt.ip, got, tt.reserved)
 			}
 		})
 	}
@@ -139,3 +139,82 @@ func TestEvaluateClientIPWithAllowedReservedClientPrefixes(t *testing.T) {
 		})
 	}
 }
+
+func TestNewReservedTableWithRejectedPrefixes(t *testing.T) {
+	table := newReservedTable([]netip.Prefix{
+		netip.MustParsePrefix("44.0.0.0/8"),
+		netip.MustParsePrefix("2001:4860::/32"),
+	})
+	policy := clientIPPolicy{reserved: table}
+
+	tests := []struct {
+		name string
+		ip   string
+		want clientIPDisposition
+	}{
+		{name: "rejected IPv4 block", ip: "44.1.2.3", want: clientIPReserved},
+		{name: "rejected IPv6 block", ip: "2001:4860::8888", want: clientIPReserved},
+		{name: "built-in range still rejected", ip: "192.0.2.1", want: clientIPReserved},
+		{name: "neighbouring public octet", ip: "45.1.2.3", want: clientIPValid},
+		{name: "public IPv6", ip: "2606:4700::1", want: clientIPValid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateClientIP(netip.MustParseAddr(tt.ip), policy); got != tt.want {
+				t.Errorf("evaluateClientIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+
+	if !table.ipv4SpecialFirstOctet[44] {
+		t.Fatal("first-octet fast path does not include rejected prefix")
+	}
+	if builtinReservedTable.ipv4SpecialFirstOctet[44] {
+		t.Fatal("per-resolver prefix leaked into the built-in table")
+	}
+	if got := evaluateClientIP(netip.MustParseAddr("44.1.2.3"), clientIPPolicy{}); got != clientIPValid {
+		t.Fatalf("built-in policy evaluateClientIP(44.1.2.3) = %v, want %v", got, clientIPValid)
+	}
+}
+
+func TestReservedTableFirstOctetCoversSpecialRanges(t *testing.T) {
+	table := newReservedTable([]netip.Prefix{netip.MustParsePrefix("96.0.0.0/5")})
+	for octet := 0; octet < 256; octet++ {
+		ip := netip.AddrFrom4([4]byte{byte(octet), 0, 0, 1})
+		if table.ipv4SpecialFirstOctet[octet] {
+			continue
+		}
+		if got := evaluateClientIP(ip, clientIPPolicy{reserved: table}); got != clientIPValid {
+			t.Fatalf("octet %d is not marked special but %s evaluates to %v", octet, ip, got)
+		}
+		if got := ClassifyAddr(ip).Class; got != AddrGlobal && !table.contains(ip) {
+			t.Fatalf("octet %d is not marked special but %s is %v", octet, ip, got)
+		}
+	}
+	for _, octet := range []int{96, 100, 103} {
+		if !table.ipv4SpecialFirstOctet[octet] {
+			t.Fatalf("octet %d not marked for 96.0.0.0/5", octet)
+		}
+	}
+}
+
+func TestSpecialPurposeRangesReturnsCopy(t *testing.T) {
+	ranges := SpecialPurposeRanges()
+	if len(ranges) != len(reservedClientRanges) {
+		t.Fatalf("SpecialPurposeRanges() len = %d, want %d", len(ranges), len(reservedClientRanges))
+	}
+	for _, r := range ranges {
+		if !r.Prefix.IsValid() || r.Name == "" || (r.Class != AddrReserved && r.Class != AddrCGNAT) {
+			t.Fatalf("invalid special-purpose range %+v", r)
+		}
+		if !builtinReservedTable.contains(r.Prefix.Addr()) {
+			t.Fatalf("range %v not rejected by built-in table", r.Prefix)
+		}
+	}
+
+	ranges[0].Prefix = netip.MustParsePrefix("8.8.8.0/24")
+	if SpecialPurposeRanges()[0].Prefix == ranges[0].Prefix {
+		t.Fatal("mutating SpecialPurposeRanges() result changed the built-in table")
+	}
+}
@@ -0,0 +1,181 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// WithForwardedByValidation enables RFC 7239 by= checks for SourceForwarded.
+//
+// The nearest Forwarded element must carry a by= naming the local address the
+// request arrived on, read from http.LocalAddrContextKey, or one of
+// identifiers. Identifiers are IP addresses or obfuscated nodes such as
+// "_edge", for deployments where the last proxy names itself or a load
+// balancer rather than this listener. Each hop the chain walk trusts must also
+// be vouched for by the element before it: that element's by= must name the
+// trusted hop's for= address, so a proxy cannot claim to have received the
+// request from a hop that never recorded forwarding it. Ports are ignored in
+// both comparisons and "unknown" never matches.
+//
+// Failures emit the forwarded_by_mismatch security event and fail with a
+// ForwardedByError wrapping ErrForwardedByMismatch, classified as
+// ResultUntrusted. Calling it again adds identifiers.
+func WithForwardedByValidation(identifiers ...string) Option {
+	identifiers = slices.Clone(identifiers)
+	return optionFunc(func(c *options) {
+		c.ForwardedByValidation = true
+		c.ForwardedByIdentifiers = append(c.ForwardedByIdentifiers, identifiers...)
+	})
+}
+
+// forwardedByPolicy is the normalized WithForwardedByValidation setting.
+type forwardedByPolicy struct {
+	// identifiers are sorted, deduplicated node keys accepted as the nearest
+	// element's by= in addition to the local address.
+	identifiers []string
+	// lenient mirrors ForwardedLenient so by= parsing tolerates the same
+	// defects as the for= pass.
+	lenient bool
+}
+
+func newForwardedByPolicy(enabled bool, identifiers []string) (*forwardedByPolicy, error) {
+	if !enabled {
+		return nil, nil
+	}
+
+	policy := &forwardedByPolicy{identifiers: make([]string, 0, len(identifiers))}
+	for _, identifier := range identifiers {
+		key, ok := forwardedNodeKey(identifier)
+		if !ok {
+			return nil, fmt.Errorf("invalid Forwarded by identifier %q (must be an IP address or obfuscated node)", identifier)
+		}
+		policy.identifiers = append(policy.identifiers, key)
+	}
+	slices.Sort(policy.identifiers)
+	policy.identifiers = slices.Compact(policy.identifiers)
+	return policy, nil
+}
+
+func (c *config) validateForwardedBy() error {
+	if c.forwardedBy == nil {
+		return nil
+	}
+	if !slices.Contains(c.sourcePriority, builtinSource(sourceForwarded)) {
+		return fmt.Errorf("forwarded by= validation requires %q in the priority list", builtinSource(sourceForwarded))
+	}
+	return nil
+}
+
+// describeForwardedByIdentifiers returns a copy of the normalized identifiers.
+func (c *config) describeForwardedByIdentifiers() []string {
+	if c.forwardedBy == nil || len(c.forwardedBy.identifiers) == 0 {
+		return nil
+	}
+	return slices.Clone(c.forwardedBy.identifiers)
+}
+
+// checkForwardedBy validates the by= parameters of the trusted chain suffix.
+// values are the raw header lines that produced parts.
+func (e chainExtractor) checkForwardedBy(req requestView, source Source, values, parts []string) *extractionFailure {
+	byValues, err := parseForwardedByValues(values, len(parts), e.policy.forwardedBy.lenient)
+	if err != nil || len(byValues) != len(parts) {
+		// The for= pass already accepted these values, so only an ambiguous
+		// duplicate by= can fail here.
+		return e.forwardedByFailure(source, parts, len(parts)-1, "", "")
+	}
+
+	last := len(parts) - 1
+	local := localAddrIP(req.context())
+	if !e.policy.forwardedBy.acceptsNearest(byValues[last], local) {
+		expected := ""
+		if local.IsValid() {
+			expected = local.String()
+		}
+		return e.forwardedByFailure(source, parts, last, byValues[last], expected)
+	}
+
+	parseClientIP := e.policy.parseClientIP
+	if parseClientIP == nil {
+		parseClientIP = parseIP
+	}
+	for i := last; i > 0; i-- {
+		ip := parseClientIP(parts[i])
+		trusted := e.policy.trustedProxy.trusts(ip)
+		if !trusted && !skipOpaqueHop(e.policy.trustedProxy, parts[i], ip) {
+			break
+		}
+		if !forwardedNodesMatch(byValues[i-1], parts[i]) {
+			return e.forwardedByFailure(source, parts, i-1, byValues[i-1], parts[i])
+		}
+	}
+	return nil
+}
+
+func (e chainExtractor) forwardedByFailure(source Source, parts []string, index int, by, expected string) *extractionFailure {
+	return &extractionFailure{
+		kind:        failureForwardedBy,
+		source:      source,
+		chain:       strings.Join(parts, ", "),
+		index:       index,
+		extractedIP: by,
+		expectedBy:  expected,
+	}
+}
+
+// acceptsNearest reports whether by names the local listener or a configured
+// identifier.
+func (p *forwardedByPolicy) acceptsNearest(by string, local netip.Addr) bool {
+	key, ok := forwardedNodeKey(by)
+	if !ok {
+		return false
+	}
+	if local.IsValid() && key == local.String() {
+		return true
+	}
+	_, found := slices.BinarySearch(p.identifiers, key)
+	return found
+}
+
+// localAddrIP returns the listener address net/http stored in ctx, if any.
+func localAddrIP(ctx context.Context) netip.Addr {
+	addr, ok := ctx.Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok || addr == nil {
+		return netip.Addr{}
+	}
+	return normalizeIP(parseRemoteAddr(addr.String())).WithZone("")
+}
+
+// forwardedNodesMatch reports whether two Forwarded node values name the same
+// node, ignoring ports.
+func forwardedNodesMatch(a, b string) bool {
+	aKey, ok := forwardedNodeKey(a)
+	if !ok {
+		return false
+	}
+	bKey, ok := forwardedNodeKey(b)
+	return ok && aKey == bKey
+}
+
+// forwardedNodeKey returns the comparable form of a Forwarded node: the
+// normalized IP, or the obfuscated identifier without its port. "unknown" and
+// unparsable values have no key.
+func forwardedNodeKey(node string) (string, bool) {
+	node = trimMatchedChar(strings.TrimSpace(node), '"')
+	if ip := parseIP(node); ip.IsValid() {
+		return normalizeIP(ip).WithZone("").String(), true
+	}
+	if !isOpaqueNode(node) {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(node, ":")
+	if strings.EqualFold(name, "unknown") {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,135 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestExtract_ForwardedByValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		identifiers []string
+		localAddr   string
+		forwarded   string
+		wantIP      string
+		wantIndex   int
+		wantBy      string
+		wantExpect  string
+	}{
+		{name: "nearest by names local listener", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8;by=10.0.0.10", wantIP: "8.8.8.8"},
+		{name: "local listener port ignored", localAddr: "[2001:db8::10]:8080", forwarded: `for=8.8.8.8;by="[2001:db8::10]:443"`, wantIP: "8.8.8.8"},
+		{name: "configured obfuscated identifier", identifiers: []string{"_edge"}, forwarded: `for=8.8.8.8;by="_edge:_port"`, wantIP: "8.8.8.8"},
+		{name: "trusted hops chain", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8;by=10.0.0.3, for=10.0.0.3;by=10.0.0.2, for=10.0.0.2;by=10.0.0.10", wantIP: "8.8.8.8"},
+		{name: "untrusted prefix is not checked", localAddr: "10.0.0.10:8080", forwarded: "for=1.1.1.1;by=9.9.9.9, for=8.8.8.8;by=10.0.0.2, for=10.0.0.2;by=10.0.0.10", wantIP: "8.8.8.8"},
+		{name: "missing nearest by", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8", wantIndex: 0, wantExpect: "10.0.0.10"},
+		{name: "nearest by names another host", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8;by=10.0.0.99", wantIndex: 0, wantBy: "10.0.0.99", wantExpect: "10.0.0.10"},
+		{name: "no local address or identifiers", forwarded: "for=8.8.8.8;by=10.0.0.10", wantIndex: 0, wantBy: "10.0.0.10"},
+		{name: "unknown never matches", identifiers: []string{"_edge"}, forwarded: "for=8.8.8.8;by=unknown", wantIndex: 0, wantBy: "unknown"},
+		{name: "broken chain", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8;by=10.0.0.7, for=10.0.0.2;by=10.0.0.10", wantIndex: 0, wantBy: "10.0.0.7", wantExpect: "10.0.0.2"},
+		{name: "duplicate by", localAddr: "10.0.0.10:8080", forwarded: "for=8.8.8.8;by=10.0.0.10;by=10.0.0.10", wantIndex: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{SourceForwarded}
+			WithForwardedByValidation(tt.identifiers...).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "/")
+			req.Header.Set("Forwarded", tt.forwarded)
+			if tt.localAddr != "" {
+				local := net.TCPAddrFromAddrPort(netip.MustParseAddrPort(tt.localAddr))
+				req = req.WithContext(context.WithValue(context.Background(), http.LocalAddrContextKey, local))
+			}
+
+			result, err := extractor.Extract(req)
+			if tt.wantIP != "" {
+				if err != nil {
+					t.Fatalf("Extract() error = %v", err)
+				}
+				if result.IP != netip.MustParseAddr(tt.wantIP) {
+					t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+				}
+				if entries := logger.snapshot(); len(entries) != 0 {
+					t.Fatalf("logged %d events, want none", len(entries))
+				}
+				return
+			}
+
+			var byErr *ForwardedByError
+			if !errors.As(err, &byErr) || !errors.Is(err, ErrForwardedByMismatch) {
+				t.Fatalf("error = %v, want ForwardedByError", err)
+			}
+			if byErr.Index != tt.wantIndex || byErr.By != tt.wantBy || byErr.Expected != tt.wantExpect {
+				t.Fatalf("ForwardedByError = %+v, want index=%d by=%q expected=%q", byErr, tt.wantIndex, tt.wantBy, tt.wantExpect)
+			}
+			if ClassifyError(err) != ResultUntrusted {
+				t.Fatalf("ClassifyError() = %v, want %v", ClassifyError(err), ResultUntrusted)
+			}
+
+			entries := logger.snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d events, want 1", len(entries))
+			}
+			assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventForwardedByMismatch, SourceForwarded, "/", "10.0.0.1:443")
+			assertAttr(t, entries[0].attrs, "index", tt.wantIndex)
+			assertAttr(t, entries[0].attrs, "by", tt.wantBy)
+			assertAttr(t, entries[0].attrs, "expected", tt.wantExpect)
+		})
+	}
+}
+
+func TestForwardedNodeKey(t *testing.T) {
+	tests := []struct {
+		node   string
+		want   string
+		wantOK bool
+	}{
+		{node: "10.0.0.1", want: "10.0.0.1", wantOK: true},
+		{node: `"10.0.0.1:80"`, want: "10.0.0.1", wantOK: true},
+		{node: "[::ffff:10.0.0.1]:80", want: "10.0.0.1", wantOK: true},
+		{node: "_edge:_port", want: "_edge", wantOK: true},
+		{node: "unknown", wantOK: false},
+		{node: "edge", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			got, ok := forwardedNodeKey(tt.node)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("forwardedNodeKey(%q) = %q, %v, want %q, %v", tt.node, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNew_ForwardedByValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceXForwardedFor), WithForwardedByValidation()); err == nil {
+		t.Fatal("New() error = nil, want rejection without SourceForwarded")
+	}
+	if _, err := New(trusted, WithSources(SourceForwarded), WithForwardedByValidation("edge")); err == nil {
+		t.Fatal("New() error = nil, want rejection of invalid identifier")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceForwarded), WithForwardedByValidation("_lb", "10.0.0.9:443"), WithForwardedByValidation("_lb"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if !description.ForwardedByValidation {
+		t.Fatal("Describe().ForwardedByValidation = false, want true")
+	}
+	if got, want := description.ForwardedByIdentifiers, []string{"10.0.0.9", "_lb"}; len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("Describe().ForwardedByIdentifiers = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package clientip
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// OpaqueNodePolicy controls how chain sources treat hops that do not identify
+// an address: the RFC 7239 "unknown" node, obfuscated identifiers such as
+// "_hidden", and "unknown" entries some proxies write into X-Forwarded-For.
+type OpaqueNodePolicy uint8
+
+const (
+	// OpaqueNodeInvalid treats an opaque node like any other unparsable hop:
+	// it is untrusted, and when selected as the client it fails with
+	// ErrInvalidIP. This is the default.
+	OpaqueNodeInvalid OpaqueNodePolicy = iota
+	// OpaqueNodeSkip treats opaque nodes as transparent hops and keeps
+	// walking the chain past them. They are never selected as the client and
+	// do not count toward trusted-proxy limits. Use it only when every proxy
+	// that may write an opaque node is itself trusted, because the hop before
+	// an opaque node is attributed as if the opaque proxy had been trusted.
+	OpaqueNodeSkip
+	// OpaqueNodeTerminal stops resolution at an opaque node selected as the
+	// client with an InvalidIPError wrapping ErrOpaqueNode, classified as
+	// ResultInvalid. Later sources do not run unless ResultInvalid is made
+	// skippable with WithSourceFailurePolicy.
+	OpaqueNodeTerminal
+	// OpaqueNodeAnonymous accepts an opaque node selected as the client as an
+	// anonymous client. Resolution succeeds without an IP: Err is nil,
+	// Result.AnonymousNode holds the node, and Result.Classify reports
+	// ResultAnonymous. ResolveOperational applies its fallback with
+	// FallbackReasonAnonymousClient, and WithReportOnly resolvers substitute
+	// the connecting peer, so callers that only check Err still get an IP.
+	OpaqueNodeAnonymous
+)
+
+// String returns the stable label for p.
+func (p OpaqueNodePolicy) String() string {
+	switch p {
+	case OpaqueNodeInvalid:
+		return "invalid"
+	case OpaqueNodeSkip:
+		return "skip"
+	case OpaqueNodeTerminal:
+		return "terminal"
+	case OpaqueNodeAnonymous:
+		return "anonymous"
+	default:
+		return "unknown"
+	}
+}
+
+func (p OpaqueNodePolicy) valid() bool {
+	return p <= OpaqueNodeAnonymous
+}
+
+// WithOpaqueNodePolicy sets how Forwarded, X-Forwarded-For, and
+// ChainHeaderSource chains treat "unknown" and obfuscated nodes.
+//
+// Opaque nodes are reported in ChainDebugInfo.OpaqueIndices when
+// WithDebugInfo is enabled. XForwardedForStrict rejects opaque nodes in
+// X-Forwarded-For and ChainHeaderSource headers as malformed before the
+// policy applies, so with strict parsing it affects only Forwarded.
+func WithOpaqueNodePolicy(policy OpaqueNodePolicy) Option {
+	return optionFunc(func(c *options) { c.OpaqueNodes = policy })
+}
+
+// isOpaqueNode reports whether a chain entry is an RFC 7239 "unknown" or
+// obfuscated node, with or without a port. Callers check it only after the
+// entry failed to parse as an IP.
+func isOpaqueNode(part string) bool {
+	part = trimMatchedChar(strings.TrimSpace(part), '"')
+	name := part
+	if i := strings.IndexByte(part, ':'); i >= 0 {
+		name = part[:i]
+	}
+
+	if strings.EqualFold(name, "unknown") {
+		return true
+	}
+	if len(name) < 2 || name[0] != '_' {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		ch := name[i]
+		if !('a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '.' || ch == '_' || ch == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// skipOpaqueHop reports whether a hop is an opaque node that policy walks
+// past.
+func skipOpaqueHop(policy proxyPolicy, part string, ip netip.Addr) bool {
+	return policy.OpaqueNodes == OpaqueNodeSkip && !ip.IsValid() && isOpaqueNode(part)
+}
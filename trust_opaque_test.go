@@ -0,0 +1,231 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+func TestIsOpaqueNode(t *testing.T) {
+	tests := []struct {
+		part string
+		want bool
+	}{
+		{part: "unknown", want: true},
+		{part: "UNKNOWN", want: true},
+		{part: "unknown:8080", want: true},
+		{part: `"unknown"`, want: true},
+		{part: "_hidden", want: true},
+		{part: "_hidden:_port", want: true},
+		{part: "_a.b-c_d", want: true},
+		{part: "_", want: false},
+		{part: "_bad/char", want: false},
+		{part: "hidden", want: false},
+		{part: "garbage", want: false},
+		{part: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.part, func(t *testing.T) {
+			if got := isOpaqueNode(tt.part); got != tt.want {
+				t.Fatalf("isOpaqueNode(%q) = %v, want %v", tt.part, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract_OpaqueNodePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     OpaqueNodePolicy
+		selection  ChainSelection
+		source     Source
+		header     string
+		value      string
+		wantIP     string
+		wantSource Source
+		wantNode   string
+		wantErr    error
+	}{
+		{name: "invalid by default", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown, 10.0.0.2", wantSource: SourceXForwardedFor, wantErr: ErrInvalidIP},
+		{name: "skip xff", policy: OpaqueNodeSkip, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown, 10.0.0.2", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "skip forwarded obfuscated", policy: OpaqueNodeSkip, source: SourceForwarded, header: "Forwarded", value: `for=8.8.8.8, for="_hidden:_port", for=10.0.0.2`, wantIP: "8.8.8.8", wantSource: SourceForwarded},
+		{name: "skip leftmost", policy: OpaqueNodeSkip, selection: LeftmostUntrustedIP, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "unknown, 8.8.8.8, 10.0.0.2", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "skip does not pass real untrusted hop", policy: OpaqueNodeSkip, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "unknown, 8.8.8.8, 10.0.0.2", wantIP: "8.8.8.8", wantSource: SourceXForwardedFor},
+		{name: "terminal stops resolution", policy: OpaqueNodeTerminal, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8, unknown", wantSource: SourceXForwardedFor, wantErr: ErrOpaqueNode},
+		{name: "terminal forwarded obfuscated", policy: OpaqueNodeTerminal, source: SourceForwarded, header: "Forwarded", value: "for=_hidden, for=10.0.0.2", wantSource: SourceForwarded, wantErr: ErrOpaqueNode},
+		{name: "anonymous", policy: OpaqueNodeAnonymous, source: SourceForwarded, header: "Forwarded", value: "for=unknown, for=10.0.0.2", wantSource: SourceForwarded, wantNode: "unknown"},
+		{name: "anonymous leftmost", policy: OpaqueNodeAnonymous, selection: LeftmostUntrustedIP, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "_hidden, 8.8.8.8, 10.0.0.2", wantSource: SourceXForwardedFor, wantNode: "_hidden"},
+		{name: "non-opaque garbage stays invalid", policy: OpaqueNodeAnonymous, source: SourceXForwardedFor, header: "X-Forwarded-For", value: "garbage", wantSource: SourceXForwardedFor, wantErr: ErrInvalidIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultOptions()
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.AllowPrivateIPs = true
+			cfg.Sources = []Source{tt.source, SourceRemoteAddr}
+			if tt.selection != 0 {
+				cfg.ChainSelection = tt.selection
+			}
+			WithOpaqueNodePolicy(tt.policy).applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest("10.0.0.1:443", "")
+			req.Header.Set(tt.header, tt.value)
+
+			result, err := extractor.Extract(req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != ErrOpaqueNode && errors.Is(err, ErrOpaqueNode) {
+				t.Fatalf("error = %v, want no ErrOpaqueNode outside OpaqueNodeTerminal", err)
+			}
+			if tt.wantIP != "" && result.IP != netip.MustParseAddr(tt.wantIP) {
+				t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+			}
+			if result.Source != tt.wantSource {
+				t.Fatalf("Source = %v, want %v", result.Source, tt.wantSource)
+			}
+			if result.AnonymousNode != tt.wantNode {
+				t.Fatalf("AnonymousNode = %q, want %q", result.AnonymousNode, tt.wantNode)
+			}
+			if tt.wantNode != "" && (result.IP.IsValid() || result.TrustedProxyCount != 1) {
+				t.Fatalf("result = %+v, want anonymous client with no IP behind 1 trusted proxy", result)
+			}
+		})
+	}
+}
+
+func TestResolve_OpaqueNodeAnonymous(t *testing.T) {
+	resolver, err := New(
+		WithSources(SourceForwarded),
+		WithTrustedProxies(mustParseCIDRs(t, "10.0.0.0/8")...),
+		WithOpaqueNodePolicy(OpaqueNodeAnonymous),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := newTestRequest("10.0.0.1:443", "")
+	req.Header.Set("Forwarded", "for=unknown")
+
+	result := resolver.Resolve(req)
+	if result.Err != nil || result.OK() || result.AnonymousNode != "unknown" {
+		t.Fatalf("Resolve() = %+v, want anonymous client without error", result)
+	}
+	if got := result.Classify(); got != ResultAnonymous {
+		t.Fatalf("Classify() = %v, want %v", got, ResultAnonymous)
+	}
+
+	operational := resolver.ResolveOperational(req, RemoteAddrFallback())
+	if operational.Err != nil || !operational.FallbackUsed || operational.FallbackReason != FallbackReasonAnonymousClient {
+		t.Fatalf("ResolveOperational() = %+v, want anonymous client fallback", operational)
+	}
+	if operational.IP != netip.MustParseAddr("10.0.0.1") || operational.Source != SourceRemoteAddr || operational.AnonymousNode != "unknown" {
+		t.Fatalf("ResolveOperational() = %+v, want peer from remote_addr with AnonymousNode kept", operational)
+	}
+	if got := operational.Classify(); got != ResultFallback {
+		t.Fatalf("operational Classify() = %v, want %v", got, ResultFallback)
+	}
+
+	input := resolver.ResolveInputOperational(Input{RemoteAddr: "10.0.0.1:443", Headers: req.Header}, StaticFallback(netip.MustParseAddr("192.0.2.1")))
+	if !input.FallbackUsed || input.IP != netip.MustParseAddr("192.0.2.1") || input.AnonymousNode != "unknown" {
+		t.Fatalf("ResolveInputOperational() = %+v, want static fallback with AnonymousNode kept", input)
+	}
+}
+
+func TestResolve_OpaqueNodeAnonymousReportOnly(t *testing.T) {
+	resolver, err := New(
+		WithSources(SourceForwarded),
+		WithTrustedProxies(mustParseCIDRs(t, "10.0.0.0/8")...),
+		WithOpaqueNodePolicy(OpaqueNodeAnonymous),
+		WithReportOnly(),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := newTestRequest("10.0.0.1:443", "")
+	req.Header.Set("Forwarded", "for=unknown")
+
+	result := resolver.Resolve(req)
+	if result.Err != nil || result.IP != netip.MustParseAddr("10.0.0.1") || result.Source != SourceRemoteAddr {
+		t.Fatalf("Resolve() = %+v, want connecting peer from remote_addr", result)
+	}
+	if result.AnonymousNode != "unknown" || result.Classify() != ResultAnonymous {
+		t.Fatalf("Resolve() = %+v, Classify() = %v, want anonymous node kept", result, result.Classify())
+	}
+
+	operational := resolver.ResolveOperational(req, StaticFallback(netip.MustParseAddr("192.0.2.1")))
+	if operational.FallbackUsed || operational.IP != netip.MustParseAddr("10.0.0.1") {
+		t.Fatalf("ResolveOperational() = %+v, want report-only peer without fallback", operational)
+	}
+}
+
+func TestResolve_OpaqueNodeTerminalSkippable(t *testing.T) {
+	resolver, err := New(
+		WithSources(SourceXForwardedFor, SourceRemoteAddr),
+		WithTrustedProxies(mustParseCIDRs(t, "10.0.0.0/8")...),
+		WithAllowPrivateIPs(),
+		WithOpaqueNodePolicy(OpaqueNodeTerminal),
+		WithSourceFailurePolicy(SourceXForwardedFor, ResultInvalid),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	req := newTestRequest("10.0.0.1:443", "")
+	req.Header.Set("X-Forwarded-For", "8.8.8.8, unknown")
+
+	result := resolver.Resolve(req)
+	if result.Err != nil || result.Source != SourceRemoteAddr {
+		t.Fatalf("Resolve() = %+v, want fall-through to remote_addr", result)
+	}
+	if !errors.Is(result.SkippedErr, ErrOpaqueNode) {
+		t.Fatalf("SkippedErr = %v, want ErrOpaqueNode", result.SkippedErr)
+	}
+}
+
+func TestExtract_OpaqueNodeDebugInfo(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{SourceXForwardedFor}
+	cfg.DebugInfo = true
+	WithOpaqueNodePolicy(OpaqueNodeSkip).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	req := newTestRequest("10.0.0.1:443", "")
+	req.Header.Set("X-Forwarded-For", "8.8.8.8, _edge, 10.0.0.3, unknown")
+
+	result, err := extractor.Extract(req)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.IP != netip.MustParseAddr("8.8.8.8") || result.TrustedProxyCount != 1 {
+		t.Fatalf("result = %+v, want 8.8.8.8 with one trusted proxy", result)
+	}
+	if got, want := result.DebugInfo.OpaqueIndices, []int{1, 3}; !slices.Equal(got, want) {
+		t.Fatalf("OpaqueIndices = %v, want %v", got, want)
+	}
+	if got, want := result.DebugInfo.ClientIndex, 0; got != want {
+		t.Fatalf("ClientIndex = %d, want %d", got, want)
+	}
+}
+
+func TestNew_OpaqueNodePolicyValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	if _, err := New(trusted, WithSources(SourceForwarded), WithOpaqueNodePolicy(OpaqueNodePolicy(9))); err == nil {
+		t.Fatal("New() error = nil, want rejection of invalid opaque node policy")
+	}
+
+	resolver, err := New(trusted, WithSources(SourceForwarded), WithOpaqueNodePolicy(OpaqueNodeTerminal))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got := resolver.Describe().OpaqueNodes; got != OpaqueNodeTerminal {
+		t.Fatalf("Describe().OpaqueNodes = %v, want %v", got, OpaqueNodeTerminal)
+	}
+}
@@ -0,0 +1,146 @@
+package clientip
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// Origin secret failure reasons reported in OriginSecretError.Reason and the
+// origin_secret_mismatch security event.
+const (
+	OriginSecretMissing  = "missing"
+	OriginSecretMultiple = "multiple"
+	OriginSecretMismatch = "mismatch"
+)
+
+// WithOriginSecret requires header to carry one of secrets before any header
+// source is trusted.
+//
+// CDNs such as Azure Front Door (X-Azure-FDID), CloudFront, and Cloudflare can
+// inject a secret header on origin requests. Requiring it proves traffic came
+// through your own edge configuration, which CIDR trust alone cannot do when
+// the CDN ranges are shared by other tenants. The check runs after the
+// trusted-peer check, for every source that requires a trusted peer, and
+// applies even when no trusted proxies are configured. Exactly one header
+// line must match one secret; comparison is constant time.
+//
+// Pass the current and the previous secret during rotation. Failures emit the
+// origin_secret_mismatch security event, which never includes the header
+// value, and fail with an OriginSecretError wrapping ErrUntrustedProxy.
+// UntrustedPeerIgnore does not skip them: a trusted peer without the secret
+// fails resolution unless ResultUntrusted is made skippable with
+// WithSourceFailurePolicy. Calling it again replaces the header and secrets.
+func WithOriginSecret(header string, secrets ...string) Option {
+	secrets = append([]string(nil), secrets...)
+	return optionFunc(func(c *options) {
+		c.OriginSecretHeader = header
+		c.OriginSecrets = secrets
+	})
+}
+
+// originSecret is the normalized WithOriginSecret setting. Only digests are
+// kept so the comparison time does not depend on secret lengths.
+type originSecret struct {
+	header  string
+	digests [][sha256.Size]byte
+}
+
+func newOriginSecret(header string, secrets []string) (*originSecret, error) {
+	header = strings.TrimSpace(header)
+	if header == "" && len(secrets) == 0 {
+		return nil, nil
+	}
+	if header == "" {
+		return nil, errors.New("origin secret header must not be empty")
+	}
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("origin secret header %q requires at least one secret", header)
+	}
+
+	policy := &originSecret{
+		header:  textproto.CanonicalMIMEHeaderKey(header),
+		digests: make([][sha256.Size]byte, 0, len(secrets)),
+	}
+	for i, secret := range secrets {
+		if secret == "" {
+			return nil, fmt.Errorf("origin secret %d must not be empty", i)
+		}
+		policy.digests = append(policy.digests, sha256.Sum256([]byte(secret)))
+	}
+	return policy, nil
+}
+
+func (c *config) validateOriginSecret() error {
+	if c.originSecret == nil {
+		return nil
+	}
+
+	hasPeerChecked := false
+	for _, source := range c.sourcePriority {
+		if key, ok := source.headerKey(); ok && textproto.CanonicalMIMEHeaderKey(key) == c.originSecret.header {
+			return fmt.Errorf("origin secret header %q is also a configured source", c.originSecret.header)
+		}
+		hasPeerChecked = hasPeerChecked || source.peerChecked()
+	}
+	if !hasPeerChecked {
+		return errors.New("origin secret requires at least one header source")
+	}
+	return nil
+}
+
+// check returns nil when the request carries a configured secret, or an
+// origin secret failure.
+func (p *originSecret) check(req requestView, source Source) *extractionFailure {
+	if p == nil {
+		return nil
+	}
+
+	values := req.valuesCanonical(p.header)
+	reason := ""
+	switch {
+	case len(values) == 0:
+		reason = OriginSecretMissing
+	case len(values) > 1:
+		reason = OriginSecretMultiple
+	case !p.matches(values[0]):
+		reason = OriginSecretMismatch
+	default:
+		return nil
+	}
+
+	return &extractionFailure{
+		kind:         failureOriginSecret,
+		source:       source,
+		headerName:   p.header,
+		headerCount:  len(values),
+		originReason: reason,
+	}
+}
+
+// matches compares value against every secret without short-circuiting.
+func (p *originSecret) matches(value string) bool {
+	digest := sha256.Sum256([]byte(value))
+	match := 0
+	for i := range p.digests {
+		match |= subtle.ConstantTimeCompare(digest[:], p.digests[i][:])
+	}
+	return match == 1
+}
+
+func (p *originSecret) describeHeader() string {
+	if p == nil {
+		return ""
+	}
+	return p.header
+}
+
+func (p *originSecret) count() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.digests)
+}
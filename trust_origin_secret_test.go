@@ -0,0 +1,180 @@
+package clientip
+
+import (
+	"errors"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestOriginSecretMatches(t *testing.T) {
+	policy, err := newOriginSecret("x-azure-fdid", []string{"current-secret", "previous"})
+	if err != nil {
+		t.Fatalf("newOriginSecret() error = %v", err)
+	}
+	if policy.header != "X-Azure-Fdid" {
+		t.Fatalf("header = %q, want %q", policy.header, "X-Azure-Fdid")
+	}
+
+	for value, want := range map[string]bool{
+		"current-secret":  true,
+		"previous":        true,
+		"current-secre":   false,
+		"current-secret ": false,
+		"":                false,
+	} {
+		if got := policy.matches(value); got != want {
+			t.Fatalf("matches(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	if policy, err := newOriginSecret("", nil); policy != nil || err != nil {
+		t.Fatalf("newOriginSecret(empty) = %v, %v, want disabled", policy, err)
+	}
+}
+
+func TestExtract_OriginSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     Source
+		header     string
+		value      string
+		secrets    []string
+		remoteAddr string
+		wantIP     string
+		wantReason string
+	}{
+		{name: "chain with current secret", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8", secrets: []string{"s3cret"}, remoteAddr: "10.0.0.1:443", wantIP: "8.8.8.8"},
+		{name: "chain with previous secret", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8", secrets: []string{"old"}, remoteAddr: "10.0.0.1:443", wantIP: "8.8.8.8"},
+		{name: "chain without secret", source: SourceXForwardedFor, header: "X-Forwarded-For", value: "8.8.8.8", remoteAddr: "10.0.0.1:443", wantReason: OriginSecretMissing},
+		{name: "chain with wrong secret", source: SourceForwarded, header: "Forwarded", value: "for=8.8.8.8", secrets: []string{"guess"}, remoteAddr: "10.0.0.1:443", wantReason: OriginSecretMismatch},
+		{name: "single header with two secrets", source: SourceXRealIP, header: "X-Real-IP", value: "8.8.8.8", secrets: []string{"s3cret", "s3cret"}, remoteAddr: "10.0.0.1:443", wantReason: OriginSecretMultiple},
+		{name: "single header with secret", source: SourceXRealIP, header: "X-Real-IP", value: "8.8.8.8", secrets: []string{"s3cret"}, remoteAddr: "10.0.0.1:443", wantIP: "8.8.8.8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := &capturedLogger{}
+			cfg := defaultOptions()
+			cfg.Logger = logger
+			cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+			cfg.Sources = []Source{tt.source}
+			WithOriginSecret("X-Azure-FDID", "s3cret", "old").applyOption(&cfg)
+			extractor := mustNewExtractor(t, cfg)
+
+			req := newTestRequest(tt.remoteAddr, "/")
+			req.Header.Set(tt.header, tt.value)
+			for _, secret := range tt.secrets {
+				req.Header.Add("X-Azure-FDID", secret)
+			}
+
+			result, err := extractor.Extract(req)
+			if tt.wantIP != "" {
+				if err != nil {
+					t.Fatalf("Extract() error = %v", err)
+				}
+				if result.IP != netip.MustParseAddr(tt.wantIP) {
+					t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrUntrustedProxy) || ClassifyError(err) != ResultUntrusted {
+				t.Fatalf("Extract() error = %v, want %v", err, ErrUntrustedProxy)
+			}
+			var secretErr *OriginSecretError
+			if !errors.As(err, &secretErr) {
+				t.Fatalf("error = %T, want *OriginSecretError", err)
+			}
+			if secretErr.HeaderName != "X-Azure-Fdid" || secretErr.Reason != tt.wantReason {
+				t.Fatalf("OriginSecretError = %+v, want reason %q", secretErr, tt.wantReason)
+			}
+
+			entries := logger.snapshot()
+			if len(entries) != 1 {
+				t.Fatalf("logged %d events, want 1", len(entries))
+			}
+			assertCommonSecurityWarningAttrs(t, entries[0].attrs, SecurityEventOriginSecretMismatch, tt.source, "/", tt.remoteAddr)
+			assertAttr(t, entries[0].attrs, "reason", tt.wantReason)
+			for _, attr := range entries[0].attrs {
+				if s, ok := attr.(string); ok && strings.Contains(s, "guess") {
+					t.Fatalf("log attrs contain the header value: %v", entries[0].attrs)
+				}
+			}
+		})
+	}
+}
+
+func TestExtract_OriginSecretScope(t *testing.T) {
+	cfg := defaultOptions()
+	cfg.TrustedProxyPrefixes = mustParseCIDRs(t, "10.0.0.0/8")
+	cfg.Sources = []Source{SourceXForwardedFor, SourceRemoteAddr}
+	cfg.UntrustedPeerPolicies = map[Source]UntrustedPeerPolicy{SourceXForwardedFor: UntrustedPeerIgnore}
+	WithOriginSecret("X-Origin-Auth", "s3cret").applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	// The untrusted peer is rejected before the secret is consulted.
+	req := newTestRequest("1.1.1.1:443", "/")
+	req.Header.Set("X-Forwarded-For", "8.8.8.8")
+	req.Header.Set("X-Origin-Auth", "s3cret")
+	result, err := extractor.Extract(req)
+	if err != nil || result.IP != netip.MustParseAddr("1.1.1.1") {
+		t.Fatalf("Extract() = %v, %v, want remote address", result.IP, err)
+	}
+
+	// A trusted peer without the secret is not an untrusted peer, so
+	// UntrustedPeerIgnore does not hide the failure.
+	cfg.AllowPrivateIPs = true
+	extractor = mustNewExtractor(t, cfg)
+	for _, secret := range []string{"", "guess"} {
+		req = newTestRequest("10.0.0.1:443", "/")
+		req.Header.Set("X-Forwarded-For", "8.8.8.8")
+		if secret != "" {
+			req.Header.Set("X-Origin-Auth", secret)
+		}
+		result, err = extractor.Extract(req)
+		var secretErr *OriginSecretError
+		if !errors.As(err, &secretErr) || result.SpoofAttemptIgnored {
+			t.Fatalf("Extract() with secret %q = %+v, %v, want *OriginSecretError", secret, result, err)
+		}
+	}
+}
+
+func TestNew_OriginSecretValidation(t *testing.T) {
+	trusted := WithTrustedProxies(LoopbackProxyPrefixes()...)
+
+	invalid := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "no secrets", opts: []Option{WithSources(SourceXForwardedFor), WithOriginSecret("X-Origin-Auth")}},
+		{name: "no header", opts: []Option{WithSources(SourceXForwardedFor), WithOriginSecret(" ", "s3cret")}},
+		{name: "empty secret", opts: []Option{WithSources(SourceXForwardedFor), WithOriginSecret("X-Origin-Auth", "s3cret", "")}},
+		{name: "header is a source", opts: []Option{WithSources(SourceXRealIP), WithOriginSecret("x-real-ip", "s3cret")}},
+		{name: "no header source", opts: []Option{WithSources(SourceRemoteAddr), WithOriginSecret("X-Origin-Auth", "s3cret")}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(append([]Option{trusted}, tt.opts...)...); err == nil {
+				t.Fatal("New() error = nil, want rejection")
+			}
+		})
+	}
+
+	resolver, err := New(trusted, WithSources(SourceXForwardedFor), WithOriginSecret("x-origin-auth", "current", "previous"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if description.OriginSecretHeader != "X-Origin-Auth" || description.OriginSecretCount != 2 {
+		t.Fatalf("Describe() origin secret = %q, %d", description.OriginSecretHeader, description.OriginSecretCount)
+	}
+
+	rotated, err := New(trusted, WithSources(SourceXForwardedFor), WithOriginSecret("X-Origin-Auth", "next", "current"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rotated.Describe().Fingerprint() != description.Fingerprint() {
+		t.Fatal("Fingerprint() changed after rotating secret values")
+	}
+}
@@ -0,0 +1,207 @@
+package clientip
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// PeerIdentity matches the verified client certificate of the immediate peer.
+// Every set field must match; the zero value is invalid.
+type PeerIdentity struct {
+	// URI is an exact URI SAN, typically a SPIFFE ID such as
+	// spiffe://mesh.example/ns/ingress/sa/envoy.
+	URI string
+	// DNSName is a DNS SAN, compared case-insensitively.
+	DNSName string
+	// Subject reports whether the certificate subject is acceptable.
+	Subject func(pkix.Name) bool
+}
+
+// PeerTrustMode selects how WithTrustedPeerIdentities combines with
+// WithTrustedProxies for the immediate peer.
+type PeerTrustMode uint8
+
+const (
+	// PeerTrustAny trusts a peer whose address is a trusted proxy or whose
+	// certificate matches a trusted identity. Configure identities without
+	// trusted proxies to trust by identity alone. This is the default.
+	PeerTrustAny PeerTrustMode = iota
+	// PeerTrustAll requires both a trusted proxy address and a matching
+	// certificate.
+	PeerTrustAll
+)
+
+// String returns the stable label for m.
+func (m PeerTrustMode) String() string {
+	switch m {
+	case PeerTrustAny:
+		return "any"
+	case PeerTrustAll:
+		return "all"
+	default:
+		return "unknown"
+	}
+}
+
+func (m PeerTrustMode) valid() bool {
+	return m <= PeerTrustAll
+}
+
+// WithTrustedPeerIdentities trusts immediate peers that present a matching
+// client certificate.
+//
+// Inside a service mesh, the proxy talking to the application authenticates
+// with a certificate while its pod address changes constantly, so CIDR trust
+// is coarse. Identities are read from the verified chain in
+// http.Request.TLS, so the server must request and verify client
+// certificates; unverified certificates and Input resolution never match.
+// The identity check replaces or complements the trusted-proxy address check
+// for the immediate peer only, as selected by WithPeerTrustMode; chain hops
+// are still trusted by address. Calling it again adds identities.
+func WithTrustedPeerIdentities(identities ...PeerIdentity) Option {
+	identities = append([]PeerIdentity(nil), identities...)
+	return optionFunc(func(c *options) {
+		c.TrustedPeerIdentities = append(c.TrustedPeerIdentities, identities...)
+	})
+}
+
+// WithPeerTrustMode sets how trusted peer identities combine with trusted
+// proxy addresses. The default is PeerTrustAny.
+func WithPeerTrustMode(mode PeerTrustMode) Option {
+	return optionFunc(func(c *options) { c.PeerTrustMode = mode })
+}
+
+// peerIdentityPolicy is the normalized WithTrustedPeerIdentities setting.
+type peerIdentityPolicy struct {
+	identities []PeerIdentity
+	mode       PeerTrustMode
+}
+
+func newPeerIdentityPolicy(identities []PeerIdentity, mode PeerTrustMode) (*peerIdentityPolicy, error) {
+	if !mode.valid() {
+		return nil, fmt.Errorf("invalid peer trust mode %d", mode)
+	}
+	if len(identities) == 0 {
+		if mode != PeerTrustAny {
+			return nil, errors.New("peer trust mode requires trusted peer identities")
+		}
+		return nil, nil
+	}
+
+	policy := &peerIdentityPolicy{identities: make([]PeerIdentity, 0, len(identities)), mode: mode}
+	for i, identity := range identities {
+		identity.URI = strings.TrimSpace(identity.URI)
+		identity.DNSName = strings.TrimSpace(identity.DNSName)
+		if identity.URI == "" && identity.DNSName == "" && identity.Subject == nil {
+			return nil, fmt.Errorf("trusted peer identity %d must set a URI, DNS name, or subject matcher", i)
+		}
+		if identity.URI != "" {
+			if u, err := url.Parse(identity.URI); err != nil || u.Scheme == "" {
+				return nil, fmt.Errorf("invalid trusted peer identity URI %q", identity.URI)
+			}
+		}
+		policy.identities = append(policy.identities, identity)
+	}
+	return policy, nil
+}
+
+// trusts reports whether the peer is trusted given the result of the address
+// check. A nil policy defers to the address check.
+func (p *peerIdentityPolicy) trusts(req requestView, addressTrusted bool) bool {
+	if p == nil {
+		return addressTrusted
+	}
+	if p.mode == PeerTrustAll && !addressTrusted {
+		return false
+	}
+	if p.mode == PeerTrustAny && addressTrusted {
+		return true
+	}
+	return p.matches(req)
+}
+
+// matches reports whether the verified client certificate matches any
+// identity.
+func (p *peerIdentityPolicy) matches(req requestView) bool {
+	if req.request == nil || req.request.TLS == nil {
+		return false
+	}
+	chains := req.request.TLS.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return false
+	}
+
+	leaf := chains[0][0]
+	for _, identity := range p.identities {
+		if peerIdentityMatches(identity, leaf) {
+			return true
+		}
+	}
+	return false
+}
+
+func peerIdentityMatches(identity PeerIdentity, cert *x509.Certificate) bool {
+	if identity.URI != "" && !certHasURI(cert, identity.URI) {
+		return false
+	}
+	if identity.DNSName != "" && !certHasDNSName(cert, identity.DNSName) {
+		return false
+	}
+	if identity.Subject != nil && !identity.Subject(cert.Subject) {
+		return false
+	}
+	return true
+}
+
+func certHasURI(cert *x509.Certificate, want string) bool {
+	for _, uri := range cert.URIs {
+		if uri != nil && uri.String() == want {
+			return true
+		}
+	}
+	return false
+}
+
+func certHasDNSName(cert *x509.Certificate, want string) bool {
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(name, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// describe renders identities as stable labels such as
+// "uri=spiffe://mesh.example/sa/envoy dns=envoy.mesh subject=custom".
+func (p *peerIdentityPolicy) describe() []string {
+	if p == nil {
+		return nil
+	}
+
+	labels := make([]string, 0, len(p.identities))
+	for _, identity := range p.identities {
+		fields := make([]string, 0, 3)
+		if identity.URI != "" {
+			fields = append(fields, "uri="+identity.URI)
+		}
+		if identity.DNSName != "" {
+			fields = append(fields, "dns="+strings.ToLower(identity.DNSName))
+		}
+		if identity.Subject != nil {
+			fields = append(fields, "subject=custom")
+		}
+		labels = append(labels, strings.Join(fields, " "))
+	}
+	return labels
+}
+
+func (p *peerIdentityPolicy) describeMode() PeerTrustMode {
+	if p == nil {
+		return PeerTrustAny
+	}
+	return p.mode
+}
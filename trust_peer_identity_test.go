@@ -0,0 +1,167 @@
+package clientip
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testPeerCertificate(t *testing.T, uri, dnsName, commonName string) *x509.Certificate {
+	t.Helper()
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatalf("url.Parse(%q) error = %v", uri, err)
+		}
+		cert.URIs = []*url.URL{u}
+	}
+	if dnsName != "" {
+		cert.DNSNames = []string{dnsName}
+	}
+	return cert
+}
+
+func withVerifiedPeer(req *http.Request, cert *x509.Certificate) *http.Request {
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return req
+}
+
+func TestPeerIdentityMatches(t *testing.T) {
+	const envoyID = "spiffe://mesh.example/ns/ingress/sa/envoy"
+	cert := testPeerCertificate(t, envoyID, "Envoy.Mesh.Example", "envoy")
+
+	tests := []struct {
+		name     string
+		identity PeerIdentity
+		want     bool
+	}{
+		{name: "uri", identity: PeerIdentity{URI: envoyID}, want: true},
+		{name: "uri mismatch", identity: PeerIdentity{URI: "spiffe://mesh.example/ns/ingress/sa/other"}, want: false},
+		{name: "uri prefix is not a match", identity: PeerIdentity{URI: "spiffe://mesh.example/ns/ingress"}, want: false},
+		{name: "dns case-insensitive", identity: PeerIdentity{DNSName: "envoy.mesh.example"}, want: true},
+		{name: "subject", identity: PeerIdentity{Subject: func(name pkix.Name) bool { return name.CommonName == "envoy" }}, want: true},
+		{name: "all fields must match", identity: PeerIdentity{URI: envoyID, DNSName: "other.mesh.example"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := peerIdentityMatches(tt.identity, cert); got != tt.want {
+				t.Fatalf("peerIdentityMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract_PeerIdentityTrust(t *testing.T) {
+	const envoyID = "spiffe://mesh.example/ns/ingress/sa/envoy"
+
+	tests := []struct {
+		name       string
+		proxies    string
+		mode       PeerTrustMode
+		remoteAddr string
+		peerURI    string
+		unverified bool
+		wantIP     string
+	}{
+		{name: "identity alone", remoteAddr: "10.1.2.3:443", peerURI: envoyID, wantIP: "8.8.8.8"},
+		{name: "identity alone wrong peer", remoteAddr: "10.1.2.3:443", peerURI: "spiffe://mesh.example/ns/default/sa/app"},
+		{name: "identity alone without certificate", remoteAddr: "10.1.2.3:443"},
+		{name: "identity alone unverified certificate", remoteAddr: "10.1.2.3:443", peerURI: envoyID, unverified: true},
+		{name: "any by address", proxies: "10.0.0.0/8", remoteAddr: "10.1.2.3:443", wantIP: "8.8.8.8"},
+		{name: "any by identity", proxies: "10.0.0.0/8", remoteAddr: "172.16.0.9:443", peerURI: envoyID, wantIP: "8.8.8.8"},
+		{name: "all requires identity", proxies: "10.0.0.0/8", mode: PeerTrustAll, remoteAddr: "10.1.2.3:443"},
+		{name: "all requires address", proxies: "10.0.0.0/8", mode: PeerTrustAll, remoteAddr: "172.16.0.9:443", peerURI: envoyID},
+		{name: "all with both", proxies: "10.0.0.0/8", mode: PeerTrustAll, remoteAddr: "10.1.2.3:443", peerURI: envoyID, wantIP: "8.8.8.8"},
+	}
+
+	for _, source := range []Source{SourceXForwardedFor, SourceXRealIP} {
+		for _, tt := range tests {
+			t.Run(source.String()+"/"+tt.name, func(t *testing.T) {
+				cfg := defaultOptions()
+				if tt.proxies != "" {
+					cfg.TrustedProxyPrefixes = mustParseCIDRs(t, tt.proxies)
+				}
+				cfg.Sources = []Source{source}
+				WithTrustedPeerIdentities(PeerIdentity{URI: envoyID}).applyOption(&cfg)
+				WithPeerTrustMode(tt.mode).applyOption(&cfg)
+				extractor := mustNewExtractor(t, cfg)
+
+				req := newTestRequest(tt.remoteAddr, "/")
+				req.Header.Set("X-Forwarded-For", "8.8.8.8")
+				req.Header.Set("X-Real-IP", "8.8.8.8")
+				if tt.peerURI != "" {
+					req = withVerifiedPeer(req, testPeerCertificate(t, tt.peerURI, "", ""))
+					if tt.unverified {
+						req.TLS.VerifiedChains = nil
+					}
+				}
+
+				result, err := extractor.Extract(req)
+				if tt.wantIP == "" {
+					if !errors.Is(err, ErrUntrustedProxy) {
+						t.Fatalf("Extract() error = %v, want %v", err, ErrUntrustedProxy)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("Extract() error = %v", err)
+				}
+				if result.IP != netip.MustParseAddr(tt.wantIP) {
+					t.Fatalf("IP = %v, want %s", result.IP, tt.wantIP)
+				}
+			})
+		}
+	}
+}
+
+func TestNew_PeerIdentityValidation(t *testing.T) {
+	invalid := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "empty identity", opts: []Option{WithSources(SourceXForwardedFor), WithTrustedPeerIdentities(PeerIdentity{})}},
+		{name: "relative uri", opts: []Option{WithSources(SourceXForwardedFor), WithTrustedPeerIdentities(PeerIdentity{URI: "envoy"})}},
+		{name: "invalid mode", opts: []Option{WithSources(SourceXForwardedFor), WithTrustedPeerIdentities(PeerIdentity{DNSName: "envoy"}), WithPeerTrustMode(PeerTrustMode(9))}},
+		{name: "mode without identities", opts: []Option{WithTrustedProxies(LoopbackProxyPrefixes()...), WithSources(SourceXForwardedFor), WithPeerTrustMode(PeerTrustAll)}},
+		{name: "all without proxies", opts: []Option{WithSources(SourceXForwardedFor), WithTrustedPeerIdentities(PeerIdentity{DNSName: "envoy"}), WithPeerTrustMode(PeerTrustAll)}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.opts...); err == nil {
+				t.Fatal("New() error = nil, want rejection")
+			}
+		})
+	}
+
+	resolver, err := New(
+		WithSources(SourceXForwardedFor),
+		WithTrustedPeerIdentities(
+			PeerIdentity{URI: "spiffe://mesh.example/sa/envoy", DNSName: "Envoy.Mesh"},
+			PeerIdentity{Subject: func(pkix.Name) bool { return true }},
+		),
+	)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	want := []string{"uri=spiffe://mesh.example/sa/envoy dns=envoy.mesh", "subject=custom"}
+	if diff := cmp.Diff(want, description.TrustedPeerIdentities); diff != "" {
+		t.Fatalf("Describe().TrustedPeerIdentities mismatch (-want +got):\n%s", diff)
+	}
+	if description.PeerTrustMode != PeerTrustAny {
+		t.Fatalf("Describe().PeerTrustMode = %v, want %v", description.PeerTrustMode, PeerTrustAny)
+	}
+}
@@ -0,0 +1,346 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultHostRefreshInterval = time.Minute
+	defaultHostLookupTimeout   = 5 * time.Second
+	minHostRefreshInterval     = time.Second
+)
+
+var errNoHostAddresses = errors.New("no addresses")
+
+// HostResolver resolves proxy hostnames. *net.Resolver implements it.
+type HostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// HostTTLResolver is an optional HostResolver extension for resolvers that
+// report record TTLs. TrustedProxyHosts refreshes no later than the shortest
+// TTL it has seen.
+type HostTTLResolver interface {
+	HostResolver
+	LookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error)
+}
+
+// TrustedProxyHostsConfig configures NewTrustedProxyHosts.
+type TrustedProxyHostsConfig struct {
+	// Hosts lists proxy hostnames, such as internal load balancer DNS names.
+	Hosts []string
+	// Resolver resolves Hosts. Nil uses net.DefaultResolver.
+	Resolver HostResolver
+	// RefreshInterval is the time between refreshes. Zero uses one minute.
+	// Shorter TTLs reported by a HostTTLResolver take precedence, down to a
+	// floor of one second.
+	RefreshInterval time.Duration
+	// LookupTimeout bounds each refresh. Zero uses 5 seconds.
+	LookupTimeout time.Duration
+}
+
+// TrustedProxyHosts is a trusted proxy set defined by hostnames and refreshed
+// in the background. Pass it to WithTrustedProxyHosts; one value may be shared
+// by several resolvers.
+//
+// Every resolved address is trusted as a single-address prefix in addition
+// to WithTrustedProxies. When a hostname fails to resolve, its last known good
+// addresses stay trusted, so a DNS outage does not turn trusted proxies into
+// untrusted peers. Remove a hostname by building a new value.
+type TrustedProxyHosts struct {
+	hosts       []string
+	resolver    HostResolver
+	interval    time.Duration
+	minInterval time.Duration
+	timeout     time.Duration
+
+	matcher atomic.Pointer[prefixMatcher]
+
+	// refreshMu serializes Refresh so a slow lookup cannot overwrite newer
+	// results.
+	refreshMu sync.Mutex
+
+	mu       sync.Mutex
+	statuses map[string]TrustedProxyHostStatus
+	ttl      time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// TrustedProxyHostStatus reports the resolution state of one hostname.
+type TrustedProxyHostStatus struct {
+	// Host is the configured hostname.
+	Host string
+	// Addrs are the addresses currently trusted for Host, sorted.
+	Addrs []netip.Addr
+	// ResolvedAt is when Addrs were last resolved successfully.
+	ResolvedAt time.Time
+	// Err is the error from the latest refresh, or nil when it succeeded.
+	// Addrs keep their last known good value while Err is set.
+	Err error
+}
+
+// NewTrustedProxyHosts resolves config.Hosts and starts refreshing them until
+// ctx is done or Close is called.
+//
+// The initial resolution runs before NewTrustedProxyHosts returns, and any
+// hostname that fails to resolve is an error, so a resolver never starts with
+// a silently empty trusted set.
+func NewTrustedProxyHosts(
+	ctx context.Context,
+	config TrustedProxyHostsConfig,
+) (*TrustedProxyHosts, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	hosts := make([]string, 0, len(config.Hosts))
+	for _, host := range config.Hosts {
+		host = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(host), "."))
+		if host == "" {
+			return nil, errors.New("trusted proxy hostnames must not be empty")
+		}
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("at least one trusted proxy hostname is required")
+	}
+	slices.Sort(hosts)
+	hosts = slices.Compact(hosts)
+
+	if config.RefreshInterval < 0 || config.LookupTimeout < 0 {
+		return nil, errors.New("trusted proxy host refresh interval and lookup timeout must be >= 0")
+	}
+
+	p := &TrustedProxyHosts{
+		hosts:       hosts,
+		resolver:    config.Resolver,
+		interval:    config.RefreshInterval,
+		minInterval: minHostRefreshInterval,
+		timeout:     config.LookupTimeout,
+		statuses:    make(map[string]TrustedProxyHostStatus, len(hosts)),
+	}
+	if isNilValue(p.resolver) {
+		p.resolver = net.DefaultResolver
+	}
+	if p.interval == 0 {
+		p.interval = defaultHostRefreshInterval
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultHostLookupTimeout
+	}
+
+	if err := p.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	p.start(ctx)
+	return p, nil
+}
+
+func (p *TrustedProxyHosts) start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	go p.run(ctx)
+}
+
+// Refresh resolves every hostname now. It returns the lookup errors joined;
+// hostnames that failed keep their last known good addresses.
+func (p *TrustedProxyHosts) Refresh(ctx context.Context) error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	type lookup struct {
+		addrs []netip.Addr
+		ttl   time.Duration
+		err   error
+	}
+	results := make([]lookup, len(p.hosts))
+	var wg sync.WaitGroup
+	for i, host := range p.hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			addrs, ttl, err := p.lookup(ctx, host)
+			results[i] = lookup{addrs: addrs, ttl: ttl, err: err}
+		}(i, host)
+	}
+	wg.Wait()
+
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var errs []error
+	p.ttl = 0
+	for i, host := range p.hosts {
+		status := p.statuses[host]
+		status.Host = host
+		status.Err = results[i].err
+		if status.Err != nil {
+			errs = append(errs, status.Err)
+		} else {
+			status.Addrs = results[i].addrs
+			status.ResolvedAt = now
+			if ttl := results[i].ttl; ttl > 0 && (p.ttl == 0 || ttl < p.ttl) {
+				p.ttl = ttl
+			}
+		}
+		p.statuses[host] = status
+	}
+
+	matcher := newPrefixMatcher(p.prefixesLocked())
+	p.matcher.Store(&matcher)
+	return errors.Join(errs...)
+}
+
+func (p *TrustedProxyHosts) lookup(
+	ctx context.Context,
+	host string,
+) ([]netip.Addr, time.Duration, error) {
+	var (
+		addrs []netip.Addr
+		ttl   time.Duration
+		err   error
+	)
+	if resolver, ok := p.resolver.(HostTTLResolver); ok {
+		addrs, ttl, err = resolver.LookupNetIPTTL(ctx, "ip", host)
+	} else {
+		addrs, err = p.resolver.LookupNetIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("resolve trusted proxy host %q: %w", host, err)
+	}
+
+	normalized := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.IsValid() {
+			normalized = append(normalized, normalizeIP(addr).WithZone(""))
+		}
+	}
+	// An answer with only invalid addresses counts as empty so a refresh
+	// keeps the last known good addresses.
+	if len(normalized) == 0 {
+		return nil, 0, fmt.Errorf("resolve trusted proxy host %q: %w", host, errNoHostAddresses)
+	}
+	slices.SortFunc(normalized, netip.Addr.Compare)
+	return slices.Compact(normalized), ttl, nil
+}
+
+func (p *TrustedProxyHosts) run(ctx context.Context) {
+	defer close(p.done)
+
+	timer := time.NewTimer(p.nextRefresh())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			// Failures are reported through Status; last known good
+			// addresses stay trusted.
+			_ = p.Refresh(ctx)
+			timer.Reset(p.nextRefresh())
+		}
+	}
+}
+
+func (p *TrustedProxyHosts) nextRefresh() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := p.interval
+	if p.ttl > 0 && p.ttl < next {
+		next = p.ttl
+	}
+	return max(next, p.minInterval)
+}
+
+// Close stops background refreshes. The last resolved addresses stay
+// trusted.
+func (p *TrustedProxyHosts) Close() {
+	if p == nil || p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+}
+
+// Hosts returns the normalized hostnames.
+func (p *TrustedProxyHosts) Hosts() []string {
+	if p == nil {
+		return nil
+	}
+	return slices.Clone(p.hosts)
+}
+
+// Prefixes returns the currently trusted single-address prefixes, sorted and
+// deduplicated.
+func (p *TrustedProxyHosts) Prefixes() []netip.Prefix {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.prefixesLocked()
+}
+
+func (p *TrustedProxyHosts) prefixesLocked() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, host := range p.hosts {
+		for _, addr := range p.statuses[host].Addrs {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return slices.Compact(sortedPrefixes(prefixes))
+}
+
+// Status returns the resolution state of every hostname, in hostname order.
+func (p *TrustedProxyHosts) Status() []TrustedProxyHostStatus {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]TrustedProxyHostStatus, 0, len(p.hosts))
+	for _, host := range p.hosts {
+		status := p.statuses[host]
+		status.Addrs = slices.Clone(status.Addrs)
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// contains reports whether ip is a currently resolved proxy address.
+func (p *TrustedProxyHosts) contains(ip netip.Addr) bool {
+	matcher := p.matcher.Load()
+	return matcher != nil && matcher.initialized && matcher.contains(ip)
+}
+
+// WithTrustedProxyHosts trusts the addresses hosts resolves to, in addition
+// to WithTrustedProxies.
+//
+// Resolved addresses count as trusted proxies everywhere trusted proxy
+// prefixes do: for the immediate peer and for chain hops. Description reports
+// the hostnames and the addresses they resolved to at the time of the call;
+// use hosts.Status for per-host resolution state. The caller owns hosts and
+// closes it after the resolver is no longer used. Calling it again replaces
+// hosts.
+func WithTrustedProxyHosts(hosts *TrustedProxyHosts) Option {
+	return optionFunc(func(c *options) { c.TrustedProxyHosts = hosts })
+}
@@ -0,0 +1,313 @@
+package clientip
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type fakeHostResolver struct {
+	mu      sync.Mutex
+	answers map[string][]netip.Addr
+	errs    map[string]error
+	calls   int
+}
+
+func newFakeHostResolver(answers map[string]string) *fakeHostResolver {
+	r := &fakeHostResolver{answers: make(map[string][]netip.Addr), errs: make(map[string]error)}
+	for host, addr := range answers {
+		r.set(host, addr)
+	}
+	return r
+}
+
+func (r *fakeHostResolver) set(host string, addrs ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parsed := make([]netip.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		parsed = append(parsed, netip.MustParseAddr(addr))
+	}
+	r.answers[host] = parsed
+	delete(r.errs, host)
+}
+
+func (r *fakeHostResolver) fail(host string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs[host] = err
+}
+
+func (r *fakeHostResolver) callCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+func (r *fakeHostResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if err := r.errs[host]; err != nil {
+		return nil, err
+	}
+	return append([]netip.Addr(nil), r.answers[host]...), nil
+}
+
+type fakeTTLHostResolver struct {
+	*fakeHostResolver
+	ttl time.Duration
+}
+
+func (r fakeTTLHostResolver) LookupNetIPTTL(ctx context.Context, network, host string) ([]netip.Addr, time.Duration, error) {
+	addrs, err := r.LookupNetIP(ctx, network, host)
+	return addrs, r.ttl, err
+}
+
+func mustNewTrustedProxyHosts(t *testing.T, resolver HostResolver, hosts ...string) *TrustedProxyHosts {
+	t.Helper()
+
+	p, err := NewTrustedProxyHosts(context.Background(), TrustedProxyHostsConfig{Hosts: hosts, Resolver: resolver})
+	if err != nil {
+		t.Fatalf("NewTrustedProxyHosts() error = %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestNewTrustedProxyHosts(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"lb-a.internal": "10.0.0.1", "lb-b.internal": "10.0.0.2"})
+	resolver.set("lb-a.internal", "10.0.0.1", "::ffff:10.0.0.3", "10.0.0.1")
+
+	p := mustNewTrustedProxyHosts(t, resolver, "LB-B.internal.", "lb-a.internal", "lb-b.internal")
+
+	if diff := cmp.Diff([]string{"lb-a.internal", "lb-b.internal"}, p.Hosts()); diff != "" {
+		t.Fatalf("Hosts() mismatch (-want +got):\n%s", diff)
+	}
+	want := mustParseCIDRs(t, "10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32")
+	if diff := cmp.Diff(want, p.Prefixes(), cmp.Comparer(func(a, b netip.Prefix) bool { return a == b })); diff != "" {
+		t.Fatalf("Prefixes() mismatch (-want +got):\n%s", diff)
+	}
+	for _, status := range p.Status() {
+		if status.Err != nil || status.ResolvedAt.IsZero() {
+			t.Fatalf("Status() = %+v, want resolved", status)
+		}
+	}
+}
+
+func TestNewTrustedProxyHosts_Invalid(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"lb.internal": "10.0.0.1"})
+	resolver.fail("down.internal", errors.New("no such host"))
+
+	tests := []struct {
+		name   string
+		config TrustedProxyHostsConfig
+	}{
+		{name: "no hosts", config: TrustedProxyHostsConfig{Resolver: resolver}},
+		{name: "empty host", config: TrustedProxyHostsConfig{Hosts: []string{"lb.internal", " "}, Resolver: resolver}},
+		{name: "negative interval", config: TrustedProxyHostsConfig{Hosts: []string{"lb.internal"}, Resolver: resolver, RefreshInterval: -time.Second}},
+		{name: "initial lookup failure", config: TrustedProxyHostsConfig{Hosts: []string{"lb.internal", "down.internal"}, Resolver: resolver}},
+		{name: "no addresses", config: TrustedProxyHostsConfig{Hosts: []string{"empty.internal"}, Resolver: resolver}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTrustedProxyHosts(context.Background(), tt.config); err == nil {
+				t.Fatal("NewTrustedProxyHosts() error = nil, want rejection")
+			}
+		})
+	}
+}
+
+func TestTrustedProxyHosts_RefreshKeepsLastKnownGood(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"lb.internal": "10.0.0.1"})
+	p := mustNewTrustedProxyHosts(t, resolver, "lb.internal")
+
+	lookupErr := errors.New("server misbehaving")
+	resolver.fail("lb.internal", lookupErr)
+	if err := p.Refresh(context.Background()); !errors.Is(err, lookupErr) {
+		t.Fatalf("Refresh() error = %v, want %v", err, lookupErr)
+	}
+	if !p.contains(netip.MustParseAddr("10.0.0.1")) {
+		t.Fatal("contains() = false after failed refresh, want last known good address")
+	}
+	status := p.Status()[0]
+	if !errors.Is(status.Err, lookupErr) || len(status.Addrs) != 1 {
+		t.Fatalf("Status() = %+v, want error with retained address", status)
+	}
+
+	resolver.set("lb.internal", "10.0.0.2")
+	if err := p.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if p.contains(netip.MustParseAddr("10.0.0.1")) || !p.contains(netip.MustParseAddr("10.0.0.2")) {
+		t.Fatalf("Prefixes() = %v, want only 10.0.0.2", p.Prefixes())
+	}
+	if p.Status()[0].Err != nil {
+		t.Fatalf("Status().Err = %v, want nil", p.Status()[0].Err)
+	}
+
+	resolver.set("lb.internal")
+	if err := p.Refresh(context.Background()); !errors.Is(err, errNoHostAddresses) {
+		t.Fatalf("Refresh() with empty answer error = %v, want %v", err, errNoHostAddresses)
+	}
+	resolver.mu.Lock()
+	resolver.answers["lb.internal"] = []netip.Addr{{}}
+	resolver.mu.Unlock()
+	if err := p.Refresh(context.Background()); !errors.Is(err, errNoHostAddresses) {
+		t.Fatalf("Refresh() with only invalid addresses error = %v, want %v", err, errNoHostAddresses)
+	}
+	if !p.contains(netip.MustParseAddr("10.0.0.2")) {
+		t.Fatal("contains() = false after empty refresh, want last known good address")
+	}
+}
+
+func TestExtract_TrustedProxyHosts(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"edge.internal": "10.0.0.1", "lb.internal": "10.0.0.2"})
+	hosts := mustNewTrustedProxyHosts(t, resolver, "edge.internal", "lb.internal")
+
+	cfg := defaultOptions()
+	cfg.Sources = []Source{SourceXForwardedFor}
+	WithTrustedProxyHosts(hosts).applyOption(&cfg)
+	extractor := mustNewExtractor(t, cfg)
+
+	extract := func(remoteAddr, xff string) (Extraction, error) {
+		req := newTestRequest(remoteAddr, "/")
+		req.Header.Set("X-Forwarded-For", xff)
+		return extractor.Extract(req)
+	}
+
+	result, err := extract("10.0.0.2:443", "8.8.8.8, 10.0.0.1")
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	if result.IP != netip.MustParseAddr("8.8.8.8") {
+		t.Fatalf("IP = %v, want 8.8.8.8 behind both resolved hops", result.IP)
+	}
+
+	resolver.set("lb.internal", "10.0.0.9")
+	if err := hosts.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, err := extract("10.0.0.2:443", "8.8.8.8"); !errors.Is(err, ErrUntrustedProxy) {
+		t.Fatalf("Extract() from replaced address error = %v, want %v", err, ErrUntrustedProxy)
+	}
+	if result, err := extract("10.0.0.9:443", "8.8.8.8"); err != nil || result.IP != netip.MustParseAddr("8.8.8.8") {
+		t.Fatalf("Extract() from new address = %v, %v, want 8.8.8.8", result.IP, err)
+	}
+}
+
+func TestNew_TrustedProxyHostsDescribe(t *testing.T) {
+	dns := newFakeHostResolver(map[string]string{"lb.internal": "10.0.0.1"})
+	hosts := mustNewTrustedProxyHosts(t, dns, "lb.internal")
+
+	if _, err := New(WithSources(SourceXForwardedFor)); err == nil {
+		t.Fatal("New() without trusted proxies error = nil, want rejection")
+	}
+	resolver, err := New(WithSources(SourceXForwardedFor), WithTrustedProxyHosts(hosts))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	description := resolver.Describe()
+	if diff := cmp.Diff([]string{"lb.internal"}, description.TrustedProxyHosts); diff != "" {
+		t.Fatalf("Describe().TrustedProxyHosts mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}, description.TrustedProxyHostPrefixes, cmp.Comparer(func(a, b netip.Prefix) bool { return a == b })); diff != "" {
+		t.Fatalf("Describe().TrustedProxyHostPrefixes mismatch (-want +got):\n%s", diff)
+	}
+	body, err := json.Marshal(description)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(body), `"trusted_proxy_host_prefixes":["10.0.0.1/32"]`) {
+		t.Fatalf("json = %s, want resolved host prefixes", body)
+	}
+
+	dns.set("lb.internal", "10.0.0.2")
+	if err := hosts.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	refreshed := resolver.Describe()
+	if got := refreshed.TrustedProxyHostPrefixes; len(got) != 1 || got[0] != netip.MustParsePrefix("10.0.0.2/32") {
+		t.Fatalf("Describe().TrustedProxyHostPrefixes after refresh = %v, want [10.0.0.2/32]", got)
+	}
+	if refreshed.Fingerprint() != description.Fingerprint() {
+		t.Fatal("Fingerprint() changed with resolved host addresses, want hostnames only")
+	}
+}
+
+func TestTrustedProxyHosts_NextRefresh(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"lb.internal": "10.0.0.1"})
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		ttl      time.Duration
+		want     time.Duration
+	}{
+		{name: "default interval", want: defaultHostRefreshInterval},
+		{name: "configured interval", interval: 10 * time.Second, want: 10 * time.Second},
+		{name: "shorter ttl", interval: 10 * time.Second, ttl: 3 * time.Second, want: 3 * time.Second},
+		{name: "longer ttl", interval: 10 * time.Second, ttl: time.Hour, want: 10 * time.Second},
+		{name: "ttl floor", ttl: time.Millisecond, want: minHostRefreshInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewTrustedProxyHosts(context.Background(), TrustedProxyHostsConfig{
+				Hosts:           []string{"lb.internal"},
+				Resolver:        fakeTTLHostResolver{fakeHostResolver: resolver, ttl: tt.ttl},
+				RefreshInterval: tt.interval,
+			})
+			if err != nil {
+				t.Fatalf("NewTrustedProxyHosts() error = %v", err)
+			}
+			defer p.Close()
+
+			if got := p.nextRefresh(); got != tt.want {
+				t.Fatalf("nextRefresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedProxyHosts_BackgroundRefresh(t *testing.T) {
+	resolver := newFakeHostResolver(map[string]string{"lb.internal": "10.0.0.1"})
+	p := &TrustedProxyHosts{
+		hosts:       []string{"lb.internal"},
+		resolver:    resolver,
+		interval:    time.Millisecond,
+		minInterval: time.Millisecond,
+		timeout:     time.Second,
+		statuses:    make(map[string]TrustedProxyHostStatus),
+	}
+	if err := p.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	resolver.set("lb.internal", "10.0.0.2")
+	p.start(context.Background())
+	deadline := time.Now().Add(5 * time.Second)
+	for !p.contains(netip.MustParseAddr("10.0.0.2")) {
+		if time.Now().After(deadline) {
+			p.Close()
+			t.Fatal("background refresh did not pick up the new address")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	p.Close()
+	calls := resolver.callCount()
+	time.Sleep(10 * time.Millisecond)
+	if got := resolver.callCount(); got != calls {
+		t.Fatalf("lookups after Close = %d, want %d", got, calls)
+	}
+	p.Close()
+}
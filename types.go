@@ -37,12 +37,46 @@ var (
 	// ErrInvalidIP indicates the extracted client IP is invalid or implausible.
 	ErrInvalidIP = errors.New("invalid or implausible IP address")
 
+	// ErrPrivateIP indicates the extracted client IP is a private address not
+	// allowed by the client-IP policy. It wraps ErrInvalidIP.
+	ErrPrivateIP = fmt.Errorf("%w: private address", ErrInvalidIP)
+
+	// ErrReservedIP indicates the extracted client IP is in a reserved or
+	// special-purpose range not allowed by the client-IP policy. It wraps
+	// ErrInvalidIP. Use ClassifyAddr to find the matching range.
+	ErrReservedIP = fmt.Errorf("%w: reserved address", ErrInvalidIP)
+
+	// ErrOpaqueNode indicates the selected client hop was an "unknown" or
+	// obfuscated node under OpaqueNodeTerminal. It wraps ErrInvalidIP.
+	ErrOpaqueNode = fmt.Errorf("%w: opaque node", ErrInvalidIP)
+
 	// ErrChainTooLong indicates a Forwarded/X-Forwarded-For chain exceeded the
 	// configured maximum length.
 	ErrChainTooLong = errors.New("proxy chain too long")
 
 	// ErrInvalidForwardedHeader indicates a malformed RFC7239 Forwarded header.
 	ErrInvalidForwardedHeader = errors.New("invalid Forwarded header")
+
+	// ErrInvalidXForwardedForHeader indicates an X-Forwarded-For or
+	// ChainHeaderSource value rejected by XForwardedForStrict.
+	ErrInvalidXForwardedForHeader = errors.New("invalid X-Forwarded-For header")
+
+	// ErrInvalidSignature indicates a SignedHeaderSource header failed
+	// signature, freshness, or replay verification.
+	ErrInvalidSignature = errors.New("invalid client IP signature")
+
+	// ErrInvalidHeaderValue indicates a source header failed
+	// WithHeaderHygiene because it was too large or contained disallowed
+	// bytes.
+	ErrInvalidHeaderValue = errors.New("invalid header value")
+
+	// ErrInconsistentSources indicates that sources in a ConsistencyGroup
+	// resolved different client IPs.
+	ErrInconsistentSources = errors.New("inconsistent client IP sources")
+
+	// ErrForwardedByMismatch indicates a Forwarded by= parameter did not name
+	// the local listener or the proxy recorded in the next element.
+	ErrForwardedByMismatch = errors.New("inconsistent Forwarded by= parameter")
 )
 
 // ExtractionError wraps a source-specific extraction failure.
@@ -127,16 +161,20 @@ type InvalidIPError struct {
 	Index int
 	// TrustedProxies is the number of trusted proxies found in Chain.
 	TrustedProxies int
+	// Policy names the WithSourceClientIPPolicy policy that rejected the
+	// address. It is empty when the resolver-wide policy applied, when the
+	// value did not parse as an IP, and for ClientIPValidator rejections.
+	Policy string
 }
 
 // Error implements error.
 func (e *InvalidIPError) Error() string {
 	if e.Chain != "" {
-		return fmt.Sprintf("%s: %v (chain=%q, extracted_ip=%q, index=%d, trusted_proxies=%d)",
-			e.Source.String(), e.Err, e.Chain, e.ExtractedIP, e.Index, e.TrustedProxies)
+		return fmt.Sprintf("%s: %v (chain=%q, extracted_ip=%q, index=%d, trusted_proxies=%d%s)",
+			e.Source.String(), e.Err, e.Chain, e.ExtractedIP, e.Index, e.TrustedProxies, policySuffix(e.Policy))
 	}
 	if e.ExtractedIP != "" {
-		return fmt.Sprintf("%s: %v (ip=%q)", e.Source.String(), e.Err, e.ExtractedIP)
+		return fmt.Sprintf("%s: %v (ip=%q%s)", e.Source.String(), e.Err, e.ExtractedIP, policySuffix(e.Policy))
 	}
 	return e.ExtractionError.Error()
 }
@@ -146,11 +184,21 @@ type RemoteAddrError struct {
 	ExtractionError
 	// RemoteAddr is the original remote address string.
 	RemoteAddr string
+	// Policy names the WithSourceClientIPPolicy policy that rejected the
+	// address, with the same rules as InvalidIPError.Policy.
+	Policy string
 }
 
 // Error implements error.
 func (e *RemoteAddrError) Error() string {
-	return fmt.Sprintf("%s: %v (remote_addr=%q)", e.Source.String(), e.Err, e.RemoteAddr)
+	return fmt.Sprintf("%s: %v (remote_addr=%q%s)", e.Source.String(), e.Err, e.RemoteAddr, policySuffix(e.Policy))
+}
+
+func policySuffix(policy string) string {
+	if policy == "" {
+		return ""
+	}
+	return fmt.Sprintf(", policy=%q", policy)
 }
 
 // ChainTooLongError reports an overlong Forwarded/X-Forwarded-For chain.
@@ -168,6 +216,106 @@ func (e *ChainTooLongError) Error() string {
 		e.Source.String(), e.Err, e.ChainLength, e.MaxLength)
 }
 
+// HeaderHygieneError reports a source header rejected by WithHeaderHygiene.
+type HeaderHygieneError struct {
+	ExtractionError
+	// HeaderName is the canonical header name.
+	HeaderName string
+	// Size is the total byte size of all header lines.
+	Size int
+	// MaxBytes is the configured size limit, or 0 when unlimited.
+	MaxBytes int
+	// Offset is the position of the first disallowed byte across the
+	// concatenated header lines, or -1 when the size limit was exceeded.
+	Offset int
+}
+
+// Error implements error.
+func (e *HeaderHygieneError) Error() string {
+	return fmt.Sprintf("%s: %v (header=%q, size=%d, max_bytes=%d, offset=%d)",
+		e.Source.String(), e.Err, e.HeaderName, e.Size, e.MaxBytes, e.Offset)
+}
+
+// OriginSecretError reports a request that failed WithOriginSecret. It wraps
+// ErrUntrustedProxy.
+type OriginSecretError struct {
+	ExtractionError
+	// HeaderName is the canonical origin secret header name.
+	HeaderName string
+	// Reason is OriginSecretMissing, OriginSecretMultiple, or
+	// OriginSecretMismatch.
+	Reason string
+}
+
+// Error implements error.
+func (e *OriginSecretError) Error() string {
+	return fmt.Sprintf("%s: %v (header=%q, reason=%s)", e.Source.String(), e.Err, e.HeaderName, e.Reason)
+}
+
+// SignatureError reports a SignedHeaderSource header that failed
+// verification. It wraps ErrInvalidSignature.
+type SignatureError struct {
+	ExtractionError
+	// HeaderName is the canonical client IP header name.
+	HeaderName string
+	// Reason is one of the Signature... failure reasons.
+	Reason string
+	// RequestID is the request ID of a validly signed header that was stale,
+	// from the future, or replayed. It is empty for unverified input.
+	RequestID string
+	// Timestamp is the parsed signing time in Unix seconds, or 0 when it was
+	// missing or malformed.
+	Timestamp int64
+}
+
+// Error implements error.
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("%s: %v (header=%q, reason=%s, request_id=%q, timestamp=%d)",
+		e.Source.String(), e.Err, e.HeaderName, e.Reason, e.RequestID, e.Timestamp)
+}
+
+// ForwardedByError reports a Forwarded element whose by= failed
+// WithForwardedByValidation.
+type ForwardedByError struct {
+	ExtractionError
+	// Chain is the parsed for= chain rendered as a comma-separated string.
+	Chain string
+	// Index is the index in Chain of the element whose by= failed.
+	Index int
+	// By is the element's by= value, empty when it was missing.
+	By string
+	// Expected is the node by= should have named: the next element's for=
+	// value, or the local listener address for the nearest element when
+	// known.
+	Expected string
+}
+
+// Error implements error.
+func (e *ForwardedByError) Error() string {
+	return fmt.Sprintf("%s: %v (chain=%q, index=%d, by=%q, expected=%q)",
+		e.Source.String(), e.Err, e.Chain, e.Index, e.By, e.Expected)
+}
+
+// ConsistencyError reports that the resolved source disagreed with another
+// member of a ConsistencyGroup.
+type ConsistencyError struct {
+	ExtractionError
+	// Group is the consistency group name.
+	Group string
+	// IP is the client IP resolved from Source.
+	IP netip.Addr
+	// ConflictingSource is the group member that disagreed.
+	ConflictingSource Source
+	// ConflictingIP is the client IP resolved from ConflictingSource.
+	ConflictingIP netip.Addr
+}
+
+// Error implements error.
+func (e *ConsistencyError) Error() string {
+	return fmt.Sprintf("%s: %v (group=%q, ip=%s, conflicting_source=%s, conflicting_ip=%s)",
+		e.Source.String(), e.Err, e.Group, e.IP, e.ConflictingSource.String(), e.ConflictingIP)
+}
+
 // ChainDebugInfo describes parsed chain-analysis details for diagnostics.
 type ChainDebugInfo struct {
 	// FullChain contains the parsed Forwarded or X-Forwarded-For chain.
@@ -176,6 +324,8 @@ type ChainDebugInfo struct {
 	ClientIndex int
 	// TrustedIndices are the indexes identified as trusted proxies.
 	TrustedIndices []int
+	// OpaqueIndices are the indexes of "unknown" and obfuscated nodes.
+	OpaqueIndices []int
 }
 
 // Extraction contains extraction metadata.
@@ -185,7 +335,9 @@ type ChainDebugInfo struct {
 // For additional diagnostics (such as chain details or trusted-proxy counts),
 // inspect typed errors like ProxyValidationError and InvalidIPError.
 type Extraction struct {
-	// IP is the normalized client IP when extraction succeeds.
+	// IP is the normalized client IP when extraction succeeds. It is the zero
+	// Addr for an anonymous client unless an address was substituted; see
+	// AnonymousNode.
 	IP netip.Addr
 
 	// Source identifies where IP came from. On error it may identify the source
@@ -196,9 +348,42 @@ type Extraction struct {
 	// source.
 	TrustedProxyCount int
 
+	// WrapperIP is the NAT64, 6to4, or Teredo address that IP was unwrapped
+	// from when WithEmbeddedIPv4 is enabled. It is the zero Addr otherwise.
+	WrapperIP netip.Addr
+
+	// AnonymousNode is the "unknown" or obfuscated node, such as "_hidden",
+	// that a chain source selected as the client under OpaqueNodeAnonymous.
+	// IP is the zero Addr when it is set, and Result.Classify reports
+	// ResultAnonymous. ResolveOperational instead applies its fallback and
+	// WithReportOnly resolvers substitute the connecting peer; both keep
+	// AnonymousNode set.
+	AnonymousNode string
+
 	// DebugInfo contains optional parsed chain details when WithDebugInfo is
 	// enabled and a chain source succeeds.
 	DebugInfo *ChainDebugInfo
+
+	// SpoofAttemptIgnored reports that at least one header source configured
+	// with UntrustedPeerIgnore was present on a request from an untrusted peer
+	// and was skipped.
+	SpoofAttemptIgnored bool
+
+	// SkippedErr joins, in source order, the typed errors of sources whose
+	// failures were skipped by WithSourceFailurePolicy or UntrustedPeerIgnore.
+	// It is nil when nothing was skipped. Use errors.Is and errors.As to audit
+	// it; it is kept as an error rather than a slice so Result stays
+	// comparable.
+	SkippedErr error
+
+	// ConsistencyErr joins the ConsistencyError values of ConsistencyWarn
+	// groups whose members disagreed with IP. It is nil otherwise.
+	ConsistencyErr error
+
+	// ParseDefectErr joins the Forwarded parameter defects tolerated by
+	// ForwardedLenient, each an ExtractionError wrapping
+	// ErrInvalidForwardedHeader. It is nil otherwise.
+	ParseDefectErr error
 }
 
 // ParseCIDRs parses one or more CIDR strings.
@@ -116,6 +116,59 @@ func TestTypedErrors_ErrorFormatting(t *testing.T) {
 			},
 			want: `x_real_ip: multiple single-IP headers received (header_count=3, remote_addr=2.2.2.2:4321)`,
 		},
+		{
+			name: "ConsistencyError",
+			err: &ConsistencyError{
+				ExtractionError:   ExtractionError{Err: ErrInconsistentSources, Source: SourceXForwardedFor},
+				Group:             "edge",
+				IP:                netip.MustParseAddr("8.8.8.8"),
+				ConflictingSource: SourceXRealIP,
+				ConflictingIP:     netip.MustParseAddr("1.1.1.1"),
+			},
+			want: `x_forwarded_for: inconsistent client IP sources (group="edge", ip=8.8.8.8, conflicting_source=x_real_ip, conflicting_ip=1.1.1.1)`,
+		},
+		{
+			name: "HeaderHygieneError",
+			err: &HeaderHygieneError{
+				ExtractionError: ExtractionError{Err: ErrInvalidHeaderValue, Source: SourceXForwardedFor},
+				HeaderName:      "X-Forwarded-For",
+				Size:            9,
+				MaxBytes:        4096,
+				Offset:          7,
+			},
+			want: `x_forwarded_for: invalid header value (header="X-Forwarded-For", size=9, max_bytes=4096, offset=7)`,
+		},
+		{
+			name: "OriginSecretError",
+			err: &OriginSecretError{
+				ExtractionError: ExtractionError{Err: ErrUntrustedProxy, Source: SourceXForwardedFor},
+				HeaderName:      "X-Azure-Fdid",
+				Reason:          OriginSecretMismatch,
+			},
+			want: `x_forwarded_for: request from untrusted proxy (header="X-Azure-Fdid", reason=mismatch)`,
+		},
+		{
+			name: "SignatureError",
+			err: &SignatureError{
+				ExtractionError: ExtractionError{Err: ErrInvalidSignature, Source: SourceXRealIP},
+				HeaderName:      "X-Edge-Client-Ip",
+				Reason:          SignatureReplayed,
+				RequestID:       "req-1",
+				Timestamp:       1700000000,
+			},
+			want: `x_real_ip: invalid client IP signature (header="X-Edge-Client-Ip", reason=replayed, request_id="req-1", timestamp=1700000000)`,
+		},
+		{
+			name: "ForwardedByError",
+			err: &ForwardedByError{
+				ExtractionError: ExtractionError{Err: ErrForwardedByMismatch, Source: SourceForwarded},
+				Chain:           "8.8.8.8, 10.0.0.2",
+				Index:           0,
+				By:              "10.0.0.7",
+				Expected:        "10.0.0.2",
+			},
+			want: `forwarded: inconsistent Forwarded by= parameter (chain="8.8.8.8, 10.0.0.2", index=0, by="10.0.0.7", expected="10.0.0.2")`,
+		},
 		{
 			name: "ProxyValidationError",
 			err: &ProxyValidationError{
@@ -146,6 +199,15 @@ func TestTypedErrors_ErrorFormatting(t *testing.T) {
 			},
 			want: `x_real_ip: invalid or implausible IP address (ip="not-an-ip")`,
 		},
+		{
+			name: "InvalidIPError with policy",
+			err: &InvalidIPError{
+				ExtractionError: ExtractionError{Err: ErrInvalidIP, Source: SourceXRealIP},
+				ExtractedIP:     "10.0.0.1",
+				Policy:          "internal-mesh",
+			},
+			want: `x_real_ip: invalid or implausible IP address (ip="10.0.0.1", policy="internal-mesh")`,
+		},
 		{
 			name: "InvalidIPError falls back to ExtractionError formatting",
 			err: &InvalidIPError{
@@ -195,6 +257,10 @@ func TestSource_StringAndCanonicalization(t *testing.T) {
 		{name: "custom header", got: HeaderSource("CF-Connecting-IP"), want: HeaderSource("cf-connecting-ip"), text: "cf_connecting_ip"},
 		{name: "static fallback alias", got: HeaderSource("Static-Fallback"), want: SourceStaticFallback, text: "static_fallback"},
 		{name: "blank header invalid", got: HeaderSource("  "), want: Source{}, text: ""},
+		{name: "chain header", got: ChainHeaderSource("x-envoy-external-address"), want: ChainHeaderSource("X-Envoy-External-Address"), text: "chain:x_envoy_external_address"},
+		{name: "chain header xff alias", got: ChainHeaderSource("X-Forwarded-For"), want: SourceXForwardedFor, text: "x_forwarded_for"},
+		{name: "chain header remote addr invalid", got: ChainHeaderSource("remote_addr"), want: Source{}, text: ""},
+		{name: "chain header text form", got: HeaderSource("chain:True-Client-IP"), want: ChainHeaderSource("True-Client-Ip"), text: "chain:true_client_ip"},
 	}
 
 	for _, tt := range tests {
@@ -210,6 +276,16 @@ func TestSource_StringAndCanonicalization(t *testing.T) {
 	}
 }
 
+func TestChainHeaderSource_StringDistinctFromHeaderSource(t *testing.T) {
+	chain, header := ChainHeaderSource("X-Original-Forwarded-For"), HeaderSource("X-Original-Forwarded-For")
+	if chain.String() == header.String() {
+		t.Fatalf("ChainHeaderSource and HeaderSource share String() %q", chain.String())
+	}
+	if got, want := chain.String(), "chain:x_original_forwarded_for"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
 func TestHeaderSource_String(t *testing.T) {
 	tests := []struct {
 		input string
@@ -278,6 +354,24 @@ func TestSource_TextAndJSONRoundTrip(t *testing.T) {
 	if got, want := decoded.Source, SourceXForwardedFor; got != want {
 		t.Fatalf("json.Unmarshal() source = %q, want %q", got, want)
 	}
+
+	chain := ChainHeaderSource("X-Original-Forwarded-For")
+	text, err = chain.MarshalText()
+	if err != nil {
+		t.Fatalf("MarshalText() error = %v", err)
+	}
+	if got, want := string(text), "chain:X-Original-Forwarded-For"; got != want {
+		t.Fatalf("MarshalText() = %q, want %q", got, want)
+	}
+	if err := fromText.UnmarshalText(text); err != nil {
+		t.Fatalf("UnmarshalText() error = %v", err)
+	}
+	if got, want := fromText, chain; got != want {
+		t.Fatalf("UnmarshalText() = %q, want %q", got, want)
+	}
+	if fromText == HeaderSource("X-Original-Forwarded-For") {
+		t.Fatal("chain header source equals single header source")
+	}
 }
 
 func TestSource_BuiltinsIgnoreExportedValueMutation(t *testing.T) {